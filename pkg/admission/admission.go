@@ -0,0 +1,158 @@
+// Package admission simulates the admission of pods by a SecurityContextConstraints and by the policies
+// scc2psp converts it into, to find the workloads a conversion would reject before cutting over.
+package admission
+
+import (
+	"fmt"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	"github.com/brito-rafa/k8s-mutators/pkg/scc2psp"
+	dcAPI "github.com/openshift/api/apps/v1"
+	security "github.com/openshift/api/security/v1"
+	"github.com/sirupsen/logrus"
+	deployAPI "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// Violation is a pod setting a policy rejects
+type Violation struct {
+	// Path is the JSON path of the setting in the pod, e.g. spec.containers[0].securityContext.privileged
+	Path    string
+	Message string
+}
+
+// SimulationOutput contains the admission decisions of every policy for a pod. The report holds an
+// entry for every difference between the SCC decision and the decision of a converted policy.
+type SimulationOutput struct {
+	SCCViolations         []Violation
+	PSPViolations         []Violation
+	PodSecurityViolations []Violation
+	Report                mutator.Report
+}
+
+// SCCAdmitted tells whether the SecurityContextConstraints admits the pod
+func (o *SimulationOutput) SCCAdmitted() bool {
+	return len(o.SCCViolations) == 0
+}
+
+// PSPAdmitted tells whether the converted PodSecurityPolicy admits the pod
+func (o *SimulationOutput) PSPAdmitted() bool {
+	return len(o.PSPViolations) == 0
+}
+
+// PodSecurityAdmitted tells whether the Pod Security Standards level admits the pod
+func (o *SimulationOutput) PodSecurityAdmitted() bool {
+	return len(o.PodSecurityViolations) == 0
+}
+
+// Simulator evaluates pods against a SecurityContextConstraints and its conversions
+type Simulator struct {
+	name   string
+	log    logrus.FieldLogger
+	scc    security.SecurityContextConstraints
+	policy *scc2psp.MutatorOutput
+	level  scc2psp.PodSecurityLevel
+}
+
+// NewSimulator creates a new Simulator. Clients of this API should set a meaningful name that can be used
+// to easily identify the calling client.
+// The policy is the scc2psp output of the SCC and the level the Pod Security Standards level enforced
+// in its place, a nil policy or an empty level skip the corresponding simulation.
+func NewSimulator(name string, log logrus.FieldLogger, scc security.SecurityContextConstraints,
+	policy *scc2psp.MutatorOutput, level scc2psp.PodSecurityLevel) Simulator {
+	return Simulator{
+		name:   name,
+		log:    log,
+		scc:    scc,
+		policy: policy,
+		level:  level,
+	}
+}
+
+// Simulate evaluates the admission of a pod created in the given namespace. Pods of the namespaces
+// scc2psp resolved the ranges of are evaluated against the PodSecurityPolicy of their namespace.
+func (s *Simulator) Simulate(namespace string, pod core.PodSpec) (*SimulationOutput, error) {
+	switch s.level {
+	case "", scc2psp.PodSecurityPrivileged, scc2psp.PodSecurityBaseline, scc2psp.PodSecurityRestricted:
+	default:
+		return nil, fmt.Errorf("unknown pod security level %q", s.level)
+	}
+
+	output := &SimulationOutput{
+		SCCViolations: constraintsFromSCC(s.scc).evaluate(pod),
+	}
+
+	if s.policy != nil {
+		psp := s.policy.PodSecurityPolicy
+		for _, namespacePolicy := range s.policy.NamespacePolicies {
+			if namespacePolicy.Namespace == namespace {
+				psp = namespacePolicy.PodSecurityPolicy
+			}
+		}
+
+		output.PSPViolations = constraintsFromPSP(psp).evaluate(pod)
+		s.reportDifferences(output, output.PSPViolations, "PodSecurityPolicy "+psp.Name)
+	}
+
+	if s.level != "" {
+		output.PodSecurityViolations = evaluatePodSecurity(s.level, pod)
+		s.reportDifferences(output, output.PodSecurityViolations, "the "+string(s.level)+" Pod Security Standards level")
+	}
+
+	s.log.Debugf("[%s] simulation = %#v", s.name, output)
+
+	return output, nil
+}
+
+// SimulateObject evaluates the admission of a Pod or of the pods of a Deployment or a DeploymentConfig,
+// either typed or *unstructured.Unstructured
+func (s *Simulator) SimulateObject(obj runtime.Object) (*SimulationOutput, error) {
+	var namespace string
+	var pod core.PodSpec
+
+	switch kind := obj.GetObjectKind().GroupVersionKind().Kind; kind {
+	case "Pod":
+		in := core.Pod{}
+		if err := mutator.Convert(obj, &in); err != nil {
+			return nil, err
+		}
+		namespace, pod = in.Namespace, in.Spec
+	case "Deployment":
+		in := deployAPI.Deployment{}
+		if err := mutator.Convert(obj, &in); err != nil {
+			return nil, err
+		}
+		namespace, pod = in.Namespace, in.Spec.Template.Spec
+	case "DeploymentConfig":
+		in := dcAPI.DeploymentConfig{}
+		if err := mutator.Convert(obj, &in); err != nil {
+			return nil, err
+		}
+		if in.Spec.Template == nil {
+			return nil, fmt.Errorf("DeploymentConfig %s has no pod template", in.Name)
+		}
+		namespace, pod = in.Namespace, in.Spec.Template.Spec
+	default:
+		return nil, fmt.Errorf("cannot simulate the admission of kind %q", kind)
+	}
+
+	return s.Simulate(namespace, pod)
+}
+
+// reportDifferences reports the pods a converted policy rejects while the SCC admits them, and the pods
+// the SCC rejects while the converted policy admits them
+func (s *Simulator) reportDifferences(output *SimulationOutput, violations []Violation, target string) {
+	switch {
+	case output.SCCAdmitted() && len(violations) > 0:
+		for _, violation := range violations {
+			output.Report.Approximated(violation.Path, mutator.SeverityHigh, nil,
+				fmt.Sprintf("admitted by SecurityContextConstraints %s, rejected by %s: %s", s.scc.Name, target, violation.Message))
+		}
+	case !output.SCCAdmitted() && len(violations) == 0:
+		for _, violation := range output.SCCViolations {
+			output.Report.Approximated(violation.Path, mutator.SeverityWarning, nil,
+				fmt.Sprintf("rejected by SecurityContextConstraints %s, admitted by %s: %s", s.scc.Name, target, violation.Message))
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package admission
+
+import (
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	"github.com/brito-rafa/k8s-mutators/pkg/scc2psp"
+	dcAPI "github.com/openshift/api/apps/v1"
+	security "github.com/openshift/api/security/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	deployAPI "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const clientName = "testClient"
+
+func newAnyUIDSCC() security.SecurityContextConstraints {
+	scc := security.SecurityContextConstraints{}
+	scc.Name = "anyuid"
+	scc.Users = []string{"system:serviceaccount:web:default"}
+	scc.RequiredDropCapabilities = []core.Capability{"MKNOD"}
+	scc.SELinuxContext.Type = security.SELinuxStrategyMustRunAs
+	scc.RunAsUser.Type = security.RunAsUserStrategyRunAsAny
+	scc.SupplementalGroups.Type = security.SupplementalGroupsStrategyRunAsAny
+	scc.FSGroup.Type = security.FSGroupStrategyRunAsAny
+	scc.Volumes = []security.FSType{"configMap", "downwardAPI", "emptyDir", "persistentVolumeClaim", "projected", "secret"}
+
+	return scc
+}
+
+func newSimulator(t *testing.T, scc security.SecurityContextConstraints, level scc2psp.PodSecurityLevel) Simulator {
+	m := scc2psp.NewMutator(clientName, logrus.New(), scc, scc2psp.DefaultOptions())
+
+	policy, err := m.Mutate()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewSimulator(clientName, logrus.New(), scc, policy, level)
+}
+
+func newRootPod() core.PodSpec {
+	uid := int64(0)
+
+	return core.PodSpec{
+		SecurityContext: &core.PodSecurityContext{RunAsUser: &uid},
+		Containers:      []core.Container{{Name: "web", Image: "nginx"}},
+	}
+}
+
+func TestSimulateRejectedByPodSecurity(t *testing.T) {
+	s := newSimulator(t, newAnyUIDSCC(), scc2psp.PodSecurityRestricted)
+
+	output, err := s.Simulate("web", newRootPod())
+	assert.NoError(t, err)
+
+	assert.True(t, output.SCCAdmitted())
+	assert.True(t, output.PSPAdmitted())
+	assert.False(t, output.PodSecurityAdmitted())
+
+	paths := []string{}
+	for _, entry := range output.Report.Entries {
+		assert.Equal(t, mutator.ActionApproximated, entry.Action)
+		assert.Equal(t, mutator.SeverityHigh, entry.Severity)
+		paths = append(paths, entry.Path)
+	}
+
+	assert.Equal(t, []string{
+		"spec.securityContext.runAsUser",
+		"spec.containers[0].securityContext.seccompProfile",
+		"spec.containers[0].securityContext.capabilities.drop",
+		"spec.containers[0].securityContext.allowPrivilegeEscalation",
+		"spec.containers[0].securityContext.runAsNonRoot",
+	}, paths)
+}
+
+func TestSimulateAdmittedByBaseline(t *testing.T) {
+	s := newSimulator(t, newAnyUIDSCC(), scc2psp.PodSecurityBaseline)
+
+	output, err := s.Simulate("web", newRootPod())
+	assert.NoError(t, err)
+
+	assert.True(t, output.PodSecurityAdmitted())
+	assert.Equal(t, 0, len(output.Report.Entries))
+}
+
+func TestSimulateRejectedBySCC(t *testing.T) {
+	s := newSimulator(t, newAnyUIDSCC(), scc2psp.PodSecurityPrivileged)
+
+	privileged := true
+	pod := newRootPod()
+	pod.HostNetwork = true
+	pod.Containers[0].SecurityContext = &core.SecurityContext{
+		Privileged:   &privileged,
+		Capabilities: &core.Capabilities{Add: []core.Capability{"MKNOD"}},
+	}
+
+	output, err := s.Simulate("web", pod)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []Violation{
+		{Path: "spec.hostNetwork", Message: "host network is not allowed"},
+		{Path: "spec.containers[0].securityContext.privileged", Message: "privileged containers are not allowed"},
+		{Path: "spec.containers[0].securityContext.capabilities.add", Message: "capability MKNOD must be dropped"},
+	}, output.SCCViolations)
+	assert.Equal(t, output.SCCViolations, output.PSPViolations)
+	assert.True(t, output.PodSecurityAdmitted())
+
+	// only the pod security level is more permissive than the SCC
+	assert.Equal(t, 3, len(output.Report.Entries))
+	assert.Equal(t, mutator.SeverityWarning, output.Report.MaxSeverity())
+}
+
+func TestSimulateVolumesAndSeccomp(t *testing.T) {
+	scc := newAnyUIDSCC()
+	scc.AllowHostDirVolumePlugin = true
+	scc.SeccompProfiles = []string{"docker/default"}
+
+	s := newSimulator(t, scc, "")
+
+	pod := newRootPod()
+	pod.Volumes = []core.Volume{
+		{Name: "logs", VolumeSource: core.VolumeSource{HostPath: &core.HostPathVolumeSource{Path: "/var/log"}}},
+		{Name: "data", VolumeSource: core.VolumeSource{NFS: &core.NFSVolumeSource{Server: "nfs", Path: "/"}}},
+	}
+	pod.SecurityContext.SeccompProfile = &core.SeccompProfile{Type: core.SeccompProfileTypeRuntimeDefault}
+	pod.Containers[0].SecurityContext = &core.SecurityContext{
+		SeccompProfile: &core.SeccompProfile{Type: core.SeccompProfileTypeUnconfined},
+	}
+
+	output, err := s.Simulate("web", pod)
+	assert.NoError(t, err)
+
+	expected := []Violation{
+		{Path: "spec.volumes[1]", Message: "volume type nfs is not allowed"},
+		{Path: "spec.containers[0].securityContext.seccompProfile", Message: "seccomp profile unconfined is not allowed"},
+	}
+	assert.Equal(t, expected, output.SCCViolations)
+	assert.Equal(t, expected, output.PSPViolations)
+	assert.Nil(t, output.PodSecurityViolations)
+	assert.Equal(t, 0, len(output.Report.Entries))
+}
+
+func TestSimulateNamespacePolicy(t *testing.T) {
+	scc := newAnyUIDSCC()
+	scc.RunAsUser.Type = security.RunAsUserStrategyMustRunAsRange
+
+	namespace := core.Namespace{}
+	namespace.Name = "web"
+	namespace.Annotations = map[string]string{
+		"openshift.io/sa.scc.uid-range": "1000650000/10000",
+		"openshift.io/sa.scc.mcs":       "s0:c26,c5",
+	}
+
+	options := scc2psp.DefaultOptions()
+	options.Namespaces = []core.Namespace{namespace}
+
+	m := scc2psp.NewMutator(clientName, logrus.New(), scc, options)
+	policy, err := m.Mutate()
+	assert.NoError(t, err)
+
+	s := NewSimulator(clientName, logrus.New(), scc, policy, "")
+
+	uid := int64(1000)
+	pod := newRootPod()
+	pod.SecurityContext.RunAsUser = &uid
+
+	// the namespace range is unknown to the SCC, only the namespace policy checks it
+	output, err := s.Simulate("web", pod)
+	assert.NoError(t, err)
+	assert.True(t, output.SCCAdmitted())
+	assert.Equal(t, []Violation{{Path: "spec.securityContext.runAsUser", Message: "UID 1000 is not allowed"}}, output.PSPViolations)
+	assert.Equal(t, mutator.SeverityHigh, output.Report.MaxSeverity())
+
+	output, err = s.Simulate("api", pod)
+	assert.NoError(t, err)
+	assert.True(t, output.PSPAdmitted())
+}
+
+func TestSimulateObject(t *testing.T) {
+	s := newSimulator(t, newAnyUIDSCC(), scc2psp.PodSecurityRestricted)
+
+	deployment := &deployAPI.Deployment{}
+	deployment.Kind = "Deployment"
+	deployment.APIVersion = "apps/v1"
+	deployment.Namespace = "web"
+	deployment.Spec.Template.Spec = newRootPod()
+
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(deployment)
+	assert.NoError(t, err)
+
+	output, err := s.SimulateObject(&unstructured.Unstructured{Object: content})
+	assert.NoError(t, err)
+	assert.False(t, output.PodSecurityAdmitted())
+
+	dc := &dcAPI.DeploymentConfig{}
+	dc.Kind = "DeploymentConfig"
+	dc.APIVersion = "apps.openshift.io/v1"
+	dc.Spec.Template = &core.PodTemplateSpec{Spec: newRootPod()}
+
+	output, err = s.SimulateObject(dc)
+	assert.NoError(t, err)
+	assert.False(t, output.PodSecurityAdmitted())
+
+	dc.Spec.Template = nil
+	_, err = s.SimulateObject(dc)
+	assert.Error(t, err)
+
+	service := &core.Service{}
+	service.Kind = "Service"
+	_, err = s.SimulateObject(service)
+	assert.Error(t, err)
+}
+
+func TestSimulateUnknownLevel(t *testing.T) {
+	s := newSimulator(t, newAnyUIDSCC(), "strict")
+
+	_, err := s.Simulate("web", newRootPod())
+	assert.Error(t, err)
+}
@@ -0,0 +1,190 @@
+package admission
+
+import (
+	"fmt"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/scc2psp"
+	core "k8s.io/api/core/v1"
+)
+
+var (
+	// capabilities the baseline level allows to add
+	baselineCapabilities = map[core.Capability]bool{
+		"AUDIT_WRITE":      true,
+		"CHOWN":            true,
+		"DAC_OVERRIDE":     true,
+		"FOWNER":           true,
+		"FSETID":           true,
+		"KILL":             true,
+		"MKNOD":            true,
+		"NET_BIND_SERVICE": true,
+		"SETFCAP":          true,
+		"SETGID":           true,
+		"SETPCAP":          true,
+		"SETUID":           true,
+		"SYS_CHROOT":       true,
+	}
+
+	// SELinux types the baseline level allows to set
+	baselineSELinuxTypes = map[string]bool{
+		"":                 true,
+		"container_t":      true,
+		"container_init_t": true,
+		"container_kvm_t":  true,
+	}
+
+	// volume types the restricted level allows
+	restrictedVolumes = map[string]bool{
+		"configMap":             true,
+		"csi":                   true,
+		"downwardAPI":           true,
+		"emptyDir":              true,
+		"ephemeral":             true,
+		"persistentVolumeClaim": true,
+		"projected":             true,
+		"secret":                true,
+	}
+)
+
+// evaluatePodSecurity returns the pod settings the Pod Security Standards level rejects. Pod Security
+// Admission does not default anything, the settings required by the restricted level must be in the pod.
+func evaluatePodSecurity(level scc2psp.PodSecurityLevel, pod core.PodSpec) []Violation {
+	violations := []Violation{}
+
+	if level == scc2psp.PodSecurityPrivileged {
+		return violations
+	}
+
+	restricted := level == scc2psp.PodSecurityRestricted
+
+	reject := func(path, format string, args ...interface{}) {
+		violations = append(violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if pod.HostNetwork {
+		reject("spec.hostNetwork", "host network is not allowed")
+	}
+
+	if pod.HostPID {
+		reject("spec.hostPID", "host PID namespace is not allowed")
+	}
+
+	if pod.HostIPC {
+		reject("spec.hostIPC", "host IPC namespace is not allowed")
+	}
+
+	for i, volume := range pod.Volumes {
+		volumeType := volumeType(volume)
+
+		switch {
+		case volume.HostPath != nil:
+			reject(fmt.Sprintf("spec.volumes[%d]", i), "hostPath volumes are not allowed")
+		case restricted && !restrictedVolumes[volumeType]:
+			reject(fmt.Sprintf("spec.volumes[%d]", i), "volume type %s is not allowed", volumeType)
+		}
+	}
+
+	securityContext := pod.SecurityContext
+	if securityContext == nil {
+		securityContext = &core.PodSecurityContext{}
+	}
+
+	for i, sysctl := range securityContext.Sysctls {
+		if !safeSysctls[sysctl.Name] {
+			reject(fmt.Sprintf("spec.securityContext.sysctls[%d]", i), "sysctl %s is not allowed", sysctl.Name)
+		}
+	}
+
+	evaluateSELinux("spec.securityContext.seLinuxOptions", securityContext.SELinuxOptions, reject)
+
+	if securityContext.SeccompProfile != nil && securityContext.SeccompProfile.Type == core.SeccompProfileTypeUnconfined {
+		reject("spec.securityContext.seccompProfile", "unconfined seccomp profile is not allowed")
+	}
+
+	if restricted && securityContext.RunAsUser != nil && *securityContext.RunAsUser == 0 {
+		reject("spec.securityContext.runAsUser", "running as root is not allowed")
+	}
+
+	forEachContainer(pod, func(path string, container core.Container) {
+		sc := container.SecurityContext
+		if sc == nil {
+			sc = &core.SecurityContext{}
+		}
+
+		if sc.Privileged != nil && *sc.Privileged {
+			reject(path+".securityContext.privileged", "privileged containers are not allowed")
+		}
+
+		for _, port := range container.Ports {
+			if port.HostPort != 0 {
+				reject(path+".ports", "host port %d is not allowed", port.HostPort)
+			}
+		}
+
+		if sc.ProcMount != nil && *sc.ProcMount != core.DefaultProcMount {
+			reject(path+".securityContext.procMount", "proc mount %s is not allowed", *sc.ProcMount)
+		}
+
+		evaluateSELinux(path+".securityContext.seLinuxOptions", sc.SELinuxOptions, reject)
+
+		seccomp := sc.SeccompProfile
+		if seccomp == nil {
+			seccomp = securityContext.SeccompProfile
+		}
+
+		switch {
+		case sc.SeccompProfile != nil && sc.SeccompProfile.Type == core.SeccompProfileTypeUnconfined:
+			reject(path+".securityContext.seccompProfile", "unconfined seccomp profile is not allowed")
+		case restricted && seccomp == nil:
+			reject(path+".securityContext.seccompProfile", "seccomp profile must be RuntimeDefault or Localhost")
+		}
+
+		var capabilities core.Capabilities
+		if sc.Capabilities != nil {
+			capabilities = *sc.Capabilities
+		}
+
+		for _, capability := range capabilities.Add {
+			if (restricted && capability != "NET_BIND_SERVICE") || !baselineCapabilities[capability] {
+				reject(path+".securityContext.capabilities.add", "capability %s is not allowed", capability)
+			}
+		}
+
+		if !restricted {
+			return
+		}
+
+		if !containsCapability(capabilities.Drop, "ALL") {
+			reject(path+".securityContext.capabilities.drop", "capabilities must all be dropped")
+		}
+
+		if sc.AllowPrivilegeEscalation == nil || *sc.AllowPrivilegeEscalation {
+			reject(path+".securityContext.allowPrivilegeEscalation", "privilege escalation must be disabled")
+		}
+
+		runAsNonRoot := sc.RunAsNonRoot
+		if runAsNonRoot == nil {
+			runAsNonRoot = securityContext.RunAsNonRoot
+		}
+
+		if runAsNonRoot == nil || !*runAsNonRoot {
+			reject(path+".securityContext.runAsNonRoot", "containers must run as non root")
+		}
+
+		if sc.RunAsUser != nil && *sc.RunAsUser == 0 {
+			reject(path+".securityContext.runAsUser", "running as root is not allowed")
+		}
+	})
+
+	return violations
+}
+
+func evaluateSELinux(path string, options *core.SELinuxOptions, reject func(string, string, ...interface{})) {
+	if options == nil {
+		return
+	}
+
+	if options.User != "" || options.Role != "" || !baselineSELinuxTypes[options.Type] {
+		reject(path, "custom SELinux user, role or type is not allowed")
+	}
+}
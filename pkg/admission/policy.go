@@ -0,0 +1,481 @@
+package admission
+
+import (
+	"fmt"
+	"strings"
+
+	security "github.com/openshift/api/security/v1"
+	core "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+)
+
+// sysctls Kubernetes considers safe, allowed without being listed
+var safeSysctls = map[string]bool{
+	"kernel.shm_rmid_forced":              true,
+	"net.ipv4.ip_local_port_range":        true,
+	"net.ipv4.ip_unprivileged_port_start": true,
+	"net.ipv4.tcp_syncookies":             true,
+	"net.ipv4.ping_group_range":           true,
+}
+
+// idRule is a UID or group strategy: ranges are nil when taken from the namespace
+type idRule struct {
+	rule   string
+	ranges []policy.IDRange
+}
+
+// constraints holds what a SecurityContextConstraints or a PodSecurityPolicy allows. Both policies
+// default the pod settings they constrain, so only the settings the pod requests can be rejected.
+type constraints struct {
+	kind string
+	name string
+
+	privileged               bool
+	hostNetwork              bool
+	hostPID                  bool
+	hostIPC                  bool
+	hostPorts                []policy.HostPortRange
+	volumes                  []string
+	allowedHostPaths         []policy.AllowedHostPath
+	allowedFlexVolumes       []string
+	allowedCapabilities      []core.Capability
+	defaultAddCapabilities   []core.Capability
+	requiredDropCapabilities []core.Capability
+	allowPrivilegeEscalation *bool
+	readOnlyRootFilesystem   bool
+	runAsUser                idRule
+	fsGroup                  idRule
+	supplementalGroups       idRule
+	seLinuxRule              string
+	seLinuxOptions           *core.SELinuxOptions
+	seccompProfiles          []string
+	allowedUnsafeSysctls     []string
+	forbiddenSysctls         []string
+}
+
+func constraintsFromSCC(scc security.SecurityContextConstraints) constraints {
+	c := constraints{
+		kind:                     "SecurityContextConstraints",
+		name:                     scc.Name,
+		privileged:               scc.AllowPrivilegedContainer,
+		hostNetwork:              scc.AllowHostNetwork,
+		hostPID:                  scc.AllowHostPID,
+		hostIPC:                  scc.AllowHostIPC,
+		allowedCapabilities:      scc.AllowedCapabilities,
+		defaultAddCapabilities:   scc.DefaultAddCapabilities,
+		requiredDropCapabilities: scc.RequiredDropCapabilities,
+		allowPrivilegeEscalation: scc.AllowPrivilegeEscalation,
+		readOnlyRootFilesystem:   scc.ReadOnlyRootFilesystem,
+		seLinuxRule:              string(scc.SELinuxContext.Type),
+		seLinuxOptions:           scc.SELinuxContext.SELinuxOptions,
+		seccompProfiles:          scc.SeccompProfiles,
+		allowedUnsafeSysctls:     scc.AllowedUnsafeSysctls,
+		forbiddenSysctls:         scc.ForbiddenSysctls,
+	}
+
+	if scc.AllowHostPorts {
+		c.hostPorts = []policy.HostPortRange{{Min: 0, Max: 65535}}
+	}
+
+	for _, volume := range scc.Volumes {
+		c.volumes = append(c.volumes, string(volume))
+	}
+
+	if scc.AllowHostDirVolumePlugin {
+		c.volumes = append(c.volumes, string(security.FSTypeHostPath))
+	}
+
+	for _, flex := range scc.AllowedFlexVolumes {
+		c.allowedFlexVolumes = append(c.allowedFlexVolumes, flex.Driver)
+	}
+
+	switch scc.RunAsUser.Type {
+	case security.RunAsUserStrategyMustRunAs:
+		c.runAsUser.rule = string(policy.RunAsUserStrategyMustRunAs)
+		if scc.RunAsUser.UID != nil {
+			c.runAsUser.ranges = []policy.IDRange{{Min: *scc.RunAsUser.UID, Max: *scc.RunAsUser.UID}}
+		}
+	case security.RunAsUserStrategyMustRunAsRange:
+		c.runAsUser.rule = string(policy.RunAsUserStrategyMustRunAs)
+		if scc.RunAsUser.UIDRangeMin != nil && scc.RunAsUser.UIDRangeMax != nil {
+			c.runAsUser.ranges = []policy.IDRange{{Min: *scc.RunAsUser.UIDRangeMin, Max: *scc.RunAsUser.UIDRangeMax}}
+		}
+	default:
+		c.runAsUser.rule = string(scc.RunAsUser.Type)
+	}
+
+	c.fsGroup = idRule{rule: string(scc.FSGroup.Type), ranges: sccRanges(scc.FSGroup.Ranges)}
+	c.supplementalGroups = idRule{rule: string(scc.SupplementalGroups.Type), ranges: sccRanges(scc.SupplementalGroups.Ranges)}
+
+	return c
+}
+
+func sccRanges(ranges []security.IDRange) []policy.IDRange {
+	var result []policy.IDRange
+	for _, r := range ranges {
+		result = append(result, policy.IDRange{Min: r.Min, Max: r.Max})
+	}
+
+	return result
+}
+
+func constraintsFromPSP(psp policy.PodSecurityPolicy) constraints {
+	c := constraints{
+		kind:                     "PodSecurityPolicy",
+		name:                     psp.Name,
+		privileged:               psp.Spec.Privileged,
+		hostNetwork:              psp.Spec.HostNetwork,
+		hostPID:                  psp.Spec.HostPID,
+		hostIPC:                  psp.Spec.HostIPC,
+		hostPorts:                psp.Spec.HostPorts,
+		allowedHostPaths:         psp.Spec.AllowedHostPaths,
+		allowedCapabilities:      psp.Spec.AllowedCapabilities,
+		defaultAddCapabilities:   psp.Spec.DefaultAddCapabilities,
+		requiredDropCapabilities: psp.Spec.RequiredDropCapabilities,
+		allowPrivilegeEscalation: psp.Spec.AllowPrivilegeEscalation,
+		readOnlyRootFilesystem:   psp.Spec.ReadOnlyRootFilesystem,
+		runAsUser:                idRule{rule: string(psp.Spec.RunAsUser.Rule), ranges: psp.Spec.RunAsUser.Ranges},
+		fsGroup:                  idRule{rule: string(psp.Spec.FSGroup.Rule), ranges: psp.Spec.FSGroup.Ranges},
+		supplementalGroups:       idRule{rule: string(psp.Spec.SupplementalGroups.Rule), ranges: psp.Spec.SupplementalGroups.Ranges},
+		seLinuxRule:              string(psp.Spec.SELinux.Rule),
+		seLinuxOptions:           psp.Spec.SELinux.SELinuxOptions,
+		allowedUnsafeSysctls:     psp.Spec.AllowedUnsafeSysctls,
+		forbiddenSysctls:         psp.Spec.ForbiddenSysctls,
+	}
+
+	for _, volume := range psp.Spec.Volumes {
+		c.volumes = append(c.volumes, string(volume))
+	}
+
+	for _, flex := range psp.Spec.AllowedFlexVolumes {
+		c.allowedFlexVolumes = append(c.allowedFlexVolumes, flex.Driver)
+	}
+
+	if profiles := psp.Annotations["seccomp.security.alpha.kubernetes.io/allowedProfileNames"]; profiles != "" {
+		c.seccompProfiles = strings.Split(profiles, ",")
+	}
+
+	return c
+}
+
+// evaluate returns the pod settings the policy rejects
+func (c constraints) evaluate(pod core.PodSpec) []Violation {
+	violations := []Violation{}
+
+	reject := func(path, format string, args ...interface{}) {
+		violations = append(violations, Violation{Path: path, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if pod.HostNetwork && !c.hostNetwork {
+		reject("spec.hostNetwork", "host network is not allowed")
+	}
+
+	if pod.HostPID && !c.hostPID {
+		reject("spec.hostPID", "host PID namespace is not allowed")
+	}
+
+	if pod.HostIPC && !c.hostIPC {
+		reject("spec.hostIPC", "host IPC namespace is not allowed")
+	}
+
+	for i, volume := range pod.Volumes {
+		path := fmt.Sprintf("spec.volumes[%d]", i)
+		volumeType := volumeType(volume)
+
+		if !allowsValue(c.volumes, volumeType) {
+			reject(path, "volume type %s is not allowed", volumeType)
+			continue
+		}
+
+		if volume.HostPath != nil && len(c.allowedHostPaths) > 0 && !allowsHostPath(c.allowedHostPaths, volume.HostPath.Path) {
+			reject(path+".hostPath.path", "host path %s is not allowed", volume.HostPath.Path)
+		}
+
+		if volume.FlexVolume != nil && len(c.allowedFlexVolumes) > 0 && !allowsValue(c.allowedFlexVolumes, volume.FlexVolume.Driver) {
+			reject(path+".flexVolume.driver", "flex volume driver %s is not allowed", volume.FlexVolume.Driver)
+		}
+	}
+
+	securityContext := pod.SecurityContext
+	if securityContext == nil {
+		securityContext = &core.PodSecurityContext{}
+	}
+
+	if securityContext.FSGroup != nil && !c.fsGroup.allows(*securityContext.FSGroup) {
+		reject("spec.securityContext.fsGroup", "fsGroup %d is not allowed", *securityContext.FSGroup)
+	}
+
+	for _, group := range securityContext.SupplementalGroups {
+		if !c.supplementalGroups.allows(group) {
+			reject("spec.securityContext.supplementalGroups", "supplemental group %d is not allowed", group)
+		}
+	}
+
+	c.evaluateSecurityContext("spec.securityContext", securityContext.RunAsUser, securityContext.SELinuxOptions,
+		securityContext.SeccompProfile, reject)
+
+	for i, sysctl := range securityContext.Sysctls {
+		path := fmt.Sprintf("spec.securityContext.sysctls[%d]", i)
+
+		switch {
+		case matchesSysctl(c.forbiddenSysctls, sysctl.Name):
+			reject(path, "sysctl %s is forbidden", sysctl.Name)
+		case !safeSysctls[sysctl.Name] && !matchesSysctl(c.allowedUnsafeSysctls, sysctl.Name):
+			reject(path, "unsafe sysctl %s is not allowed", sysctl.Name)
+		}
+	}
+
+	forEachContainer(pod, func(path string, container core.Container) {
+		sc := container.SecurityContext
+		if sc == nil {
+			sc = &core.SecurityContext{}
+		}
+
+		if sc.Privileged != nil && *sc.Privileged && !c.privileged {
+			reject(path+".securityContext.privileged", "privileged containers are not allowed")
+		}
+
+		if sc.AllowPrivilegeEscalation != nil && *sc.AllowPrivilegeEscalation &&
+			c.allowPrivilegeEscalation != nil && !*c.allowPrivilegeEscalation {
+			reject(path+".securityContext.allowPrivilegeEscalation", "privilege escalation is not allowed")
+		}
+
+		if sc.ReadOnlyRootFilesystem != nil && !*sc.ReadOnlyRootFilesystem && c.readOnlyRootFilesystem {
+			reject(path+".securityContext.readOnlyRootFilesystem", "the root filesystem must be read only")
+		}
+
+		if sc.Capabilities != nil {
+			for _, capability := range sc.Capabilities.Add {
+				switch {
+				case containsCapability(c.requiredDropCapabilities, capability):
+					reject(path+".securityContext.capabilities.add", "capability %s must be dropped", capability)
+				case !containsCapability(c.allowedCapabilities, capability) && !containsCapability(c.defaultAddCapabilities, capability):
+					reject(path+".securityContext.capabilities.add", "capability %s is not allowed", capability)
+				}
+			}
+		}
+
+		for _, port := range container.Ports {
+			if port.HostPort != 0 && !allowsHostPort(c.hostPorts, port.HostPort) {
+				reject(path+".ports", "host port %d is not allowed", port.HostPort)
+			}
+		}
+
+		c.evaluateSecurityContext(path+".securityContext", sc.RunAsUser, sc.SELinuxOptions, sc.SeccompProfile, reject)
+	})
+
+	return violations
+}
+
+// evaluateSecurityContext checks the settings shared by the pod and the container security contexts
+func (c constraints) evaluateSecurityContext(path string, runAsUser *int64, seLinuxOptions *core.SELinuxOptions,
+	seccomp *core.SeccompProfile, reject func(string, string, ...interface{})) {
+
+	if runAsUser != nil {
+		switch c.runAsUser.rule {
+		case string(policy.RunAsUserStrategyMustRunAsNonRoot):
+			if *runAsUser == 0 {
+				reject(path+".runAsUser", "running as root is not allowed")
+			}
+		case string(policy.RunAsUserStrategyMustRunAs):
+			if !c.runAsUser.allows(*runAsUser) {
+				reject(path+".runAsUser", "UID %d is not allowed", *runAsUser)
+			}
+		}
+	}
+
+	if seLinuxOptions != nil && c.seLinuxRule == string(policy.SELinuxStrategyMustRunAs) && c.seLinuxOptions != nil {
+		allowed := c.seLinuxOptions
+
+		if (seLinuxOptions.User != "" && seLinuxOptions.User != allowed.User) ||
+			(seLinuxOptions.Role != "" && seLinuxOptions.Role != allowed.Role) ||
+			(seLinuxOptions.Type != "" && seLinuxOptions.Type != allowed.Type) ||
+			(seLinuxOptions.Level != "" && allowed.Level != "" && seLinuxOptions.Level != allowed.Level) {
+			reject(path+".seLinuxOptions", "SELinux options %+v are not allowed", *seLinuxOptions)
+		}
+	}
+
+	if seccomp != nil {
+		profile := seccompProfileName(seccomp)
+
+		if !allowsSeccompProfile(c.seccompProfiles, profile) {
+			reject(path+".seccompProfile", "seccomp profile %s is not allowed", profile)
+		}
+	}
+}
+
+// allows checks an ID against the rule, the ranges allocated to the namespace being unknown
+func (r idRule) allows(id int64) bool {
+	if r.rule != "MustRunAs" && r.rule != "MayRunAs" && r.rule != "MustRunAsRange" {
+		return true
+	}
+
+	if r.ranges == nil {
+		return true
+	}
+
+	for _, idRange := range r.ranges {
+		if id >= idRange.Min && id <= idRange.Max {
+			return true
+		}
+	}
+
+	return false
+}
+
+func allowsValue(allowed []string, value string) bool {
+	for _, a := range allowed {
+		if a == value || a == string(security.FSTypeAll) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func allowsHostPath(allowed []policy.AllowedHostPath, path string) bool {
+	for _, a := range allowed {
+		prefix := strings.TrimSuffix(a.PathPrefix, "/")
+
+		if path == prefix || strings.HasPrefix(path, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func allowsHostPort(ranges []policy.HostPortRange, port int32) bool {
+	for _, r := range ranges {
+		if port >= r.Min && port <= r.Max {
+			return true
+		}
+	}
+
+	return false
+}
+
+func containsCapability(capabilities []core.Capability, capability core.Capability) bool {
+	for _, c := range capabilities {
+		if c == capability || c == security.AllowAllCapabilities || (c == "ALL" && capability != "") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matchesSysctl(patterns []string, sysctl string) bool {
+	for _, pattern := range patterns {
+		if pattern == sysctl || pattern == "*" ||
+			(strings.HasSuffix(pattern, "*") && strings.HasPrefix(sysctl, strings.TrimSuffix(pattern, "*"))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func seccompProfileName(profile *core.SeccompProfile) string {
+	switch profile.Type {
+	case core.SeccompProfileTypeRuntimeDefault:
+		return "runtime/default"
+	case core.SeccompProfileTypeLocalhost:
+		if profile.LocalhostProfile != nil {
+			return "localhost/" + *profile.LocalhostProfile
+		}
+
+		return "localhost/"
+	}
+
+	return "unconfined"
+}
+
+func allowsSeccompProfile(allowed []string, profile string) bool {
+	for _, a := range allowed {
+		if a == profile || a == "*" || (a == "docker/default" && profile == "runtime/default") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// forEachContainer calls f with the path and the definition of every init and regular container
+func forEachContainer(pod core.PodSpec, f func(path string, container core.Container)) {
+	for i, container := range pod.InitContainers {
+		f(fmt.Sprintf("spec.initContainers[%d]", i), container)
+	}
+
+	for i, container := range pod.Containers {
+		f(fmt.Sprintf("spec.containers[%d]", i), container)
+	}
+}
+
+// volumeType returns the name policies give to the type of a volume
+func volumeType(volume core.Volume) string {
+	source := volume.VolumeSource
+
+	switch {
+	case source.HostPath != nil:
+		return "hostPath"
+	case source.EmptyDir != nil:
+		return "emptyDir"
+	case source.Secret != nil:
+		return "secret"
+	case source.ConfigMap != nil:
+		return "configMap"
+	case source.PersistentVolumeClaim != nil:
+		return "persistentVolumeClaim"
+	case source.DownwardAPI != nil:
+		return "downwardAPI"
+	case source.Projected != nil:
+		return "projected"
+	case source.CSI != nil:
+		return "csi"
+	case source.Ephemeral != nil:
+		return "ephemeral"
+	case source.FlexVolume != nil:
+		return "flexVolume"
+	case source.NFS != nil:
+		return "nfs"
+	case source.GitRepo != nil:
+		return "gitRepo"
+	case source.ISCSI != nil:
+		return "iscsi"
+	case source.RBD != nil:
+		return "rbd"
+	case source.CephFS != nil:
+		return "cephFS"
+	case source.Glusterfs != nil:
+		return "glusterfs"
+	case source.AWSElasticBlockStore != nil:
+		return "awsElasticBlockStore"
+	case source.GCEPersistentDisk != nil:
+		return "gcePersistentDisk"
+	case source.AzureDisk != nil:
+		return "azureDisk"
+	case source.AzureFile != nil:
+		return "azureFile"
+	case source.FC != nil:
+		return "fc"
+	case source.Flocker != nil:
+		return "flocker"
+	case source.VsphereVolume != nil:
+		return "vsphere"
+	case source.Quobyte != nil:
+		return "quobyte"
+	case source.PortworxVolume != nil:
+		return "portworxVolume"
+	case source.ScaleIO != nil:
+		return "scaleIO"
+	case source.StorageOS != nil:
+		return "storageos"
+	case source.PhotonPersistentDisk != nil:
+		return "photonPersistentDisk"
+	case source.Cinder != nil:
+		return "cinder"
+	}
+
+	return "none"
+}
@@ -1,10 +1,19 @@
 package dc2deployment
 
 import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	"github.com/brito-rafa/k8s-mutators/pkg/podtemplate"
 	dcAPI "github.com/openshift/api/apps/v1"
+	imageAPI "github.com/openshift/api/image/v1"
 	"github.com/sirupsen/logrus"
 	deployAPI "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 const (
@@ -23,30 +32,153 @@ const (
 	// this deployment config may be active on a node before the system actively
 	// tries to terminate them
 	dcActiveDeadlineSeconds = "DeploymentConfig.Spec.Strategy.activeDeadlineSeconds"
+
+	// lastAppliedConfigAnnotation holds the DeploymentConfig applied by kubectl, which kubectl would
+	// compare the Deployment to
+	lastAppliedConfigAnnotation = "kubectl.kubernetes.io/last-applied-configuration"
 )
 
-func unsupportedField(pluginName string, log logrus.FieldLogger, msgString string) {
-	// maybe only print out if log level is debug or ...
-	log.Warnf("[%s] %s %s", pluginName, msgString, "unsupported")
+// Options configures the conversion of the DeploymentConfig features Deployment lacks
+type Options struct {
+	// PreHookAsInitContainer converts the pre lifecycle hook into an init container of the Deployment
+	// instead of a Job
+	PreHookAsInitContainer bool
+	// ImageStreams and ImageStreamTags resolve the images of the ImageChange triggers
+	ImageStreams    []imageAPI.ImageStream
+	ImageStreamTags []imageAPI.ImageStreamTag
+	// ImageReference selects whether the resolved images are referenced by digest or by tag
+	ImageReference ImageReferencePolicy
+	// ImageAutomation selects the tool following the tags of the automatic ImageChange triggers, it
+	// requires the ImageReferenceTag policy
+	ImageAutomation ImageAutomation
+	// CustomStrategy selects how the Custom strategy is converted
+	CustomStrategy CustomStrategyPolicy
+	// TestMode selects how DeploymentConfigs in test mode are converted
+	TestMode TestModePolicy
+	// TestRunnerImage is the kubectl image of the test mode Job, DefaultTestRunnerImage when empty
+	TestRunnerImage string
+	// ReplicationControllers holds the revisions of the DeploymentConfig, the active revision pod
+	// template and the revision history are carried into the Deployment
+	ReplicationControllers []core.ReplicationController
+	// PodTemplate configures the OpenShift specific content removed from or rewritten in the pod template
+	PodTemplate podtemplate.Options
 }
 
-func annotateUnsupported(pluginName string, src deployAPI.Deployment) map[string]string {
+// DefaultOptions returns the Options converting every lifecycle hook into a Job, pinning the images
+// of the ImageChange triggers by digest, converting the Custom strategy into RollingUpdate and removing
+// the OpenShift specific content of the pod template
+func DefaultOptions() Options {
+	return Options{
+		ImageReference: ImageReferenceDigest,
+		CustomStrategy: CustomStrategyRollingUpdate,
+		PodTemplate:    podtemplate.DefaultOptions(),
+	}
+}
 
-	annotations := src.GetAnnotations()
+// MutatorOutput contains the mutated output structures
+type MutatorOutput struct {
+	Deployment deployAPI.Deployment
+	// Jobs holds the Jobs running the lifecycle hooks, annotated with the rollout phase of their hook
+	Jobs []batch.Job
+	// TestRunner runs the test rollout of test mode DeploymentConfigs with the TestModeJob policy
+	TestRunner *TestRunner
+	Report     mutator.Report
+}
 
-	if annotations == nil {
-		annotations = make(map[string]string)
+// Mutator contains common atttributes and the mutation input source structure
+type Mutator struct {
+	name    string
+	log     logrus.FieldLogger
+	input   dcAPI.DeploymentConfig
+	options Options
+	report  mutator.Report
+	// images resolved from the ImageChange triggers by container name
+	images    map[string]string
+	sanitizer *podtemplate.Sanitizer
+}
+
+// NewMutator creates a new Mutator. Clients of this API should set a meaningful name that can be used
+// to easily identify the calling client, and can start from DefaultOptions.
+// The DeploymentConfig is copied, the caller can reuse it once the Mutator is created.
+func NewMutator(name string, log logrus.FieldLogger, dc dcAPI.DeploymentConfig, options Options) Mutator {
+	return Mutator{
+		name:      name,
+		log:       log,
+		input:     *dc.DeepCopy(),
+		options:   options,
+		sanitizer: podtemplate.NewSanitizer(name, log, options.PodTemplate),
 	}
+}
 
-	annotations[pluginName+"/"+dcTest] = "unsupported"
-	annotations[pluginName+"/"+dcTriggers] = "unsupported"
-	annotations[pluginName+"/"+dcActiveDeadlineSeconds] = "unsupported"
+// Mutate converts a DeploymentConfig into Deployment
+func (m *Mutator) Mutate() (*MutatorOutput, error) {
+	m.report = mutator.Report{}
+	m.images = map[string]string{}
 
-	return annotations
+	triggers, err := m.resolveImages()
+	if err != nil {
+		return nil, err
+	}
+
+	deploy, err := m.buildDeployment(triggers)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.applyRevisions(&deploy); err != nil {
+		return nil, err
+	}
+
+	m.applyImages(&deploy, triggers)
+
+	var selector map[string]string
+	if deploy.Spec.Selector != nil {
+		selector = deploy.Spec.Selector.MatchLabels
+	}
+
+	// the hooks run the containers of the rolled out template, with the settings the sanitizer removes
+	hookTemplate := *deploy.Spec.Template.DeepCopy()
+
+	m.report.Append(m.sanitizer.Sanitize("spec.template", &deploy.Spec.Template, selector))
+
+	testRunner := m.buildTestRunner(&deploy)
+
+	jobs, err := m.buildHooks(&deploy, hookTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := validateDeployment(deploy); err != nil {
+		return nil, err
+	}
+
+	return &MutatorOutput{
+		Deployment: deploy,
+		Jobs:       jobs,
+		TestRunner: testRunner,
+		Report:     m.report,
+	}, nil
 }
 
-// Mutate converts a deploymentconfig to deployment
+// Mutate converts a deploymentconfig to deployment. It is kept for existing callers, new code should
+// use NewMutator.
 func Mutate(pluginName string, log logrus.FieldLogger, dc dcAPI.DeploymentConfig) (deployAPI.Deployment, error) {
+	m := NewMutator(pluginName, log, dc, DefaultOptions())
+
+	deploy, err := m.buildDeployment(nil)
+	if err != nil {
+		return deployAPI.Deployment{}, err
+	}
+
+	if err := validateDeployment(deploy); err != nil {
+		return deployAPI.Deployment{}, err
+	}
+
+	return deploy, nil
+}
+
+func (m *Mutator) buildDeployment(triggers []imageTrigger) (deployAPI.Deployment, error) {
+	dc := m.input
 
 	deploy := deployAPI.Deployment{}
 
@@ -55,68 +187,180 @@ func Mutate(pluginName string, log logrus.FieldLogger, dc dcAPI.DeploymentConfig
 	deploy.APIVersion = "apps/v1"
 	deploy.Name = dc.Name
 	deploy.Namespace = dc.Namespace
-	deploy.Labels = dc.Labels
-	deploy.Annotations = annotateUnsupported(pluginName, deploy)
+	deploy.Labels = copyStringMap(dc.Labels)
+	deploy.Annotations = copyStringMap(dc.Annotations)
+	delete(deploy.Annotations, lastAppliedConfigAnnotation)
+	deploy.Annotations = m.annotateUnsupported(deploy, triggers)
+
+	// the owners are recreated with new UIDs, the Deployment would be garbage collected
+	if len(dc.OwnerReferences) > 0 {
+		m.report.Dropped("metadata.ownerReferences", mutator.SeverityInfo, dc.OwnerReferences,
+			"owner references hold the UIDs of the source cluster objects")
+	}
 	//End of MetaData Section
 
 	//Spec section start
-	deploy.Spec.Replicas = &dc.Spec.Replicas
-	deploy.Spec.RevisionHistoryLimit = dc.Spec.RevisionHistoryLimit
+	replicas := dc.Spec.Replicas
+	deploy.Spec.Replicas = &replicas
+	if dc.Spec.RevisionHistoryLimit != nil {
+		revisionHistoryLimit := *dc.Spec.RevisionHistoryLimit
+		deploy.Spec.RevisionHistoryLimit = &revisionHistoryLimit
+	}
 	deploy.Spec.Paused = dc.Spec.Paused
 	deploy.Spec.MinReadySeconds = dc.Spec.MinReadySeconds
-	if dc.Spec.Selector != nil {
-		deploy.Spec.Selector = new(v1.LabelSelector)
+	if err := m.buildStrategy(&deploy); err != nil {
+		return deployAPI.Deployment{}, err
+	}
 
-		deploy.Spec.Selector.MatchLabels = make(map[string]string)
+	if dc.Spec.Template != nil {
+		dc.Spec.Template.DeepCopyInto(&deploy.Spec.Template)
+	}
 
-		for index, element := range dc.Spec.Selector {
-			deploy.Spec.Selector.MatchLabels[index] = element
-		}
+	// OpenShift defaults an empty DeploymentConfig selector to the template labels, Deployment requires it
+	if len(dc.Spec.Selector) > 0 {
+		deploy.Spec.Selector = &v1.LabelSelector{MatchLabels: copyStringMap(dc.Spec.Selector)}
+	} else if len(deploy.Spec.Template.Labels) > 0 {
+		deploy.Spec.Selector = &v1.LabelSelector{MatchLabels: copyStringMap(deploy.Spec.Template.Labels)}
+		m.report.Defaulted("spec.selector", mutator.SeverityWarning, dc.Spec.Selector,
+			"selector is derived from the template labels, the Deployment selector is immutable so changing "+
+				"these labels later requires recreating the Deployment")
 	}
-	log.Debugf("[%s] Strategy: %#v", pluginName, dc.Spec.Strategy)
-
-	// openshift supoorts Strategy.Type={"Recreate","Custom","Rolling"}
-	// K8s native supports k8s.Strategy.Type={"Recreate","RollingUpdate"}
-	// Custom strategy.type is not supported in K8s native, hence defaulting it to RollingUpdate
-	// In case the Strategy.type from Openshift is Recreate then a default value gets assigned.
-	if dc.Spec.Strategy.Type != "" {
-		if dc.Spec.Strategy.Type == "Rolling" || dc.Spec.Strategy.Type == "Custom" {
-			deploy.Spec.Strategy.Type = deployAPI.DeploymentStrategyType("RollingUpdate")
-		} else {
-			deploy.Spec.Strategy.Type = deployAPI.DeploymentStrategyType(dc.Spec.Strategy.Type)
+	// End of Spec Section
+
+	//Return
+	return deploy, nil
+
+}
+
+func copyStringMap(in map[string]string) map[string]string {
+	if in == nil {
+		return nil
+	}
+
+	out := make(map[string]string, len(in))
+	for key, value := range in {
+		out[key] = value
+	}
+
+	return out
+}
+
+// annotateUnsupported marks the DeploymentConfig fields that are set but have no Deployment equivalent.
+// The annotation value is the JSON encoded original value so the information travels with the Deployment.
+// The ImageChange triggers resolved into an image are reported as approximated instead.
+func (m *Mutator) annotateUnsupported(deploy deployAPI.Deployment, triggers []imageTrigger) map[string]string {
+	dc := m.input
+
+	annotations := deploy.GetAnnotations()
+
+	if annotations == nil {
+		annotations = make(map[string]string)
+	}
+
+	annotateUnsupportedField := func(field, path string, severity mutator.Severity, original interface{}, message string) {
+		value, err := json.Marshal(original)
+		if err != nil {
+			m.log.Errorf("[%s] cannot encode %s: %v", m.name, path, err)
+			return
 		}
 
+		annotations[m.name+"/"+field] = string(value)
+		m.report.Dropped(path, severity, original, message)
 	}
-	//Rollingupdate.MaxSurge and Rollingupdate.MaxUnavailable supported only when Strategy type is "RollingUpdate"
-	//If openshift Strategy.type is Custom Rollingupdate.MaxSurge and Rollingupdate.MaxUnavailable is not applicable.
-	if deploy.Spec.Strategy.Type == "RollingUpdate" && dc.Spec.Strategy.Type != "Custom" {
-		deploy.Spec.Strategy.RollingUpdate = new(deployAPI.RollingUpdateDeployment)
-		deploy.Spec.Strategy.RollingUpdate.MaxSurge = dc.Spec.Strategy.RollingParams.MaxSurge
-		deploy.Spec.Strategy.RollingUpdate.MaxUnavailable = dc.Spec.Strategy.RollingParams.MaxUnavailable
+
+	resolved := map[string]imageTrigger{}
+	for _, trigger := range triggers {
+		if trigger.image != "" {
+			resolved[trigger.path] = trigger
+		}
 	}
-	deploy.Spec.RevisionHistoryLimit = dc.Spec.RevisionHistoryLimit
 
-	if dc.Spec.Template != nil {
-		dc.Spec.Template.DeepCopyInto(&deploy.Spec.Template)
+	// ConfigChange triggers are what a Deployment does natively, only ImageChange triggers are lost
+	imageChangeTriggers := dcAPI.DeploymentTriggerPolicies{}
+	for i, trigger := range dc.Spec.Triggers {
+		if trigger.Type != dcAPI.DeploymentTriggerOnImageChange {
+			continue
+		}
+
+		path := fmt.Sprintf("spec.triggers[%d].imageChangeParams", i)
+		imageTrigger, found := resolved[path]
+
+		switch {
+		case !found:
+			imageChangeTriggers = append(imageChangeTriggers, trigger)
+		case m.automated(imageTrigger):
+			m.report.Approximated(path, mutator.SeverityInfo, trigger.ImageChangeParams,
+				"Keel polls the image tag "+imageTrigger.tag+" and rolls out its new images")
+		case trigger.ImageChangeParams.Automatic:
+			m.report.Approximated(path, mutator.SeverityWarning, trigger.ImageChangeParams,
+				"image is resolved to "+imageTrigger.image+", new images are only rolled out when the Deployment is updated")
+		}
 	}
-	// End of Spec Section
 
-	//Logging the unsupported fields start
-	// dc.Triggers
-	if dc.Spec.Triggers != nil {
-		unsupportedField(pluginName, log, dcTriggers)
+	if len(imageChangeTriggers) > 0 {
+		annotateUnsupportedField(dcTriggers, "spec.triggers", mutator.SeverityWarning, imageChangeTriggers,
+			"Deployment has no image change triggers, new images are only rolled out when the Deployment is updated")
 	}
-	//dc.Test
-	if dc.Spec.Test == true {
-		unsupportedField(pluginName, log, dcTest)
+
+	if dc.Spec.Test && m.options.TestMode != TestModeJob {
+		annotateUnsupportedField(dcTest, "spec.test", mutator.SeverityHigh, dc.Spec.Test,
+			"Deployment has no test mode, its replicas are kept running")
 	}
-	//dc.Spec.Strategy.ActiveDeadlineSeconds
+
 	if dc.Spec.Strategy.ActiveDeadlineSeconds != nil {
-		unsupportedField(pluginName, log, dcActiveDeadlineSeconds)
+		annotateUnsupportedField(dcActiveDeadlineSeconds, "spec.strategy.activeDeadlineSeconds", mutator.SeverityInfo, *dc.Spec.Strategy.ActiveDeadlineSeconds,
+			"Deployment has no deployer pod to apply a deadline to")
 	}
-	//End of unsupported fileds
 
-	//Return
-	return deploy, nil
+	return annotations
+}
+
+// GroupVersionKind is the kind of the source objects converted by this package
+var GroupVersionKind = dcAPI.GroupVersion.WithKind("DeploymentConfig")
+
+// ObjectMutator adapts this package to the mutator.Mutator interface
+type ObjectMutator struct {
+	name    string
+	log     logrus.FieldLogger
+	options Options
+}
+
+// NewObjectMutator creates a mutator.Mutator converting DeploymentConfig objects.
+// Clients of this API should set a meaningful name that can be used to easily identify the calling client.
+func NewObjectMutator(name string, log logrus.FieldLogger, options Options) *ObjectMutator {
+	return &ObjectMutator{
+		name:    name,
+		log:     log,
+		options: options,
+	}
+}
+
+// Mutate converts a DeploymentConfig object into a Deployment object, the Job objects running its
+// lifecycle hooks and the test runner objects
+func (o *ObjectMutator) Mutate(obj runtime.Object) (*mutator.Result, error) {
+	dc := dcAPI.DeploymentConfig{}
+	if err := mutator.Convert(obj, &dc); err != nil {
+		return nil, err
+	}
+
+	m := NewMutator(o.name, o.log, dc, o.options)
+	output, err := m.Mutate()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &mutator.Result{
+		Objects: []runtime.Object{&output.Deployment},
+		Report:  output.Report,
+	}
+
+	for i := range output.Jobs {
+		result.Objects = append(result.Objects, &output.Jobs[i])
+	}
+
+	if runner := output.TestRunner; runner != nil {
+		result.Objects = append(result.Objects, &runner.ServiceAccount, &runner.Role, &runner.RoleBinding, &runner.Job)
+	}
 
+	return result, nil
 }
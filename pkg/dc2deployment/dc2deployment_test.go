@@ -6,9 +6,15 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	"github.com/brito-rafa/k8s-mutators/pkg/podtemplate"
 	apps "github.com/openshift/api/apps/v1"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
+	deployAPI "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 func TestDeployment(t *testing.T) {
@@ -77,6 +83,141 @@ func TestDeployment(t *testing.T) {
 	}
 }
 
+func TestObjectMutator(t *testing.T) {
+	dcFile, err := ioutil.ReadFile(filepath.Join("testdata", "example_with_Rolling.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal(dcFile, &obj.Object); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mutator.NewRegistry()
+	assert.NoError(t, r.Register(GroupVersionKind, NewObjectMutator("testClient", logrus.New(), DefaultOptions())))
+
+	result, err := r.Mutate(obj)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result.Objects))
+
+	deploy := result.Objects[0].(*deployAPI.Deployment)
+	assert.Equal(t, "docker-registry", deploy.Name)
+	assert.Equal(t, deployAPI.RollingUpdateDeploymentStrategyType, deploy.Spec.Strategy.Type)
+}
+
+func TestMutateReport(t *testing.T) {
+	dc := newMutatorFromFileData(t, "example_with_Custom.json", t.Name())
+	dc.Spec.Test = true
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	entries := output.Report.ByPath()
+
+	assert.Equal(t, mutator.ActionApproximated, entries["spec.strategy.type"].Action)
+	assert.Equal(t, mutator.SeverityHigh, entries["spec.test"].Severity)
+	assert.Equal(t, *dc.Spec.Strategy.ActiveDeadlineSeconds, entries["spec.strategy.activeDeadlineSeconds"].Original)
+
+	// the example only has a ConfigChange trigger which Deployment supports natively
+	assert.NotContains(t, entries, "spec.triggers")
+}
+
+func TestAnnotateUnsupportedOnlySetFields(t *testing.T) {
+	dc := apps.DeploymentConfig{}
+	dc.Spec.Selector = map[string]string{"app": "app"}
+	dc.Spec.Template = &core.PodTemplateSpec{}
+	dc.Spec.Template.Labels = map[string]string{"app": "app"}
+	dc.Spec.Template.Spec.Containers = []core.Container{{Name: "app", Image: "app"}}
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(output.Deployment.Annotations))
+	assert.Equal(t, 0, len(output.Report.Entries))
+
+	imageChange := apps.DeploymentTriggerPolicy{
+		Type: apps.DeploymentTriggerOnImageChange,
+		ImageChangeParams: &apps.DeploymentTriggerImageChangeParams{
+			ContainerNames: []string{"app"},
+		},
+	}
+	dc.Spec.Triggers = apps.DeploymentTriggerPolicies{{Type: apps.DeploymentTriggerOnConfigChange}, imageChange}
+	dc.Spec.Test = true
+
+	m = NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err = m.Mutate()
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(output.Deployment.Annotations))
+	assert.Equal(t, "true", output.Deployment.Annotations["testClient/"+dcTest])
+
+	triggers := apps.DeploymentTriggerPolicies{}
+	assert.NoError(t, json.Unmarshal([]byte(output.Deployment.Annotations["testClient/"+dcTriggers]), &triggers))
+	assert.Equal(t, apps.DeploymentTriggerPolicies{imageChange}, triggers)
+}
+
+func TestMutateMetadata(t *testing.T) {
+	dc := newMutatorFromFileData(t, "example_with_Rolling.json", t.Name())
+	dc.Annotations = map[string]string{
+		"openshift.io/generated-by":                        "OpenShiftNewApp",
+		"kubectl.kubernetes.io/last-applied-configuration": "{}",
+	}
+	dc.OwnerReferences = []v1.OwnerReference{{APIVersion: "v1", Kind: "ConfigMap", Name: "owner", UID: "1234"}}
+	dc.Spec.Test = true
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	deploy := output.Deployment
+	assert.Equal(t, "OpenShiftNewApp", deploy.Annotations["openshift.io/generated-by"])
+	assert.Equal(t, "true", deploy.Annotations["testClient/"+dcTest])
+	assert.NotContains(t, deploy.Annotations, "kubectl.kubernetes.io/last-applied-configuration")
+	assert.Nil(t, deploy.OwnerReferences)
+	assert.Equal(t, mutator.ActionDropped, output.Report.ByPath()["metadata.ownerReferences"].Action)
+
+	assert.Equal(t, 2, len(dc.Annotations))
+}
+
+func TestMutateNoAliasing(t *testing.T) {
+	dc := newMutatorFromFileData(t, "example_with_Rolling.json", t.Name())
+	original := *dc.DeepCopy()
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+
+	// the input is reused by the caller once the Mutator is created
+	dc.Labels["docker-registry"] = "changed"
+	dc.Spec.Replicas = 5
+
+	first, err := m.Mutate()
+	assert.NoError(t, err)
+	assert.Equal(t, "default", first.Deployment.Labels["docker-registry"])
+	assert.Equal(t, original.Spec.Replicas, *first.Deployment.Spec.Replicas)
+
+	second, err := m.Mutate()
+	assert.NoError(t, err)
+
+	deploy := first.Deployment
+	deploy.Labels["docker-registry"] = "output"
+	*deploy.Spec.Replicas = 7
+	*deploy.Spec.RevisionHistoryLimit = 1
+	deploy.Spec.Selector.MatchLabels["docker-registry"] = "output"
+	deploy.Spec.Template.Labels["docker-registry"] = "output"
+	deploy.Spec.Template.Spec.Containers[0].Env[0].Value = "output"
+	deploy.Spec.Strategy.RollingUpdate.MaxSurge.StrVal = "100%"
+
+	assert.Equal(t, original.Spec, m.input.Spec)
+	assert.Equal(t, original.Labels, m.input.Labels)
+	assert.Equal(t, "default", second.Deployment.Labels["docker-registry"])
+	assert.Equal(t, original.Spec.Replicas, *second.Deployment.Spec.Replicas)
+	assert.Equal(t, "default", second.Deployment.Spec.Selector.MatchLabels["docker-registry"])
+	assert.Equal(t, "25%", second.Deployment.Spec.Strategy.RollingUpdate.MaxSurge.StrVal)
+}
+
 func newMutatorFromFileData(t *testing.T, fileName, testName string) apps.DeploymentConfig {
 	dcConfigFilePath := filepath.Join("testdata", fileName)
 	dc2File, err := ioutil.ReadFile(dcConfigFilePath)
@@ -92,3 +233,47 @@ func newMutatorFromFileData(t *testing.T, fileName, testName string) apps.Deploy
 
 	return dc
 }
+
+func TestMutatePodTemplate(t *testing.T) {
+	dc := newHookedDeploymentConfig(t)
+	dc.Spec.Template.Labels["deployment"] = "docker-registry-2"
+	dc.Spec.Template.Spec.Containers[0].Image = "image-registry.openshift-image-registry.svc:5000/default/registry:2"
+	dc.Spec.Template.Spec.ImagePullSecrets = []core.LocalObjectReference{{Name: "registry-dockercfg-7xk2p"}}
+
+	options := DefaultOptions()
+	options.PodTemplate.Registries = []podtemplate.RegistryRule{
+		{From: "image-registry.openshift-image-registry.svc:5000", To: "quay.io/mirror"},
+	}
+
+	m := NewMutator("testClient", logrus.New(), dc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	template := output.Deployment.Spec.Template
+	assert.NotContains(t, template.Labels, "deployment")
+	assert.Equal(t, "quay.io/mirror/default/registry:2", template.Spec.Containers[0].Image)
+	assert.Nil(t, template.Spec.ImagePullSecrets)
+
+	// the hooks run the sanitized image and pull secrets
+	pod := output.Jobs[0].Spec.Template.Spec
+	assert.Equal(t, "quay.io/mirror/default/registry:2", pod.Containers[0].Image)
+	assert.Nil(t, pod.ImagePullSecrets)
+
+	entries := output.Report.ByPath()
+	assert.Equal(t, "docker-registry-2", entries["spec.template.metadata.labels.deployment"].Original)
+	assert.Equal(t, "registry-dockercfg-7xk2p", entries["spec.template.spec.imagePullSecrets"].Original)
+	assert.Equal(t, mutator.SeverityInfo, entries["spec.strategy.recreateParams.pre.execNewPod.containerName"].Severity)
+
+	// the hook images left in the internal registry are reported as well
+	m = NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+
+	entries = output.Report.ByPath()
+	for _, hook := range []string{HookPre, HookMid, HookPost} {
+		entry := entries["spec.strategy.recreateParams."+hook+".execNewPod.containerName"]
+		assert.Equal(t, mutator.SeverityHigh, entry.Severity, hook)
+		assert.Equal(t, mutator.ActionDropped, entry.Action, hook)
+		assert.Equal(t, dc.Spec.Template.Spec.Containers[0].Image, entry.Original, hook)
+	}
+}
@@ -0,0 +1,244 @@
+package dc2deployment
+
+import (
+	"fmt"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	dcAPI "github.com/openshift/api/apps/v1"
+	deployAPI "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+)
+
+// HookAnnotation is set on the hook Jobs, prefixed with the client name, with the rollout phase the
+// DeploymentConfig ran the hook at
+const HookAnnotation = "lifecycle-hook"
+
+// DeploymentConfig lifecycle hooks, the hook Jobs are annotated with <hook>-rollout
+const (
+	HookPre  = "pre"
+	HookMid  = "mid"
+	HookPost = "post"
+)
+
+// hookInitContainerName names the init container a pre hook is converted into
+const hookInitContainerName = "pre-hook"
+
+// LifecycleHook is a hook of the DeploymentConfig strategy with its JSON path
+type LifecycleHook struct {
+	Path string
+	Name string
+	Hook *dcAPI.LifecycleHook
+}
+
+// LifecycleHooks lists the hooks set in the strategy parameters used by the DeploymentConfig strategy
+// type, the deployer ignores the parameters of the other strategy types
+func LifecycleHooks(strategy dcAPI.DeploymentStrategy) []LifecycleHook {
+	hooks := []LifecycleHook{}
+
+	switch {
+	case strategy.Type == dcAPI.DeploymentStrategyTypeRecreate && strategy.RecreateParams != nil:
+		params := strategy.RecreateParams
+		hooks = append(hooks,
+			LifecycleHook{"spec.strategy.recreateParams.pre", HookPre, params.Pre},
+			LifecycleHook{"spec.strategy.recreateParams.mid", HookMid, params.Mid},
+			LifecycleHook{"spec.strategy.recreateParams.post", HookPost, params.Post})
+	case strategy.Type == dcAPI.DeploymentStrategyTypeRolling && strategy.RollingParams != nil:
+		params := strategy.RollingParams
+		hooks = append(hooks,
+			LifecycleHook{"spec.strategy.rollingParams.pre", HookPre, params.Pre},
+			LifecycleHook{"spec.strategy.rollingParams.post", HookPost, params.Post})
+	}
+
+	result := []LifecycleHook{}
+	for _, hook := range hooks {
+		if hook.Hook != nil {
+			result = append(result, hook)
+		}
+	}
+
+	return result
+}
+
+// buildHooks converts the ExecNewPod lifecycle hooks into Jobs, or the pre hook into an init container of
+// the Deployment when PreHookAsInitContainer is set. The hooks are based on the given pod template, the
+// Deployment one before it is sanitized. TagImages hooks have no equivalent.
+func (m *Mutator) buildHooks(deploy *deployAPI.Deployment, template core.PodTemplateSpec) ([]batch.Job, error) {
+	jobs := []batch.Job{}
+
+	for _, hook := range LifecycleHooks(m.input.Spec.Strategy) {
+		if len(hook.Hook.TagImages) > 0 {
+			m.report.Dropped(hook.Path+".tagImages", mutator.SeverityHigh, hook.Hook.TagImages,
+				"Deployment has no image streams to tag the rolled out images onto")
+		}
+
+		if hook.Hook.ExecNewPod == nil {
+			continue
+		}
+
+		container, volumes, err := m.buildHookContainer(hook, template)
+		if err != nil {
+			return nil, err
+		}
+
+		if hook.Name == HookPre && m.options.PreHookAsInitContainer {
+			container.Name = hookInitContainerName
+			deploy.Spec.Template.Spec.InitContainers = append([]core.Container{container}, deploy.Spec.Template.Spec.InitContainers...)
+
+			m.report.Approximated(hook.Path, mutator.SeverityWarning, hook.Hook.ExecNewPod,
+				"pre hook is run by an init container, at every pod start instead of once per rollout")
+			continue
+		}
+
+		job := m.buildHookJob(hook, template, container, volumes, deploy.Spec.Template.Spec.ImagePullSecrets)
+		jobs = append(jobs, job)
+
+		message := fmt.Sprintf("%s hook is run by the Job %s, once when it is applied instead of at every rollout", hook.Name, job.Name)
+		severity := mutator.SeverityWarning
+		if hook.Name == HookMid {
+			message += ", and not while the Deployment is scaled down"
+			severity = mutator.SeverityHigh
+		}
+
+		m.report.Approximated(hook.Path, severity, hook.Hook.ExecNewPod, message)
+
+		if hook.Hook.FailurePolicy == dcAPI.LifecycleHookFailurePolicyAbort {
+			m.report.Approximated(hook.Path+".failurePolicy", mutator.SeverityWarning, hook.Hook.FailurePolicy,
+				"a failed Job does not abort nor roll back the rollout")
+		}
+	}
+
+	m.log.Debugf("[%s] mutated hook jobs = %#v", m.name, jobs)
+
+	return jobs, nil
+}
+
+// buildHookContainer returns the hook container, based on the named container of the pod template, and the
+// template volumes it mounts
+func (m *Mutator) buildHookContainer(hook LifecycleHook, template core.PodTemplateSpec) (core.Container, []core.Volume, error) {
+	execNewPod := hook.Hook.ExecNewPod
+
+	var base *core.Container
+	for i := range template.Spec.Containers {
+		if template.Spec.Containers[i].Name == execNewPod.ContainerName {
+			base = &template.Spec.Containers[i]
+		}
+	}
+
+	if base == nil {
+		return core.Container{}, nil, fmt.Errorf("%s: container %q is not in the pod template", hook.Path, execNewPod.ContainerName)
+	}
+
+	base = base.DeepCopy()
+
+	image := base.Image
+	if resolved, found := m.images[base.Name]; found {
+		image = resolved
+	}
+
+	container := core.Container{
+		Name:            base.Name,
+		Image:           image,
+		ImagePullPolicy: base.ImagePullPolicy,
+		Command:         append([]string{}, execNewPod.Command...),
+		WorkingDir:      base.WorkingDir,
+		EnvFrom:         base.EnvFrom,
+		Resources:       base.Resources,
+		SecurityContext: base.SecurityContext,
+	}
+
+	m.report.Append(m.sanitizer.SanitizeImage(hook.Path+".execNewPod.containerName", &container))
+
+	// the deployer resources apply to the hook pods
+	strategyResources := m.input.Spec.Strategy.Resources
+	if len(strategyResources.Limits) > 0 || len(strategyResources.Requests) > 0 {
+		container.Resources = *strategyResources.DeepCopy()
+	}
+
+	// the hook variables override the container ones
+	overridden := map[string]bool{}
+	for _, env := range execNewPod.Env {
+		overridden[env.Name] = true
+	}
+
+	for _, env := range base.Env {
+		if !overridden[env.Name] {
+			container.Env = append(container.Env, env)
+		}
+	}
+
+	for _, env := range execNewPod.Env {
+		container.Env = append(container.Env, *env.DeepCopy())
+	}
+
+	templateVolumes := map[string]core.Volume{}
+	for _, volume := range template.Spec.Volumes {
+		templateVolumes[volume.Name] = volume
+	}
+
+	volumes := []core.Volume{}
+	copied := map[string]bool{}
+
+	for _, name := range execNewPod.Volumes {
+		volume, found := templateVolumes[name]
+		if !found {
+			m.report.Dropped(hook.Path+".execNewPod.volumes", mutator.SeverityInfo, name,
+				"volume "+name+" is not in the pod template, the DeploymentConfig ignores it as well")
+			continue
+		}
+
+		volumes = append(volumes, *volume.DeepCopy())
+		copied[name] = true
+	}
+
+	for _, mount := range base.VolumeMounts {
+		if copied[mount.Name] {
+			container.VolumeMounts = append(container.VolumeMounts, mount)
+		}
+	}
+
+	return container, volumes, nil
+}
+
+// buildHookJob creates the Job running the hook container with the pod settings of the pod template, the
+// pull secrets of the Deployment template and the labels and annotations of the DeploymentConfig strategy
+func (m *Mutator) buildHookJob(hook LifecycleHook, template core.PodTemplateSpec, container core.Container, volumes []core.Volume,
+	pullSecrets []core.LocalObjectReference) batch.Job {
+	dc := m.input
+	podSpec := template.Spec.DeepCopy()
+
+	job := batch.Job{}
+	job.Kind = "Job"
+	job.APIVersion = "batch/v1"
+	job.Name = dc.Name + "-" + hook.Name + "-hook"
+	job.Namespace = dc.Namespace
+	job.Annotations = map[string]string{m.name + "/" + HookAnnotation: hook.Name + "-rollout"}
+
+	job.Labels = copyStringMap(dc.Labels)
+
+	// the DeploymentConfig does not retry a hook pod unless asked to
+	if hook.Hook.FailurePolicy != dcAPI.LifecycleHookFailurePolicyRetry {
+		backoffLimit := int32(0)
+		job.Spec.BackoffLimit = &backoffLimit
+	}
+
+	if dc.Spec.Strategy.ActiveDeadlineSeconds != nil {
+		activeDeadlineSeconds := *dc.Spec.Strategy.ActiveDeadlineSeconds
+		job.Spec.ActiveDeadlineSeconds = &activeDeadlineSeconds
+	}
+
+	strategy := dc.Spec.Strategy.DeepCopy()
+	job.Spec.Template.Labels = strategy.Labels
+	job.Spec.Template.Annotations = strategy.Annotations
+
+	pod := &job.Spec.Template.Spec
+	pod.RestartPolicy = core.RestartPolicyNever
+	pod.Containers = []core.Container{container}
+	pod.Volumes = volumes
+	pod.ServiceAccountName = podSpec.ServiceAccountName
+	pod.SecurityContext = podSpec.SecurityContext
+	pod.NodeSelector = podSpec.NodeSelector
+	pod.ImagePullSecrets = append([]core.LocalObjectReference(nil), pullSecrets...)
+
+	return job
+}
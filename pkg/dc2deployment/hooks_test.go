@@ -0,0 +1,156 @@
+package dc2deployment
+
+import (
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	apps "github.com/openshift/api/apps/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+)
+
+func newHookedDeploymentConfig(t *testing.T) apps.DeploymentConfig {
+	dc := newMutatorFromFileData(t, "example_with_Recreate.json", t.Name())
+
+	dc.Spec.Strategy.RecreateParams = &apps.RecreateDeploymentStrategyParams{
+		Pre: &apps.LifecycleHook{
+			FailurePolicy: apps.LifecycleHookFailurePolicyAbort,
+			ExecNewPod: &apps.ExecNewPodHook{
+				ContainerName: "registry",
+				Command:       []string{"/bin/migrate", "--up"},
+				Env:           []core.EnvVar{{Name: "REGISTRY_HTTP_NET", Value: "udp"}, {Name: "MIGRATE", Value: "true"}},
+				Volumes:       []string{"registry-storage", "missing"},
+			},
+		},
+		Mid: &apps.LifecycleHook{
+			FailurePolicy: apps.LifecycleHookFailurePolicyIgnore,
+			ExecNewPod:    &apps.ExecNewPodHook{ContainerName: "registry", Command: []string{"/bin/cleanup"}},
+		},
+		Post: &apps.LifecycleHook{
+			FailurePolicy: apps.LifecycleHookFailurePolicyRetry,
+			ExecNewPod:    &apps.ExecNewPodHook{ContainerName: "registry", Command: []string{"/bin/notify"}},
+			TagImages:     []apps.TagImageHook{{ContainerName: "registry", To: core.ObjectReference{Kind: "ImageStreamTag", Name: "registry:prod"}}},
+		},
+	}
+
+	return dc
+}
+
+func TestMutateHooks(t *testing.T) {
+	dc := newHookedDeploymentConfig(t)
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, len(output.Jobs))
+
+	pre := output.Jobs[0]
+	assert.Equal(t, "docker-registry-pre-hook", pre.Name)
+	assert.Equal(t, "default", pre.Namespace)
+	assert.Equal(t, "pre-rollout", pre.Annotations["testClient/"+HookAnnotation])
+	assert.Equal(t, int32(0), *pre.Spec.BackoffLimit)
+	assert.Equal(t, int64(21600), *pre.Spec.ActiveDeadlineSeconds)
+
+	pod := pre.Spec.Template.Spec
+	assert.Equal(t, core.RestartPolicyNever, pod.RestartPolicy)
+	assert.Equal(t, "registry", pod.ServiceAccountName)
+	assert.Equal(t, 1, len(pod.Volumes))
+	assert.Equal(t, "registry-storage", pod.Volumes[0].Name)
+
+	container := pod.Containers[0]
+	assert.Equal(t, dc.Spec.Template.Spec.Containers[0].Image, container.Image)
+	assert.Equal(t, []string{"/bin/migrate", "--up"}, container.Command)
+	assert.Equal(t, []core.VolumeMount{{Name: "registry-storage", MountPath: "/registry"}}, container.VolumeMounts)
+	assert.Nil(t, container.LivenessProbe)
+
+	env := map[string]string{}
+	for _, variable := range container.Env {
+		env[variable.Name] = variable.Value
+	}
+	assert.Equal(t, "udp", env["REGISTRY_HTTP_NET"])
+	assert.Equal(t, "true", env["MIGRATE"])
+	assert.Equal(t, ":5000", env["REGISTRY_HTTP_ADDR"])
+
+	assert.Equal(t, "mid-rollout", output.Jobs[1].Annotations["testClient/"+HookAnnotation])
+	assert.Equal(t, "post-rollout", output.Jobs[2].Annotations["testClient/"+HookAnnotation])
+	assert.Nil(t, output.Jobs[2].Spec.BackoffLimit)
+
+	entries := output.Report.ByPath()
+
+	assert.Equal(t, mutator.SeverityWarning, entries["spec.strategy.recreateParams.pre"].Severity)
+	assert.Equal(t, mutator.SeverityHigh, entries["spec.strategy.recreateParams.mid"].Severity)
+	assert.Equal(t, mutator.ActionDropped, entries["spec.strategy.recreateParams.post.tagImages"].Action)
+	assert.Equal(t, "missing", entries["spec.strategy.recreateParams.pre.execNewPod.volumes"].Original)
+	assert.Equal(t, apps.LifecycleHookFailurePolicyAbort, entries["spec.strategy.recreateParams.pre.failurePolicy"].Original)
+	assert.Equal(t, mutator.SeverityWarning, entries["spec.strategy.recreateParams.pre.failurePolicy"].Severity)
+	assert.NotContains(t, entries, "spec.strategy.recreateParams.mid.failurePolicy")
+
+	// the input is left untouched
+	assert.Equal(t, 0, len(dc.Spec.Template.Spec.InitContainers))
+	assert.Equal(t, 8, len(dc.Spec.Template.Spec.Containers[0].Env))
+}
+
+func TestMutatePreHookAsInitContainer(t *testing.T) {
+	dc := newHookedDeploymentConfig(t)
+
+	options := DefaultOptions()
+	options.PreHookAsInitContainer = true
+
+	m := NewMutator("testClient", logrus.New(), dc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(output.Jobs))
+	assert.Equal(t, "mid-rollout", output.Jobs[0].Annotations["testClient/"+HookAnnotation])
+
+	initContainers := output.Deployment.Spec.Template.Spec.InitContainers
+	assert.Equal(t, 1, len(initContainers))
+	assert.Equal(t, hookInitContainerName, initContainers[0].Name)
+	assert.Equal(t, []string{"/bin/migrate", "--up"}, initContainers[0].Command)
+	assert.Equal(t, 0, len(dc.Spec.Template.Spec.InitContainers))
+}
+
+func TestMutateHookUnknownContainer(t *testing.T) {
+	dc := newHookedDeploymentConfig(t)
+	dc.Spec.Strategy.RecreateParams.Pre.ExecNewPod.ContainerName = "web"
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	_, err := m.Mutate()
+	assert.Error(t, err)
+}
+
+func TestObjectMutatorHooks(t *testing.T) {
+	dc := newHookedDeploymentConfig(t)
+
+	o := NewObjectMutator("testClient", logrus.New(), DefaultOptions())
+	result, err := o.Mutate(&dc)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 4, len(result.Objects))
+	for _, obj := range result.Objects[1:] {
+		assert.IsType(t, &batch.Job{}, obj)
+	}
+}
+
+func TestLifecycleHooks(t *testing.T) {
+	hook := &apps.LifecycleHook{ExecNewPod: &apps.ExecNewPodHook{ContainerName: "registry"}}
+	strategy := apps.DeploymentStrategy{
+		Type:           apps.DeploymentStrategyTypeRolling,
+		RecreateParams: &apps.RecreateDeploymentStrategyParams{Mid: hook},
+		RollingParams:  &apps.RollingDeploymentStrategyParams{Post: hook},
+	}
+
+	assert.Equal(t, []LifecycleHook{{"spec.strategy.rollingParams.post", HookPost, hook}}, LifecycleHooks(strategy))
+
+	strategy.Type = apps.DeploymentStrategyTypeRecreate
+	assert.Equal(t, []LifecycleHook{{"spec.strategy.recreateParams.mid", HookMid, hook}}, LifecycleHooks(strategy))
+
+	// the deployer ignores the parameters of the other strategy types
+	for _, strategyType := range []apps.DeploymentStrategyType{apps.DeploymentStrategyTypeCustom, ""} {
+		strategy.Type = strategyType
+		assert.Empty(t, LifecycleHooks(strategy), strategyType)
+	}
+}
@@ -0,0 +1,208 @@
+package dc2deployment
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	dcAPI "github.com/openshift/api/apps/v1"
+	imageAPI "github.com/openshift/api/image/v1"
+	deployAPI "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+)
+
+// ImageReferencePolicy selects how the images of the ImageChange triggers are referenced
+type ImageReferencePolicy string
+
+const (
+	// ImageReferenceDigest pins the image the tag currently points to
+	ImageReferenceDigest ImageReferencePolicy = "Digest"
+	// ImageReferenceTag references the tag of the image stream repository
+	ImageReferenceTag ImageReferencePolicy = "Tag"
+)
+
+// ImageAutomation selects the tool updating the Deployment images in place of the ImageChange triggers
+type ImageAutomation string
+
+const (
+	// ImageAutomationNone leaves the images as resolved
+	ImageAutomationNone ImageAutomation = ""
+	// ImageAutomationKeel annotates the Deployment for Keel to roll out the new images of the tags
+	ImageAutomationKeel ImageAutomation = "Keel"
+)
+
+// imageTrigger is an ImageChange trigger resolved into the image of its containers
+type imageTrigger struct {
+	path       string
+	params     *dcAPI.DeploymentTriggerImageChangeParams
+	repository string
+	tag        string
+	image      string
+}
+
+// resolveImages resolves the image of every ImageChange trigger from the ImageStream and ImageStreamTag
+// options, falling back on the last triggered image. Triggers with an invalid reference are reported.
+func (m *Mutator) resolveImages() ([]imageTrigger, error) {
+	dc := m.input
+	triggers := []imageTrigger{}
+
+	if m.options.ImageAutomation != ImageAutomationNone && m.options.ImageReference != ImageReferenceTag {
+		return nil, fmt.Errorf("image automation requires the %s image reference policy", ImageReferenceTag)
+	}
+
+	for i, trigger := range dc.Spec.Triggers {
+		if trigger.Type != dcAPI.DeploymentTriggerOnImageChange || trigger.ImageChangeParams == nil {
+			continue
+		}
+
+		path := fmt.Sprintf("spec.triggers[%d].imageChangeParams", i)
+		params := trigger.ImageChangeParams
+
+		resolved, err := m.resolveImage(params.From)
+		if err != nil {
+			m.report.Dropped(path+".from", mutator.SeverityHigh, params.From,
+				fmt.Sprintf("%v, the template image is kept", err))
+			continue
+		}
+
+		resolved.path = path
+		resolved.params = params
+
+		if resolved.image == "" {
+			resolved.image = params.LastTriggeredImage
+
+			if resolved.image != "" {
+				m.report.Defaulted(path+".from", mutator.SeverityWarning, params.From,
+					"image stream tag "+params.From.Name+" is not given, the last triggered image is used")
+			} else {
+				m.report.Dropped(path+".from", mutator.SeverityHigh, params.From,
+					"image stream tag "+params.From.Name+" is not given and was never triggered, the template image is kept")
+			}
+		}
+
+		triggers = append(triggers, resolved)
+	}
+
+	m.log.Debugf("[%s] resolved images = %#v", m.name, triggers)
+
+	return triggers, nil
+}
+
+// resolveImage returns the image referenced by an ImageChange trigger, with an empty image when the
+// image stream is not known
+func (m *Mutator) resolveImage(from core.ObjectReference) (imageTrigger, error) {
+	namespace := from.Namespace
+	if namespace == "" {
+		namespace = m.input.Namespace
+	}
+
+	switch from.Kind {
+	case "DockerImage":
+		return imageTrigger{image: from.Name}, nil
+	case "ImageStreamImage":
+		parts := strings.SplitN(from.Name, "@", 2)
+		if len(parts) != 2 {
+			return imageTrigger{}, fmt.Errorf("image stream image %q is not <stream>@<digest>", from.Name)
+		}
+
+		stream := m.findImageStream(namespace, parts[0])
+		if stream == nil || stream.Status.DockerImageRepository == "" {
+			return imageTrigger{}, nil
+		}
+
+		return imageTrigger{image: stream.Status.DockerImageRepository + "@" + parts[1]}, nil
+	case "ImageStreamTag":
+		parts := strings.SplitN(from.Name, ":", 2)
+		if len(parts) != 2 {
+			return imageTrigger{}, fmt.Errorf("image stream tag %q is not <stream>:<tag>", from.Name)
+		}
+
+		resolved := imageTrigger{tag: parts[1]}
+		digest := ""
+
+		for _, streamTag := range m.options.ImageStreamTags {
+			if streamTag.Namespace == namespace && streamTag.Name == from.Name {
+				digest = streamTag.Image.DockerImageReference
+			}
+		}
+
+		if stream := m.findImageStream(namespace, parts[0]); stream != nil {
+			resolved.repository = stream.Status.DockerImageRepository
+
+			for _, tag := range stream.Status.Tags {
+				if tag.Tag == resolved.tag && len(tag.Items) > 0 && digest == "" {
+					digest = tag.Items[0].DockerImageReference
+				}
+			}
+		}
+
+		switch {
+		case m.options.ImageReference == ImageReferenceTag && resolved.repository != "":
+			resolved.image = resolved.repository + ":" + resolved.tag
+		case m.options.ImageReference != ImageReferenceTag:
+			resolved.image = digest
+		}
+
+		return resolved, nil
+	}
+
+	return imageTrigger{}, fmt.Errorf("image reference kind %q is unknown", from.Kind)
+}
+
+func (m *Mutator) findImageStream(namespace, name string) *imageAPI.ImageStream {
+	for i := range m.options.ImageStreams {
+		stream := &m.options.ImageStreams[i]
+
+		if stream.Namespace == namespace && stream.Name == name {
+			return stream
+		}
+	}
+
+	return nil
+}
+
+// applyImages sets the resolved images on the named containers of the Deployment template, and the
+// annotations of the Keel image automation
+func (m *Mutator) applyImages(deploy *deployAPI.Deployment, triggers []imageTrigger) {
+	pod := &deploy.Spec.Template.Spec
+
+	for _, trigger := range triggers {
+		if trigger.image == "" {
+			continue
+		}
+
+		for _, name := range trigger.params.ContainerNames {
+			found := false
+
+			for _, containers := range [][]core.Container{pod.InitContainers, pod.Containers} {
+				for i := range containers {
+					if containers[i].Name == name {
+						containers[i].Image = trigger.image
+						m.images[name] = trigger.image
+						found = true
+					}
+				}
+			}
+
+			if !found {
+				m.report.Dropped(trigger.path+".containerNames", mutator.SeverityInfo, name,
+					"container "+name+" is not in the pod template, the DeploymentConfig ignores it as well")
+			}
+		}
+
+		if m.automated(trigger) {
+			if deploy.Annotations == nil {
+				deploy.Annotations = map[string]string{}
+			}
+
+			deploy.Annotations["keel.sh/policy"] = "force"
+			deploy.Annotations["keel.sh/match-tag"] = "true"
+			deploy.Annotations["keel.sh/trigger"] = "poll"
+		}
+	}
+}
+
+// automated tells whether the image automation rolls out the new images of the trigger tag
+func (m *Mutator) automated(trigger imageTrigger) bool {
+	return m.options.ImageAutomation == ImageAutomationKeel && trigger.params.Automatic && trigger.tag != ""
+}
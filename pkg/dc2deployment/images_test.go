@@ -0,0 +1,148 @@
+package dc2deployment
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	apps "github.com/openshift/api/apps/v1"
+	imageAPI "github.com/openshift/api/image/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+)
+
+const (
+	registryRepository = "image-registry.openshift-image-registry.svc:5000/default/registry"
+	registryDigest     = registryRepository + "@sha256:4e2cd7e4b5d7c2b2b4a8a1fbdbf0cf6b2cf6ad2c2b0c9e1f5a3a6f2e8c1a0b9d"
+)
+
+func newImageStream() imageAPI.ImageStream {
+	stream := imageAPI.ImageStream{}
+	stream.Name = "registry"
+	stream.Namespace = "default"
+	stream.Status.DockerImageRepository = registryRepository
+	stream.Status.Tags = []imageAPI.NamedTagEventList{
+		{Tag: "v3.11", Items: []imageAPI.TagEvent{{DockerImageReference: registryDigest}}},
+	}
+
+	return stream
+}
+
+func newTriggeredDeploymentConfig(t *testing.T) apps.DeploymentConfig {
+	dc := newMutatorFromFileData(t, "example_with_Recreate.json", t.Name())
+	dc.Spec.Template.Spec.Containers[0].Image = ""
+	dc.Spec.Triggers = apps.DeploymentTriggerPolicies{
+		{Type: apps.DeploymentTriggerOnConfigChange},
+		{
+			Type: apps.DeploymentTriggerOnImageChange,
+			ImageChangeParams: &apps.DeploymentTriggerImageChangeParams{
+				Automatic:      true,
+				ContainerNames: []string{"registry", "sidecar"},
+				From:           core.ObjectReference{Kind: "ImageStreamTag", Name: "registry:v3.11"},
+			},
+		},
+	}
+
+	return dc
+}
+
+func TestMutateImageChangeTriggers(t *testing.T) {
+	dc := newTriggeredDeploymentConfig(t)
+	dc.Spec.Strategy.RecreateParams = &apps.RecreateDeploymentStrategyParams{
+		Pre: &apps.LifecycleHook{ExecNewPod: &apps.ExecNewPodHook{ContainerName: "registry", Command: []string{"/bin/migrate"}}},
+	}
+
+	options := DefaultOptions()
+	options.ImageStreams = []imageAPI.ImageStream{newImageStream()}
+
+	m := NewMutator("testClient", logrus.New(), dc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, registryDigest, output.Deployment.Spec.Template.Spec.Containers[0].Image)
+	assert.Equal(t, registryDigest, output.Jobs[0].Spec.Template.Spec.Containers[0].Image)
+	assert.Equal(t, "", dc.Spec.Template.Spec.Containers[0].Image)
+
+	entries := output.Report.ByPath()
+	assert.Equal(t, "sidecar", entries["spec.triggers[1].imageChangeParams.containerNames"].Original)
+	assert.Equal(t, mutator.ActionApproximated, entries["spec.triggers[1].imageChangeParams"].Action)
+	assert.Equal(t, mutator.SeverityWarning, entries["spec.triggers[1].imageChangeParams"].Severity)
+	assert.NotContains(t, entries, "spec.triggers")
+	assert.NotContains(t, output.Deployment.Annotations, "testClient/"+dcTriggers)
+
+	// the image stream tag takes precedence over the image stream history
+	streamTag := imageAPI.ImageStreamTag{}
+	streamTag.Name = "registry:v3.11"
+	streamTag.Namespace = "default"
+	streamTag.Image.DockerImageReference = registryRepository + "@sha256:0000"
+	options.ImageStreamTags = []imageAPI.ImageStreamTag{streamTag}
+
+	m = NewMutator("testClient", logrus.New(), dc, options)
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+	assert.Equal(t, registryRepository+"@sha256:0000", output.Deployment.Spec.Template.Spec.Containers[0].Image)
+}
+
+func TestMutateImageReferenceTag(t *testing.T) {
+	dc := newTriggeredDeploymentConfig(t)
+
+	options := DefaultOptions()
+	options.ImageStreams = []imageAPI.ImageStream{newImageStream()}
+	options.ImageReference = ImageReferenceTag
+	options.ImageAutomation = ImageAutomationKeel
+
+	m := NewMutator("testClient", logrus.New(), dc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, registryRepository+":v3.11", output.Deployment.Spec.Template.Spec.Containers[0].Image)
+	assert.Equal(t, "force", output.Deployment.Annotations["keel.sh/policy"])
+	assert.Equal(t, "true", output.Deployment.Annotations["keel.sh/match-tag"])
+
+	entry := output.Report.ByPath()["spec.triggers[1].imageChangeParams"]
+	assert.Equal(t, mutator.ActionApproximated, entry.Action)
+	assert.Equal(t, mutator.SeverityInfo, entry.Severity)
+
+	options.ImageReference = ImageReferenceDigest
+
+	m = NewMutator("testClient", logrus.New(), dc, options)
+	_, err = m.Mutate()
+	assert.Error(t, err)
+}
+
+func TestMutateUnresolvedImages(t *testing.T) {
+	dc := newTriggeredDeploymentConfig(t)
+	dc.Spec.Triggers[1].ImageChangeParams.LastTriggeredImage = "quay.io/openshift/registry:v3.11"
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "quay.io/openshift/registry:v3.11", output.Deployment.Spec.Template.Spec.Containers[0].Image)
+
+	dc.Spec.Triggers[1].ImageChangeParams.LastTriggeredImage = ""
+	dc.Spec.Triggers = append(dc.Spec.Triggers, apps.DeploymentTriggerPolicy{
+		Type: apps.DeploymentTriggerOnImageChange,
+		ImageChangeParams: &apps.DeploymentTriggerImageChangeParams{
+			ContainerNames: []string{"registry"},
+			From:           core.ObjectReference{Kind: "ImageStreamTag", Name: "registry"},
+		},
+	})
+
+	m = NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "", output.Deployment.Spec.Template.Spec.Containers[0].Image)
+
+	entries := output.Report.ByPath()
+	assert.Equal(t, mutator.SeverityHigh, entries["spec.triggers[1].imageChangeParams.from"].Severity)
+	assert.Equal(t, mutator.ActionDropped, entries["spec.triggers[2].imageChangeParams.from"].Action)
+
+	// only the unresolved triggers are dropped
+	triggers := apps.DeploymentTriggerPolicies{}
+	assert.NoError(t, json.Unmarshal([]byte(output.Deployment.Annotations["testClient/"+dcTriggers]), &triggers))
+	assert.Equal(t, dc.Spec.Triggers[1:], triggers)
+	assert.Equal(t, mutator.ActionDropped, entries["spec.triggers"].Action)
+}
@@ -0,0 +1,179 @@
+package dc2deployment
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	dcAPI "github.com/openshift/api/apps/v1"
+	deployAPI "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/equality"
+)
+
+// annotations set by OpenShift on the ReplicationControllers of a DeploymentConfig, and on their pod template
+const (
+	rcConfigNameAnnotation   = "openshift.io/deployment-config.name"
+	rcVersionAnnotation      = "openshift.io/deployment-config.latest-version"
+	rcNameAnnotation         = "openshift.io/deployment.name"
+	rcPhaseAnnotation        = "openshift.io/deployment.phase"
+	rcCancelledAnnotation    = "openshift.io/deployment.cancelled"
+	rcStatusReasonAnnotation = "openshift.io/deployment.status-reason"
+	rcDeploymentLabel        = "deployment"
+	rcDeploymentConfigLabel  = "deploymentconfig"
+	changeCauseAnnotation    = "kubernetes.io/change-cause"
+	// deploymentRevisionAnnotation is set by the Deployment controller with the revision it rolled out
+	deploymentRevisionAnnotation = "deployment.kubernetes.io/revision"
+	// revisionHistoryAnnotation is set on the Deployment, prefixed with the client name, with the JSON
+	// encoded revisions of the DeploymentConfig
+	revisionHistoryAnnotation = "revision-history"
+)
+
+// revisionCancelled is the phase of the revisions whose rollout was cancelled
+const revisionCancelled = "Cancelled"
+
+// revision is a rollout of the DeploymentConfig, recorded by one of its ReplicationControllers
+type revision struct {
+	Revision    int64  `json:"revision"`
+	Phase       string `json:"phase"`
+	ChangeCause string `json:"changeCause,omitempty"`
+
+	rc *core.ReplicationController
+}
+
+// revisions returns the revisions of the DeploymentConfig found in the ReplicationControllers option,
+// from the oldest to the latest
+func (m *Mutator) revisions() ([]revision, error) {
+	dc := m.input
+	revisions := []revision{}
+
+	for i := range m.options.ReplicationControllers {
+		rc := &m.options.ReplicationControllers[i]
+
+		if rc.Namespace != dc.Namespace || rc.Annotations[rcConfigNameAnnotation] != dc.Name {
+			continue
+		}
+
+		version, err := strconv.ParseInt(rc.Annotations[rcVersionAnnotation], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("ReplicationController %s annotation %s: %v", rc.Name, rcVersionAnnotation, err)
+		}
+
+		rev := revision{
+			Revision:    version,
+			Phase:       rc.Annotations[rcPhaseAnnotation],
+			ChangeCause: rc.Annotations[changeCauseAnnotation],
+			rc:          rc,
+		}
+
+		if rc.Annotations[rcCancelledAnnotation] == "true" {
+			rev.Phase = revisionCancelled
+		}
+
+		if rev.ChangeCause == "" {
+			rev.ChangeCause = rc.Annotations[rcStatusReasonAnnotation]
+		}
+
+		revisions = append(revisions, rev)
+	}
+
+	sort.Slice(revisions, func(i, j int) bool { return revisions[i].Revision < revisions[j].Revision })
+
+	return revisions, nil
+}
+
+// applyRevisions uses the pod template of the active revision, the latest complete one, and records the
+// revision history on the Deployment. Rollouts that did not complete are reported. The revision
+// annotation is left to the Deployment controller, which numbers its revisions from 1, the history
+// annotation keeps the DeploymentConfig numbering.
+func (m *Mutator) applyRevisions(deploy *deployAPI.Deployment) error {
+	revisions, err := m.revisions()
+	if err != nil || len(revisions) == 0 {
+		return err
+	}
+
+	var active *revision
+	for i := range revisions {
+		if revisions[i].Phase == string(dcAPI.DeploymentStatusComplete) {
+			active = &revisions[i]
+		}
+	}
+
+	latest := revisions[len(revisions)-1]
+
+	if active == nil || latest.Revision != active.Revision {
+		kept := "the DeploymentConfig template is used"
+		if active != nil {
+			kept = fmt.Sprintf("the template of the active revision %d is used", active.Revision)
+		}
+
+		switch dcAPI.DeploymentStatus(latest.Phase) {
+		case dcAPI.DeploymentStatusFailed:
+			m.report.Dropped("status.latestVersion", mutator.SeverityWarning, latest.Revision,
+				fmt.Sprintf("rollout of revision %d failed, %s", latest.Revision, kept))
+		case revisionCancelled:
+			m.report.Dropped("status.latestVersion", mutator.SeverityWarning, latest.Revision,
+				fmt.Sprintf("rollout of revision %d was cancelled, %s", latest.Revision, kept))
+		default:
+			m.report.Dropped("status.latestVersion", mutator.SeverityWarning, latest.Revision,
+				fmt.Sprintf("rollout of revision %d was in progress at export time, %s", latest.Revision, kept))
+		}
+	}
+
+	if active == nil {
+		return nil
+	}
+
+	if active.rc.Spec.Template != nil {
+		template := m.revisionTemplate(active.rc.Spec.Template)
+
+		if m.input.Spec.Template == nil || !equality.Semantic.DeepEqual(*m.input.Spec.Template, template) {
+			m.report.Approximated("spec.template", mutator.SeverityWarning, active.Revision,
+				fmt.Sprintf("the DeploymentConfig template is not rolled out, the template of the active revision %d is used", active.Revision))
+		}
+
+		deploy.Spec.Template = template
+	}
+
+	history, err := json.Marshal(revisions)
+	if err != nil {
+		return err
+	}
+
+	if deploy.Annotations == nil {
+		deploy.Annotations = map[string]string{}
+	}
+
+	deploy.Annotations[m.name+"/"+revisionHistoryAnnotation] = string(history)
+	m.report.Defaulted("metadata.annotations."+deploymentRevisionAnnotation, mutator.SeverityInfo, active.Revision,
+		fmt.Sprintf("the Deployment controller numbers its revisions from 1, the active revision %d is rolled out as revision 1, "+
+			"the DeploymentConfig revisions are kept in the %s annotation", active.Revision, m.name+"/"+revisionHistoryAnnotation))
+	if active.ChangeCause != "" {
+		deploy.Annotations[changeCauseAnnotation] = active.ChangeCause
+	}
+
+	return nil
+}
+
+// revisionTemplate returns the pod template of a ReplicationController without the labels and annotations
+// OpenShift adds to it
+func (m *Mutator) revisionTemplate(rcTemplate *core.PodTemplateSpec) core.PodTemplateSpec {
+	template := *rcTemplate.DeepCopy()
+
+	delete(template.Labels, rcDeploymentLabel)
+	if m.input.Spec.Template == nil || m.input.Spec.Template.Labels[rcDeploymentConfigLabel] == "" {
+		delete(template.Labels, rcDeploymentConfigLabel)
+	}
+
+	for _, annotation := range []string{rcConfigNameAnnotation, rcVersionAnnotation, rcNameAnnotation} {
+		delete(template.Annotations, annotation)
+	}
+
+	if len(template.Annotations) == 0 {
+		template.Annotations = nil
+	}
+
+	return template
+}
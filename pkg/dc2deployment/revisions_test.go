@@ -0,0 +1,147 @@
+package dc2deployment
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	apps "github.com/openshift/api/apps/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+)
+
+func newReplicationController(dc apps.DeploymentConfig, version int64, phase apps.DeploymentStatus, image string) core.ReplicationController {
+	name := dc.Name + "-" + strconv.FormatInt(version, 10)
+
+	rc := core.ReplicationController{}
+	rc.Name = name
+	rc.Namespace = dc.Namespace
+	rc.Annotations = map[string]string{
+		rcConfigNameAnnotation: dc.Name,
+		rcVersionAnnotation:    strconv.FormatInt(version, 10),
+		rcPhaseAnnotation:      string(phase),
+	}
+
+	template := dc.Spec.Template.DeepCopy()
+	template.Labels[rcDeploymentLabel] = name
+	template.Annotations = map[string]string{
+		rcConfigNameAnnotation: dc.Name,
+		rcVersionAnnotation:    strconv.FormatInt(version, 10),
+		rcNameAnnotation:       name,
+	}
+	template.Spec.Containers[0].Image = image
+	rc.Spec.Template = template
+
+	return rc
+}
+
+func TestMutateRevisions(t *testing.T) {
+	dc := newMutatorFromFileData(t, "example_with_Rolling.json", t.Name())
+	dc.Spec.Template.Spec.Containers[0].Image = "registry:3"
+
+	first := newReplicationController(dc, 1, apps.DeploymentStatusComplete, "registry:1")
+	second := newReplicationController(dc, 2, apps.DeploymentStatusComplete, "registry:2")
+	second.Annotations[changeCauseAnnotation] = "image change"
+	third := newReplicationController(dc, 3, apps.DeploymentStatusFailed, "registry:3")
+
+	other := newReplicationController(dc, 4, apps.DeploymentStatusComplete, "other:1")
+	other.Annotations[rcConfigNameAnnotation] = "other"
+
+	options := DefaultOptions()
+	options.ReplicationControllers = []core.ReplicationController{third, other, first, second}
+
+	m := NewMutator("testClient", logrus.New(), dc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	deploy := output.Deployment
+	assert.Equal(t, "registry:2", deploy.Spec.Template.Spec.Containers[0].Image)
+	assert.NotContains(t, deploy.Spec.Template.Labels, rcDeploymentLabel)
+	assert.Nil(t, deploy.Spec.Template.Annotations)
+	assert.NotContains(t, deploy.Annotations, "deployment.kubernetes.io/revision")
+	assert.Equal(t, "image change", deploy.Annotations[changeCauseAnnotation])
+
+	history := []revision{}
+	assert.NoError(t, json.Unmarshal([]byte(deploy.Annotations["testClient/"+revisionHistoryAnnotation]), &history))
+	assert.Equal(t, []int64{1, 2, 3}, []int64{history[0].Revision, history[1].Revision, history[2].Revision})
+	assert.Equal(t, string(apps.DeploymentStatusFailed), history[2].Phase)
+
+	entries := output.Report.ByPath()
+	assert.Equal(t, mutator.SeverityWarning, entries["spec.template"].Severity)
+	assert.Equal(t, int64(3), entries["status.latestVersion"].Original)
+	assert.Equal(t, "rollout of revision 3 failed, the template of the active revision 2 is used",
+		entries["status.latestVersion"].Message)
+
+	numbering := entries["metadata.annotations."+deploymentRevisionAnnotation]
+	assert.Equal(t, mutator.ActionDefaulted, numbering.Action)
+	assert.Equal(t, int64(2), numbering.Original)
+	assert.Contains(t, numbering.Message, "testClient/"+revisionHistoryAnnotation)
+}
+
+func TestMutateRevisionsHooks(t *testing.T) {
+	dc := newHookedDeploymentConfig(t)
+	dc.Spec.Template.Spec.Containers[0].Image = "registry:2"
+
+	active := newReplicationController(dc, 1, apps.DeploymentStatusComplete, "registry:1")
+	active.Spec.Template.Spec.ServiceAccountName = "deployer"
+	failed := newReplicationController(dc, 2, apps.DeploymentStatusFailed, "registry:2")
+
+	options := DefaultOptions()
+	options.ReplicationControllers = []core.ReplicationController{active, failed}
+	options.PreHookAsInitContainer = true
+
+	m := NewMutator("testClient", logrus.New(), dc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	// the hooks run the containers of the active revision
+	assert.Equal(t, "registry:1", output.Deployment.Spec.Template.Spec.InitContainers[0].Image)
+	for _, job := range output.Jobs {
+		assert.Equal(t, "registry:1", job.Spec.Template.Spec.Containers[0].Image)
+		assert.Equal(t, "deployer", job.Spec.Template.Spec.ServiceAccountName)
+	}
+}
+
+func TestMutateRevisionsInProgress(t *testing.T) {
+	dc := newMutatorFromFileData(t, "example_with_Rolling.json", t.Name())
+	image := dc.Spec.Template.Spec.Containers[0].Image
+
+	cancelled := newReplicationController(dc, 1, apps.DeploymentStatusRunning, image)
+	cancelled.Annotations[rcCancelledAnnotation] = "true"
+
+	options := DefaultOptions()
+	options.ReplicationControllers = []core.ReplicationController{cancelled}
+
+	m := NewMutator("testClient", logrus.New(), dc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.NotContains(t, output.Deployment.Annotations, "testClient/"+revisionHistoryAnnotation)
+	assert.Equal(t, "rollout of revision 1 was cancelled, the DeploymentConfig template is used",
+		output.Report.ByPath()["status.latestVersion"].Message)
+
+	// the active revision matches the DeploymentConfig template
+	running := newReplicationController(dc, 2, apps.DeploymentStatusRunning, image)
+	complete := newReplicationController(dc, 1, apps.DeploymentStatusComplete, image)
+	options.ReplicationControllers = []core.ReplicationController{running, complete}
+
+	m = NewMutator("testClient", logrus.New(), dc, options)
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+
+	entries := output.Report.ByPath()
+	assert.NotContains(t, entries, "spec.template")
+	assert.NotContains(t, output.Deployment.Annotations, "deployment.kubernetes.io/revision")
+	assert.Contains(t, output.Deployment.Annotations, "testClient/"+revisionHistoryAnnotation)
+	assert.Equal(t, "rollout of revision 2 was in progress at export time, the template of the active revision 1 is used",
+		entries["status.latestVersion"].Message)
+
+	complete.Annotations[rcVersionAnnotation] = "latest"
+	options.ReplicationControllers = []core.ReplicationController{complete}
+
+	m = NewMutator("testClient", logrus.New(), dc, options)
+	_, err = m.Mutate()
+	assert.Error(t, err)
+}
@@ -0,0 +1,104 @@
+package dc2deployment
+
+import (
+	"fmt"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	dcAPI "github.com/openshift/api/apps/v1"
+	deployAPI "k8s.io/api/apps/v1"
+)
+
+// CustomStrategyPolicy selects how DeploymentConfigs with the Custom strategy are converted
+type CustomStrategyPolicy string
+
+const (
+	// CustomStrategyRollingUpdate converts the Custom strategy into the default RollingUpdate strategy
+	CustomStrategyRollingUpdate CustomStrategyPolicy = "RollingUpdate"
+	// CustomStrategyRecreate converts the Custom strategy into the Recreate strategy
+	CustomStrategyRecreate CustomStrategyPolicy = "Recreate"
+	// CustomStrategyReject fails the conversion of DeploymentConfigs with the Custom strategy
+	CustomStrategyReject CustomStrategyPolicy = "Reject"
+)
+
+// buildStrategy converts the DeploymentConfig strategy and its parameters into the Deployment strategy
+// and progress deadline. The deployer pod settings, which Deployment has no equivalent for, are reported.
+func (m *Mutator) buildStrategy(deploy *deployAPI.Deployment) error {
+	strategy := m.input.Spec.Strategy
+
+	m.log.Debugf("[%s] Strategy: %#v", m.name, strategy)
+
+	var timeoutSeconds *int64
+
+	switch strategy.Type {
+	case dcAPI.DeploymentStrategyTypeRolling, "":
+		deploy.Spec.Strategy.Type = deployAPI.RollingUpdateDeploymentStrategyType
+
+		if strategy.RollingParams != nil {
+			params := strategy.RollingParams.DeepCopy()
+			deploy.Spec.Strategy.RollingUpdate = &deployAPI.RollingUpdateDeployment{
+				MaxSurge:       params.MaxSurge,
+				MaxUnavailable: params.MaxUnavailable,
+			}
+			timeoutSeconds = params.TimeoutSeconds
+
+			if params.IntervalSeconds != nil {
+				m.report.Dropped("spec.strategy.rollingParams.intervalSeconds", mutator.SeverityInfo, *params.IntervalSeconds,
+					"Deployment does not poll the rollout, its controller watches the pods")
+			}
+
+			if params.UpdatePeriodSeconds != nil {
+				m.report.Dropped("spec.strategy.rollingParams.updatePeriodSeconds", mutator.SeverityInfo, *params.UpdatePeriodSeconds,
+					"Deployment has no delay between the scaling steps, minReadySeconds is the closest setting")
+			}
+		}
+	case dcAPI.DeploymentStrategyTypeRecreate:
+		deploy.Spec.Strategy.Type = deployAPI.RecreateDeploymentStrategyType
+
+		if params := strategy.RecreateParams; params != nil {
+			timeoutSeconds = params.TimeoutSeconds
+		}
+	case dcAPI.DeploymentStrategyTypeCustom:
+		switch m.options.CustomStrategy {
+		case CustomStrategyRollingUpdate, "":
+			deploy.Spec.Strategy.Type = deployAPI.RollingUpdateDeploymentStrategyType
+		case CustomStrategyRecreate:
+			deploy.Spec.Strategy.Type = deployAPI.RecreateDeploymentStrategyType
+		case CustomStrategyReject:
+			return fmt.Errorf("DeploymentConfig %s uses the Custom strategy, which Deployment does not support", m.input.Name)
+		default:
+			return fmt.Errorf("unknown custom strategy policy %q", m.options.CustomStrategy)
+		}
+
+		m.report.Approximated("spec.strategy.type", mutator.SeverityHigh, strategy.CustomParams,
+			fmt.Sprintf("Custom strategy is not supported by Deployment, %s is used instead", deploy.Spec.Strategy.Type))
+	default:
+		return fmt.Errorf("DeploymentConfig %s has unknown strategy type %q", m.input.Name, strategy.Type)
+	}
+
+	if timeoutSeconds != nil {
+		progressDeadlineSeconds := int32(*timeoutSeconds)
+		deploy.Spec.ProgressDeadlineSeconds = &progressDeadlineSeconds
+	}
+
+	if strategy.CustomParams != nil && strategy.Type != dcAPI.DeploymentStrategyTypeCustom {
+		m.report.Dropped("spec.strategy.customParams", mutator.SeverityHigh, strategy.CustomParams,
+			"Deployment has no deployer pod to customize")
+	}
+
+	if len(strategy.Resources.Limits) > 0 || len(strategy.Resources.Requests) > 0 {
+		m.report.Dropped("spec.strategy.resources", mutator.SeverityInfo, strategy.Resources,
+			"Deployment has no deployer pod, the resources only apply to the hook Jobs")
+	}
+
+	if len(strategy.Labels) > 0 {
+		m.report.Dropped("spec.strategy.labels", mutator.SeverityInfo, strategy.Labels,
+			"Deployment has no deployer pod, the labels only apply to the hook Jobs")
+	}
+
+	if len(strategy.Annotations) > 0 {
+		m.report.Dropped("spec.strategy.annotations", mutator.SeverityInfo, strategy.Annotations,
+			"Deployment has no deployer pod, the annotations only apply to the hook Jobs")
+	}
+
+	return nil
+}
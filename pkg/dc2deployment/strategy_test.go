@@ -0,0 +1,133 @@
+package dc2deployment
+
+import (
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	apps "github.com/openshift/api/apps/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	deployAPI "k8s.io/api/apps/v1"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+func TestMutateRollingStrategy(t *testing.T) {
+	dc := newMutatorFromFileData(t, "example_with_Rolling.json", t.Name())
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	strategy := output.Deployment.Spec.Strategy
+	assert.Equal(t, deployAPI.RollingUpdateDeploymentStrategyType, strategy.Type)
+	assert.Equal(t, "25%", strategy.RollingUpdate.MaxSurge.String())
+	assert.Equal(t, int32(600), *output.Deployment.Spec.ProgressDeadlineSeconds)
+
+	entries := output.Report.ByPath()
+	assert.Equal(t, int64(1), entries["spec.strategy.rollingParams.intervalSeconds"].Original)
+	assert.Equal(t, int64(1), entries["spec.strategy.rollingParams.updatePeriodSeconds"].Original)
+
+	// the output does not share the input parameters
+	strategy.RollingUpdate.MaxSurge.StrVal = "50%"
+	assert.Equal(t, "25%", dc.Spec.Strategy.RollingParams.MaxSurge.StrVal)
+}
+
+func TestMutateRollingStrategyWithoutParams(t *testing.T) {
+	dc := newMutatorFromFileData(t, "example_with_Rolling.json", t.Name())
+	dc.Spec.Strategy.RollingParams = nil
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, deployAPI.RollingUpdateDeploymentStrategyType, output.Deployment.Spec.Strategy.Type)
+	assert.Nil(t, output.Deployment.Spec.Strategy.RollingUpdate)
+	assert.Nil(t, output.Deployment.Spec.ProgressDeadlineSeconds)
+
+	deploy, err := Mutate("testClient", logrus.New(), dc)
+	assert.NoError(t, err)
+	assert.Nil(t, deploy.Spec.Strategy.RollingUpdate)
+}
+
+func TestMutateRecreateStrategy(t *testing.T) {
+	timeoutSeconds := int64(300)
+
+	dc := newMutatorFromFileData(t, "example_with_Recreate.json", t.Name())
+	dc.Spec.Strategy.RecreateParams = &apps.RecreateDeploymentStrategyParams{TimeoutSeconds: &timeoutSeconds}
+	dc.Spec.Strategy.Labels = map[string]string{"team": "registry"}
+	dc.Spec.Strategy.Resources.Limits = core.ResourceList{core.ResourceCPU: resource.MustParse("1")}
+	dc.Spec.Strategy.CustomParams = &apps.CustomDeploymentStrategyParams{Command: []string{"/bin/deploy"}}
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, deployAPI.RecreateDeploymentStrategyType, output.Deployment.Spec.Strategy.Type)
+	assert.Equal(t, int32(300), *output.Deployment.Spec.ProgressDeadlineSeconds)
+
+	entries := output.Report.ByPath()
+	assert.Equal(t, dc.Spec.Strategy.Labels, entries["spec.strategy.labels"].Original)
+	assert.Equal(t, mutator.ActionDropped, entries["spec.strategy.resources"].Action)
+	assert.Equal(t, mutator.SeverityHigh, entries["spec.strategy.customParams"].Severity)
+	assert.NotContains(t, entries, "spec.strategy.annotations")
+}
+
+func TestMutateStrategyAppliedToHooks(t *testing.T) {
+	dc := newHookedDeploymentConfig(t)
+	dc.Spec.Strategy.Labels = map[string]string{"team": "registry"}
+	dc.Spec.Strategy.Annotations = map[string]string{"sidecar.istio.io/inject": "false"}
+	dc.Spec.Strategy.Resources.Limits = core.ResourceList{core.ResourceCPU: resource.MustParse("1")}
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	template := output.Jobs[0].Spec.Template
+	assert.Equal(t, dc.Spec.Strategy.Labels, template.Labels)
+	assert.Equal(t, dc.Spec.Strategy.Annotations, template.Annotations)
+	assert.Equal(t, dc.Spec.Strategy.Resources, template.Spec.Containers[0].Resources)
+}
+
+func TestMutateCustomStrategy(t *testing.T) {
+	dc := newMutatorFromFileData(t, "example_with_Custom.json", t.Name())
+
+	tests := []struct {
+		policy   CustomStrategyPolicy
+		strategy deployAPI.DeploymentStrategyType
+	}{
+		{CustomStrategyRollingUpdate, deployAPI.RollingUpdateDeploymentStrategyType},
+		{CustomStrategyRecreate, deployAPI.RecreateDeploymentStrategyType},
+	}
+
+	for _, tc := range tests {
+		options := DefaultOptions()
+		options.CustomStrategy = tc.policy
+
+		m := NewMutator("testClient", logrus.New(), dc, options)
+		output, err := m.Mutate()
+		assert.NoError(t, err)
+
+		assert.Equal(t, tc.strategy, output.Deployment.Spec.Strategy.Type)
+		assert.Nil(t, output.Deployment.Spec.Strategy.RollingUpdate)
+		assert.Equal(t, mutator.ActionApproximated, output.Report.ByPath()["spec.strategy.type"].Action)
+	}
+
+	for _, policy := range []CustomStrategyPolicy{CustomStrategyReject, "Unknown"} {
+		options := DefaultOptions()
+		options.CustomStrategy = policy
+
+		m := NewMutator("testClient", logrus.New(), dc, options)
+		_, err := m.Mutate()
+		assert.Error(t, err)
+	}
+}
+
+func TestMutateUnknownStrategy(t *testing.T) {
+	dc := newMutatorFromFileData(t, "example_with_Rolling.json", t.Name())
+	dc.Spec.Strategy.Type = "BlueGreen"
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	_, err := m.Mutate()
+	assert.Error(t, err)
+}
@@ -0,0 +1,131 @@
+package dc2deployment
+
+import (
+	"fmt"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	deployAPI "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+)
+
+// TestModePolicy selects how DeploymentConfigs in test mode are converted
+type TestModePolicy string
+
+const (
+	// TestModeDrop keeps the replicas of the Deployment running and reports the test mode as dropped
+	TestModeDrop TestModePolicy = ""
+	// TestModeJob scales the Deployment to zero and creates a Job scaling it up, waiting for the rollout
+	// and scaling it back down
+	TestModeJob TestModePolicy = "Job"
+)
+
+const (
+	// DefaultTestRunnerImage is the kubectl image running the test mode Job
+	DefaultTestRunnerImage = "bitnami/kubectl:1.20"
+	// the rollout timeout of the test mode Job when the strategy sets no timeout, as the DeploymentConfig
+	defaultTestTimeoutSeconds = 600
+)
+
+// TestRunner contains the Job running a test mode rollout of the Deployment, and the RBAC objects
+// allowing it to scale the Deployment
+type TestRunner struct {
+	Job            batch.Job
+	ServiceAccount core.ServiceAccount
+	Role           rbac.Role
+	RoleBinding    rbac.RoleBinding
+}
+
+// buildTestRunner scales the Deployment of a test mode DeploymentConfig to zero and creates the
+// TestRunner rolling it out with the DeploymentConfig replicas
+func (m *Mutator) buildTestRunner(deploy *deployAPI.Deployment) *TestRunner {
+	dc := m.input
+
+	if !dc.Spec.Test || m.options.TestMode != TestModeJob {
+		return nil
+	}
+
+	name := dc.Name + "-test-runner"
+
+	replicas := int32(0)
+	deploy.Spec.Replicas = &replicas
+
+	timeoutSeconds := int32(defaultTestTimeoutSeconds)
+	if deploy.Spec.ProgressDeadlineSeconds != nil {
+		timeoutSeconds = *deploy.Spec.ProgressDeadlineSeconds
+	}
+
+	image := m.options.TestRunnerImage
+	if image == "" {
+		image = DefaultTestRunnerImage
+	}
+
+	// the Deployment is scaled back down whatever the rollout result
+	script := fmt.Sprintf("kubectl scale deployment/%[1]s --replicas=%[2]d\n"+
+		"kubectl rollout status deployment/%[1]s --timeout=%[3]ds\n"+
+		"status=$?\n"+
+		"kubectl scale deployment/%[1]s --replicas=0\n"+
+		"exit $status\n", dc.Name, dc.Spec.Replicas, timeoutSeconds)
+
+	runner := &TestRunner{}
+
+	runner.ServiceAccount.Kind = "ServiceAccount"
+	runner.ServiceAccount.APIVersion = "v1"
+	runner.ServiceAccount.Name = name
+	runner.ServiceAccount.Namespace = dc.Namespace
+
+	runner.Role.Kind = "Role"
+	runner.Role.APIVersion = rbac.SchemeGroupVersion.String()
+	runner.Role.Name = name
+	runner.Role.Namespace = dc.Namespace
+	runner.Role.Rules = []rbac.PolicyRule{
+		{
+			APIGroups:     []string{deployAPI.GroupName},
+			Resources:     []string{"deployments"},
+			ResourceNames: []string{dc.Name},
+			Verbs:         []string{"get", "list", "watch"},
+		},
+		{
+			APIGroups:     []string{deployAPI.GroupName},
+			Resources:     []string{"deployments/scale"},
+			ResourceNames: []string{dc.Name},
+			Verbs:         []string{"get", "patch", "update"},
+		},
+	}
+
+	runner.RoleBinding.Kind = "RoleBinding"
+	runner.RoleBinding.APIVersion = rbac.SchemeGroupVersion.String()
+	runner.RoleBinding.Name = name
+	runner.RoleBinding.Namespace = dc.Namespace
+	runner.RoleBinding.RoleRef = rbac.RoleRef{APIGroup: rbac.GroupName, Kind: "Role", Name: name}
+	runner.RoleBinding.Subjects = []rbac.Subject{{Kind: "ServiceAccount", Name: name, Namespace: dc.Namespace}}
+
+	job := &runner.Job
+	job.Kind = "Job"
+	job.APIVersion = "batch/v1"
+	job.Name = name
+	job.Namespace = dc.Namespace
+
+	backoffLimit := int32(0)
+	job.Spec.BackoffLimit = &backoffLimit
+
+	pod := &job.Spec.Template.Spec
+	pod.RestartPolicy = core.RestartPolicyNever
+	pod.ServiceAccountName = name
+	pod.Containers = []core.Container{{
+		Name:    "test-runner",
+		Image:   image,
+		Command: []string{"/bin/sh", "-c", script},
+	}}
+
+	m.report.Append(m.sanitizer.SanitizeImage("spec.test", &pod.Containers[0]))
+
+	m.report.Approximated("spec.test", mutator.SeverityWarning, dc.Spec.Test,
+		fmt.Sprintf("Deployment is scaled to zero, the Job %s runs the test rollout once when it is applied "+
+			"instead of at every DeploymentConfig rollout", name))
+
+	m.log.Debugf("[%s] mutated test runner = %#v", m.name, runner)
+
+	return runner
+}
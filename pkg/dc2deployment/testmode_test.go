@@ -0,0 +1,115 @@
+package dc2deployment
+
+import (
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	"github.com/brito-rafa/k8s-mutators/pkg/podtemplate"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	batch "k8s.io/api/batch/v1"
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+)
+
+func TestMutateTestModeJob(t *testing.T) {
+	dc := newMutatorFromFileData(t, "example_with_Rolling.json", t.Name())
+	dc.Spec.Test = true
+	dc.Spec.Replicas = 3
+
+	options := DefaultOptions()
+	options.TestMode = TestModeJob
+
+	m := NewMutator("testClient", logrus.New(), dc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, int32(0), *output.Deployment.Spec.Replicas)
+	assert.Equal(t, int32(3), dc.Spec.Replicas)
+	assert.NotContains(t, output.Deployment.Annotations, "testClient/"+dcTest)
+
+	runner := output.TestRunner
+	assert.NotNil(t, runner)
+	assert.Equal(t, "docker-registry-test-runner", runner.Job.Name)
+	assert.Equal(t, "default", runner.Job.Namespace)
+
+	pod := runner.Job.Spec.Template.Spec
+	assert.Equal(t, runner.ServiceAccount.Name, pod.ServiceAccountName)
+	assert.Equal(t, DefaultTestRunnerImage, pod.Containers[0].Image)
+	assert.Equal(t, "kubectl scale deployment/docker-registry --replicas=3\n"+
+		"kubectl rollout status deployment/docker-registry --timeout=600s\n"+
+		"status=$?\n"+
+		"kubectl scale deployment/docker-registry --replicas=0\n"+
+		"exit $status\n", pod.Containers[0].Command[2])
+
+	assert.Equal(t, []string{"docker-registry"}, runner.Role.Rules[1].ResourceNames)
+	assert.Equal(t, []string{"deployments/scale"}, runner.Role.Rules[1].Resources)
+	assert.Equal(t, runner.Role.Name, runner.RoleBinding.RoleRef.Name)
+	assert.Equal(t, rbac.Subject{Kind: "ServiceAccount", Name: runner.ServiceAccount.Name, Namespace: "default"},
+		runner.RoleBinding.Subjects[0])
+
+	entry := output.Report.ByPath()["spec.test"]
+	assert.Equal(t, mutator.ActionApproximated, entry.Action)
+	assert.Equal(t, mutator.SeverityWarning, entry.Severity)
+
+	o := NewObjectMutator("testClient", logrus.New(), options)
+	result, err := o.Mutate(&dc)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, len(result.Objects))
+	assert.IsType(t, &core.ServiceAccount{}, result.Objects[1])
+	assert.IsType(t, &batch.Job{}, result.Objects[4])
+}
+
+func TestMutateTestModeJobInternalImage(t *testing.T) {
+	dc := newMutatorFromFileData(t, "example_with_Rolling.json", t.Name())
+	dc.Spec.Test = true
+
+	options := DefaultOptions()
+	options.TestMode = TestModeJob
+	options.TestRunnerImage = "image-registry.openshift-image-registry.svc:5000/openshift/cli:latest"
+
+	m := NewMutator("testClient", logrus.New(), dc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	severities := []mutator.Severity{}
+	for _, entry := range output.Report.Entries {
+		if entry.Path == "spec.test" {
+			severities = append(severities, entry.Severity)
+		}
+	}
+	assert.Equal(t, []mutator.Severity{mutator.SeverityHigh, mutator.SeverityWarning}, severities)
+
+	options.PodTemplate.Registries = []podtemplate.RegistryRule{
+		{From: "image-registry.openshift-image-registry.svc:5000", To: "quay.io/openshift"},
+	}
+
+	m = NewMutator("testClient", logrus.New(), dc, options)
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+	assert.Equal(t, "quay.io/openshift/openshift/cli:latest", output.TestRunner.Job.Spec.Template.Spec.Containers[0].Image)
+}
+
+func TestMutateTestModeDrop(t *testing.T) {
+	dc := newMutatorFromFileData(t, "example_with_Rolling.json", t.Name())
+	dc.Spec.Test = true
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Nil(t, output.TestRunner)
+	assert.Equal(t, dc.Spec.Replicas, *output.Deployment.Spec.Replicas)
+	assert.Equal(t, mutator.ActionDropped, output.Report.ByPath()["spec.test"].Action)
+
+	// only test mode DeploymentConfigs get a runner
+	dc.Spec.Test = false
+
+	options := DefaultOptions()
+	options.TestMode = TestModeJob
+
+	m = NewMutator("testClient", logrus.New(), dc, options)
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+	assert.Nil(t, output.TestRunner)
+}
@@ -0,0 +1,52 @@
+package dc2deployment
+
+import (
+	"fmt"
+
+	deployAPI "k8s.io/api/apps/v1"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// validateDeployment checks the Deployment against the apps/v1 rules the API server would reject it for
+func validateDeployment(deploy deployAPI.Deployment) error {
+	errs := []error{}
+	name := "Deployment " + deploy.Namespace + "/" + deploy.Name
+
+	spec := deploy.Spec
+
+	if spec.Selector == nil || len(spec.Selector.MatchLabels) == 0 && len(spec.Selector.MatchExpressions) == 0 {
+		errs = append(errs, fmt.Errorf("%s has no selector, and no template labels to derive it from", name))
+	} else {
+		selector, err := v1.LabelSelectorAsSelector(spec.Selector)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s selector: %v", name, err))
+		} else if !selector.Matches(labels.Set(spec.Template.Labels)) {
+			errs = append(errs, fmt.Errorf("%s selector %q does not match the template labels %q", name, selector, labels.Set(spec.Template.Labels)))
+		}
+	}
+
+	if spec.Replicas != nil && *spec.Replicas < 0 {
+		errs = append(errs, fmt.Errorf("%s has negative replicas %d", name, *spec.Replicas))
+	}
+
+	if spec.RevisionHistoryLimit != nil && *spec.RevisionHistoryLimit < 0 {
+		errs = append(errs, fmt.Errorf("%s has negative revisionHistoryLimit %d", name, *spec.RevisionHistoryLimit))
+	}
+
+	if spec.MinReadySeconds < 0 {
+		errs = append(errs, fmt.Errorf("%s has negative minReadySeconds %d", name, spec.MinReadySeconds))
+	}
+
+	if spec.ProgressDeadlineSeconds != nil && *spec.ProgressDeadlineSeconds <= spec.MinReadySeconds {
+		errs = append(errs, fmt.Errorf("%s progressDeadlineSeconds %d must be greater than minReadySeconds %d",
+			name, *spec.ProgressDeadlineSeconds, spec.MinReadySeconds))
+	}
+
+	if len(spec.Template.Spec.Containers) == 0 {
+		errs = append(errs, fmt.Errorf("%s template has no containers", name))
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
@@ -0,0 +1,81 @@
+package dc2deployment
+
+import (
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMutateDerivedSelector(t *testing.T) {
+	dc := newMutatorFromFileData(t, "example_with_Rolling.json", t.Name())
+	dc.Spec.Selector = nil
+	dc.Spec.Template.Labels["deploymentconfig"] = "docker-registry"
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	// the sanitizer keeps the OpenShift labels the derived selector uses
+	selector := output.Deployment.Spec.Selector.MatchLabels
+	assert.Equal(t, dc.Spec.Template.Labels, selector)
+	assert.Equal(t, selector, output.Deployment.Spec.Template.Labels)
+
+	entry := output.Report.ByPath()["spec.selector"]
+	assert.Equal(t, mutator.ActionDefaulted, entry.Action)
+	assert.Equal(t, mutator.SeverityWarning, entry.Severity)
+
+	deploy, err := Mutate("testClient", logrus.New(), dc)
+	assert.NoError(t, err)
+	assert.Equal(t, dc.Spec.Template.Labels, deploy.Spec.Selector.MatchLabels)
+}
+
+func TestMutateInvalidDeployment(t *testing.T) {
+	tests := []struct {
+		name string
+		edit func(m *Mutator)
+		want string
+	}{
+		{
+			"selector not matching the template",
+			func(m *Mutator) { m.input.Spec.Selector = map[string]string{"app": "other"} },
+			`Deployment default/docker-registry selector "app=other" does not match the template labels "docker-registry=default"`,
+		},
+		{
+			"no selector nor template labels",
+			func(m *Mutator) {
+				m.input.Spec.Selector = nil
+				m.input.Spec.Template.Labels = nil
+			},
+			"Deployment default/docker-registry has no selector, and no template labels to derive it from",
+		},
+		{
+			"negative replicas",
+			func(m *Mutator) { m.input.Spec.Replicas = -1 },
+			"Deployment default/docker-registry has negative replicas -1",
+		},
+		{
+			"progress deadline within minReadySeconds",
+			func(m *Mutator) { m.input.Spec.MinReadySeconds = 600 },
+			"Deployment default/docker-registry progressDeadlineSeconds 600 must be greater than minReadySeconds 600",
+		},
+		{
+			"no template",
+			func(m *Mutator) { m.input.Spec.Template = nil },
+			"Deployment default/docker-registry template has no containers",
+		},
+	}
+
+	for _, tc := range tests {
+		dc := newMutatorFromFileData(t, "example_with_Rolling.json", tc.name)
+
+		m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+		tc.edit(&m)
+
+		_, err := m.Mutate()
+		if assert.Error(t, err, tc.name) {
+			assert.Contains(t, err.Error(), tc.want, tc.name)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package dc2rollout
+
+import (
+	"fmt"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/dc2deployment"
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	dcAPI "github.com/openshift/api/apps/v1"
+	"github.com/sirupsen/logrus"
+	deployAPI "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const argoAPIVersion = "argoproj.io/v1alpha1"
+
+// StrategyPolicy selects the Rollout strategy
+type StrategyPolicy string
+
+const (
+	// StrategyAuto converts the rolling DeploymentConfigs into the canary strategy and the recreate ones
+	// into the blue-green strategy
+	StrategyAuto StrategyPolicy = ""
+	// StrategyCanary converts every DeploymentConfig into the canary strategy
+	StrategyCanary StrategyPolicy = "Canary"
+	// StrategyBlueGreen converts every DeploymentConfig into the blue-green strategy
+	StrategyBlueGreen StrategyPolicy = "BlueGreen"
+)
+
+// Options configures the conversion of the DeploymentConfig into a Rollout
+type Options struct {
+	// Deployment configures the conversion of the DeploymentConfig pod template, selector and strategy
+	// parameters, shared with dc2deployment. Test mode runners are not supported, test mode is reported.
+	Deployment dc2deployment.Options
+	// Strategy selects the Rollout strategy
+	Strategy StrategyPolicy
+	// ActiveService and PreviewService are the Services of the blue-green strategy, the active Service
+	// is named after the DeploymentConfig when empty and the preview Service is optional
+	ActiveService  string
+	PreviewService string
+}
+
+// DefaultOptions returns the Options deriving the Rollout strategy from the DeploymentConfig strategy,
+// with the dc2deployment defaults
+func DefaultOptions() Options {
+	return Options{
+		Deployment: dc2deployment.DefaultOptions(),
+	}
+}
+
+// MutatorOutput contains the mutated output structures
+type MutatorOutput struct {
+	Rollout unstructured.Unstructured
+	// AnalysisTemplates holds the AnalysisTemplates running the lifecycle hooks as Jobs, annotated with the
+	// rollout phase of their hook
+	AnalysisTemplates []unstructured.Unstructured
+	Report            mutator.Report
+}
+
+// Mutator contains common atttributes and the mutation input source structure
+type Mutator struct {
+	name    string
+	log     logrus.FieldLogger
+	input   dcAPI.DeploymentConfig
+	options Options
+	report  mutator.Report
+}
+
+// NewMutator creates a new Mutator. Clients of this API should set a meaningful name that can be used
+// to easily identify the calling client, and can start from DefaultOptions.
+// The DeploymentConfig is copied, the caller can reuse it once the Mutator is created.
+func NewMutator(name string, log logrus.FieldLogger, dc dcAPI.DeploymentConfig, options Options) Mutator {
+	options.Deployment.TestMode = dc2deployment.TestModeDrop
+
+	return Mutator{
+		name:    name,
+		log:     log,
+		input:   *dc.DeepCopy(),
+		options: options,
+	}
+}
+
+// Mutate converts a DeploymentConfig into a Rollout. The Deployment built by dc2deployment provides the
+// metadata, selector, pod template and strategy parameters, its hook Jobs become AnalysisTemplates.
+func (m *Mutator) Mutate() (*MutatorOutput, error) {
+	m.report = mutator.Report{}
+
+	dm := dc2deployment.NewMutator(m.name, m.log, m.input, m.options.Deployment)
+	deployOutput, err := dm.Mutate()
+	if err != nil {
+		return nil, err
+	}
+
+	deploy := deployOutput.Deployment
+
+	strategyType := m.options.Strategy
+	if strategyType == StrategyAuto {
+		strategyType = StrategyCanary
+		if deploy.Spec.Strategy.Type == deployAPI.RecreateDeploymentStrategyType {
+			strategyType = StrategyBlueGreen
+		}
+	}
+
+	hooks := map[string]*batch.Job{}
+	for i := range deployOutput.Jobs {
+		job := &deployOutput.Jobs[i]
+		for _, hook := range []string{dc2deployment.HookPre, dc2deployment.HookMid, dc2deployment.HookPost} {
+			if job.Annotations[m.name+"/"+dc2deployment.HookAnnotation] == hook+"-rollout" {
+				hooks[hook] = job
+			}
+		}
+	}
+
+	// the hooks are run by the Rollout, the dc2deployment entries about their Jobs do not apply
+	replaced := map[string]bool{}
+	for _, hook := range dc2deployment.LifecycleHooks(m.input.Spec.Strategy) {
+		if _, found := hooks[hook.Name]; found {
+			replaced[hook.Path] = true
+			replaced[hook.Path+".failurePolicy"] = true
+		}
+	}
+
+	var strategy map[string]interface{}
+	switch strategyType {
+	case StrategyCanary:
+		strategy = map[string]interface{}{"canary": m.buildCanary(deploy, hooks, replaced)}
+	case StrategyBlueGreen:
+		strategy = map[string]interface{}{"blueGreen": m.buildBlueGreen(deploy, hooks)}
+	default:
+		return nil, fmt.Errorf("unknown rollout strategy policy %q", m.options.Strategy)
+	}
+
+	report := mutator.Report{}
+	for _, entry := range deployOutput.Report.Entries {
+		if !replaced[entry.Path] {
+			report.Add(entry)
+		}
+	}
+	report.Append(m.report)
+
+	rollout, err := buildRollout(deploy, strategy)
+	if err != nil {
+		return nil, err
+	}
+
+	templates := []unstructured.Unstructured{}
+	for _, hook := range []string{dc2deployment.HookPre, dc2deployment.HookMid, dc2deployment.HookPost} {
+		if job, found := hooks[hook]; found {
+			template, err := m.buildAnalysisTemplate(hook, job)
+			if err != nil {
+				return nil, err
+			}
+
+			templates = append(templates, template)
+		}
+	}
+
+	m.log.Debugf("[%s] mutated rollout = %#v", m.name, rollout)
+
+	return &MutatorOutput{
+		Rollout:           rollout,
+		AnalysisTemplates: templates,
+		Report:            report,
+	}, nil
+}
+
+// buildRollout turns the Deployment into a Rollout with the given strategy
+func buildRollout(deploy deployAPI.Deployment, strategy map[string]interface{}) (unstructured.Unstructured, error) {
+	object, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&deploy)
+	if err != nil {
+		return unstructured.Unstructured{}, err
+	}
+
+	rollout := unstructured.Unstructured{Object: object}
+	rollout.SetAPIVersion(argoAPIVersion)
+	rollout.SetKind("Rollout")
+
+	unstructured.RemoveNestedField(rollout.Object, "status")
+	unstructured.RemoveNestedField(rollout.Object, "metadata", "creationTimestamp")
+	unstructured.RemoveNestedField(rollout.Object, "spec", "template", "metadata", "creationTimestamp")
+
+	if err := unstructured.SetNestedField(rollout.Object, strategy, "spec", "strategy"); err != nil {
+		return unstructured.Unstructured{}, err
+	}
+
+	return rollout, nil
+}
+
+// GroupVersionKind is the kind of the source objects converted by this package
+var GroupVersionKind = dc2deployment.GroupVersionKind
+
+// ObjectMutator adapts this package to the mutator.Mutator interface
+type ObjectMutator struct {
+	name    string
+	log     logrus.FieldLogger
+	options Options
+}
+
+// NewObjectMutator creates a mutator.Mutator converting DeploymentConfig objects.
+// Clients of this API should set a meaningful name that can be used to easily identify the calling client.
+func NewObjectMutator(name string, log logrus.FieldLogger, options Options) *ObjectMutator {
+	return &ObjectMutator{
+		name:    name,
+		log:     log,
+		options: options,
+	}
+}
+
+// Mutate converts a DeploymentConfig object into a Rollout object, the AnalysisTemplate objects running
+// its lifecycle hooks
+func (o *ObjectMutator) Mutate(obj runtime.Object) (*mutator.Result, error) {
+	dc := dcAPI.DeploymentConfig{}
+	if err := mutator.Convert(obj, &dc); err != nil {
+		return nil, err
+	}
+
+	m := NewMutator(o.name, o.log, dc, o.options)
+	output, err := m.Mutate()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &mutator.Result{
+		Objects: []runtime.Object{&output.Rollout},
+		Report:  output.Report,
+	}
+
+	for i := range output.AnalysisTemplates {
+		result.Objects = append(result.Objects, &output.AnalysisTemplates[i])
+	}
+
+	return result, nil
+}
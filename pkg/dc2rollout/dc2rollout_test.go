@@ -0,0 +1,96 @@
+package dc2rollout
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/dc2deployment"
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	apps "github.com/openshift/api/apps/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func newDeploymentConfigFromFile(t *testing.T, fileName string) apps.DeploymentConfig {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", fileName))
+	if err != nil {
+		t.Fatalf("%s: %v", t.Name(), err)
+	}
+
+	dc := apps.DeploymentConfig{}
+	if err := json.Unmarshal(data, &dc); err != nil {
+		t.Fatalf("%s: unmarshall DeploymentConfig JSON = %v", t.Name(), err)
+	}
+
+	return dc
+}
+
+func TestMutateRollout(t *testing.T) {
+	dc := newDeploymentConfigFromFile(t, "example_with_Rolling.json")
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	rollout := output.Rollout
+	assert.Equal(t, "argoproj.io/v1alpha1", rollout.GetAPIVersion())
+	assert.Equal(t, "Rollout", rollout.GetKind())
+	assert.Equal(t, "docker-registry", rollout.GetName())
+	assert.Equal(t, "default", rollout.GetNamespace())
+	assert.NotContains(t, rollout.Object, "status")
+
+	selector, _, _ := unstructured.NestedStringMap(rollout.Object, "spec", "selector", "matchLabels")
+	assert.Equal(t, dc.Spec.Selector, selector)
+
+	containers, _, _ := unstructured.NestedSlice(rollout.Object, "spec", "template", "spec", "containers")
+	assert.Equal(t, dc.Spec.Template.Spec.Containers[0].Image, containers[0].(map[string]interface{})["image"])
+
+	progressDeadlineSeconds, _, _ := unstructured.NestedInt64(rollout.Object, "spec", "progressDeadlineSeconds")
+	assert.Equal(t, int64(600), progressDeadlineSeconds)
+
+	assert.Empty(t, output.AnalysisTemplates)
+
+	options := DefaultOptions()
+	options.Strategy = "Linear"
+
+	m = NewMutator("testClient", logrus.New(), dc, options)
+	_, err = m.Mutate()
+	assert.Error(t, err)
+}
+
+func TestMutateRolloutTestMode(t *testing.T) {
+	dc := newDeploymentConfigFromFile(t, "example_with_Rolling.json")
+	dc.Spec.Test = true
+
+	options := DefaultOptions()
+	options.Deployment.TestMode = dc2deployment.TestModeJob
+
+	m := NewMutator("testClient", logrus.New(), dc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	replicas, _, _ := unstructured.NestedInt64(output.Rollout.Object, "spec", "replicas")
+	assert.Equal(t, int64(dc.Spec.Replicas), replicas)
+	assert.Equal(t, mutator.ActionDropped, output.Report.ByPath()["spec.test"].Action)
+}
+
+func TestObjectMutator(t *testing.T) {
+	dc := newDeploymentConfigFromFile(t, "example_with_Recreate.json")
+	dc.Spec.Strategy.RecreateParams = &apps.RecreateDeploymentStrategyParams{
+		Pre: &apps.LifecycleHook{
+			FailurePolicy: apps.LifecycleHookFailurePolicyAbort,
+			ExecNewPod:    &apps.ExecNewPodHook{ContainerName: "registry", Command: []string{"/bin/migrate"}},
+		},
+	}
+
+	o := NewObjectMutator("testClient", logrus.New(), DefaultOptions())
+	result, err := o.Mutate(&dc)
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(result.Objects))
+	assert.Equal(t, "Rollout", result.Objects[0].GetObjectKind().GroupVersionKind().Kind)
+	assert.Equal(t, "AnalysisTemplate", result.Objects[1].GetObjectKind().GroupVersionKind().Kind)
+}
@@ -0,0 +1,241 @@
+package dc2rollout
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/dc2deployment"
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	dcAPI "github.com/openshift/api/apps/v1"
+	deployAPI "k8s.io/api/apps/v1"
+	batch "k8s.io/api/batch/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// buildCanary returns the canary strategy. A percentage maxSurge sets the weight increment of the steps,
+// paused for updatePeriodSeconds, the pre and mid hooks are analysis steps before the canary is scaled
+// up and the post hook an analysis step once it is fully scaled up.
+// The paths of the DeploymentConfig settings the steps convert are added to replaced.
+func (m *Mutator) buildCanary(deploy deployAPI.Deployment, hooks map[string]*batch.Job, replaced map[string]bool) map[string]interface{} {
+	canary := map[string]interface{}{}
+	steps := []interface{}{}
+
+	if rollingUpdate := deploy.Spec.Strategy.RollingUpdate; rollingUpdate != nil {
+		if rollingUpdate.MaxSurge != nil {
+			canary["maxSurge"] = intOrStringValue(*rollingUpdate.MaxSurge)
+		}
+
+		if rollingUpdate.MaxUnavailable != nil {
+			canary["maxUnavailable"] = intOrStringValue(*rollingUpdate.MaxUnavailable)
+		}
+	}
+
+	for _, hook := range []string{dc2deployment.HookPre, dc2deployment.HookMid} {
+		if job, found := hooks[hook]; found {
+			steps = append(steps, analysisStep(job.Name))
+
+			severity := mutator.SeverityWarning
+			if hook == dc2deployment.HookMid {
+				severity = mutator.SeverityHigh
+			}
+
+			m.reportHook(hook, severity, fmt.Sprintf("%s hook is run by the AnalysisTemplate %s before the canary "+
+				"is scaled up, the previous pods are kept running", hook, job.Name))
+		}
+	}
+
+	var pause map[string]interface{}
+	if params := m.input.Spec.Strategy.RollingParams; params != nil && params.UpdatePeriodSeconds != nil {
+		pause = map[string]interface{}{
+			"pause": map[string]interface{}{"duration": fmt.Sprintf("%ds", *params.UpdatePeriodSeconds)},
+		}
+	}
+
+	if weight := canaryWeight(deploy); weight > 0 {
+		for step := weight; step < 100; step += weight {
+			steps = append(steps, map[string]interface{}{"setWeight": int64(step)})
+			if pause != nil {
+				steps = append(steps, pause)
+			}
+		}
+
+		if pause != nil {
+			replaced["spec.strategy.rollingParams.updatePeriodSeconds"] = true
+		}
+	}
+
+	if job, found := hooks[dc2deployment.HookPost]; found {
+		steps = append(steps, map[string]interface{}{"setWeight": int64(100)}, analysisStep(job.Name))
+
+		m.reportHook(dc2deployment.HookPost, mutator.SeverityWarning, fmt.Sprintf("post hook is run by the "+
+			"AnalysisTemplate %s once the canary is fully scaled up, before the previous pods are scaled down", job.Name))
+	}
+
+	if len(steps) > 0 {
+		canary["steps"] = steps
+	}
+
+	if deploy.Spec.Strategy.Type == deployAPI.RecreateDeploymentStrategyType {
+		m.report.Approximated("spec.strategy.type", mutator.SeverityWarning, m.input.Spec.Strategy.Type,
+			"Recreate strategy is converted into canary, the previous pods are kept running during the rollout")
+	}
+
+	return canary
+}
+
+// canaryWeight returns the weight increment of the canary steps, the percentage maxSurge, or 0
+// intOrStringValue returns the unstructured value of an IntOrString, the Rollout CRD rejects a number of
+// pods given as a string
+func intOrStringValue(value intstr.IntOrString) interface{} {
+	if value.Type == intstr.Int {
+		return int64(value.IntVal)
+	}
+
+	return value.StrVal
+}
+
+func canaryWeight(deploy deployAPI.Deployment) int {
+	rollingUpdate := deploy.Spec.Strategy.RollingUpdate
+	if rollingUpdate == nil || rollingUpdate.MaxSurge == nil || rollingUpdate.MaxSurge.Type != intstr.String {
+		return 0
+	}
+
+	weight, err := strconv.Atoi(strings.TrimSuffix(rollingUpdate.MaxSurge.StrVal, "%"))
+	if err != nil || weight <= 0 || weight >= 100 {
+		return 0
+	}
+
+	return weight
+}
+
+// buildBlueGreen returns the blue-green strategy. The pre and mid hooks run as the pre-promotion analysis
+// and the post hook as the post-promotion analysis.
+func (m *Mutator) buildBlueGreen(deploy deployAPI.Deployment, hooks map[string]*batch.Job) map[string]interface{} {
+	activeService := m.options.ActiveService
+	if activeService == "" {
+		activeService = m.input.Name
+		m.report.Defaulted("spec.selector", mutator.SeverityWarning, m.input.Spec.Selector,
+			fmt.Sprintf("blue-green strategy switches the Service %s to the new pods, it must select the pods of the Rollout", activeService))
+	}
+
+	blueGreen := map[string]interface{}{
+		"activeService": activeService,
+	}
+
+	if m.options.PreviewService != "" {
+		blueGreen["previewService"] = m.options.PreviewService
+	}
+
+	prePromotion := []interface{}{}
+	for _, hook := range []string{dc2deployment.HookPre, dc2deployment.HookMid} {
+		if job, found := hooks[hook]; found {
+			prePromotion = append(prePromotion, map[string]interface{}{"templateName": job.Name})
+
+			severity := mutator.SeverityWarning
+			if hook == dc2deployment.HookMid {
+				severity = mutator.SeverityHigh
+			}
+
+			m.reportHook(hook, severity, fmt.Sprintf("%s hook is run by the AnalysisTemplate %s before the new pods "+
+				"are promoted, while the previous pods are still active", hook, job.Name))
+		}
+	}
+
+	if len(prePromotion) > 0 {
+		blueGreen["prePromotionAnalysis"] = map[string]interface{}{"templates": prePromotion}
+	}
+
+	if job, found := hooks[dc2deployment.HookPost]; found {
+		blueGreen["postPromotionAnalysis"] = map[string]interface{}{
+			"templates": []interface{}{map[string]interface{}{"templateName": job.Name}},
+		}
+
+		m.reportHook(dc2deployment.HookPost, mutator.SeverityWarning,
+			fmt.Sprintf("post hook is run by the AnalysisTemplate %s once the new pods are promoted", job.Name))
+	}
+
+	if deploy.Spec.Strategy.Type == deployAPI.RollingUpdateDeploymentStrategyType {
+		m.report.Approximated("spec.strategy.type", mutator.SeverityInfo, m.input.Spec.Strategy.Type,
+			"rolling strategy is converted into blue-green, the new pods are all created before the Service is switched")
+	}
+
+	return blueGreen
+}
+
+// analysisStep returns a canary step running the named AnalysisTemplate
+func analysisStep(templateName string) map[string]interface{} {
+	return map[string]interface{}{
+		"analysis": map[string]interface{}{
+			"templates": []interface{}{map[string]interface{}{"templateName": templateName}},
+		},
+	}
+}
+
+// lifecycleHook returns the named hook of the DeploymentConfig strategy, nil when it is not set
+func (m *Mutator) lifecycleHook(name string) *dc2deployment.LifecycleHook {
+	for _, hook := range dc2deployment.LifecycleHooks(m.input.Spec.Strategy) {
+		if hook.Name == name {
+			return &hook
+		}
+	}
+
+	return nil
+}
+
+// reportHook reports how the hook is run by the Rollout, and the failures the DeploymentConfig ignored
+// as a failed analysis aborts the Rollout
+func (m *Mutator) reportHook(hook string, severity mutator.Severity, message string) {
+	lifecycleHook := m.lifecycleHook(hook)
+	if lifecycleHook == nil {
+		return
+	}
+
+	m.report.Approximated(lifecycleHook.Path, severity, lifecycleHook.Hook.ExecNewPod, message)
+
+	if lifecycleHook.Hook.FailurePolicy == dcAPI.LifecycleHookFailurePolicyIgnore {
+		m.report.Approximated(lifecycleHook.Path+".failurePolicy", mutator.SeverityWarning, lifecycleHook.Hook.FailurePolicy,
+			"a failed analysis aborts the Rollout, the DeploymentConfig ignored the hook failures")
+	}
+}
+
+// buildAnalysisTemplate returns the AnalysisTemplate running the hook Job as a job metric
+func (m *Mutator) buildAnalysisTemplate(hook string, job *batch.Job) (unstructured.Unstructured, error) {
+	spec, err := runtime.DefaultUnstructuredConverter.ToUnstructured(&job.Spec)
+	if err != nil {
+		return unstructured.Unstructured{}, err
+	}
+
+	unstructured.RemoveNestedField(spec, "template", "metadata", "creationTimestamp")
+
+	annotations := map[string]interface{}{}
+	for key, value := range job.Annotations {
+		annotations[key] = value
+	}
+
+	template := unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": argoAPIVersion,
+		"kind":       "AnalysisTemplate",
+		"metadata": map[string]interface{}{
+			"name":        job.Name,
+			"namespace":   job.Namespace,
+			"annotations": annotations,
+		},
+		"spec": map[string]interface{}{
+			"metrics": []interface{}{
+				map[string]interface{}{
+					"name": hook + "-hook",
+					"provider": map[string]interface{}{
+						"job": map[string]interface{}{
+							"spec": spec,
+						},
+					},
+				},
+			},
+		},
+	}}
+
+	return template, nil
+}
@@ -0,0 +1,178 @@
+package dc2rollout
+
+import (
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/dc2deployment"
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	apps "github.com/openshift/api/apps/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+func newHook(policy apps.LifecycleHookFailurePolicy, command string) *apps.LifecycleHook {
+	return &apps.LifecycleHook{
+		FailurePolicy: policy,
+		ExecNewPod:    &apps.ExecNewPodHook{ContainerName: "registry", Command: []string{command}},
+	}
+}
+
+func analysis(name string) map[string]interface{} {
+	return map[string]interface{}{
+		"analysis": map[string]interface{}{
+			"templates": []interface{}{map[string]interface{}{"templateName": name}},
+		},
+	}
+}
+
+func TestMutateCanary(t *testing.T) {
+	dc := newDeploymentConfigFromFile(t, "example_with_Rolling.json")
+	dc.Spec.Strategy.RollingParams.Pre = newHook(apps.LifecycleHookFailurePolicyIgnore, "/bin/migrate")
+	dc.Spec.Strategy.RollingParams.Post = newHook(apps.LifecycleHookFailurePolicyAbort, "/bin/notify")
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	canary, _, _ := unstructured.NestedMap(output.Rollout.Object, "spec", "strategy", "canary")
+	assert.Equal(t, "25%", canary["maxSurge"])
+	assert.Equal(t, "25%", canary["maxUnavailable"])
+
+	pause := map[string]interface{}{"pause": map[string]interface{}{"duration": "1s"}}
+	assert.Equal(t, []interface{}{
+		analysis("docker-registry-pre-hook"),
+		map[string]interface{}{"setWeight": int64(25)}, pause,
+		map[string]interface{}{"setWeight": int64(50)}, pause,
+		map[string]interface{}{"setWeight": int64(75)}, pause,
+		map[string]interface{}{"setWeight": int64(100)},
+		analysis("docker-registry-post-hook"),
+	}, canary["steps"])
+
+	assert.Equal(t, 2, len(output.AnalysisTemplates))
+
+	template := output.AnalysisTemplates[0]
+	assert.Equal(t, "AnalysisTemplate", template.GetKind())
+	assert.Equal(t, "docker-registry-pre-hook", template.GetName())
+	assert.Equal(t, "pre-rollout", template.GetAnnotations()["testClient/"+dc2deployment.HookAnnotation])
+
+	metrics, _, _ := unstructured.NestedSlice(template.Object, "spec", "metrics")
+	containers, _, _ := unstructured.NestedSlice(metrics[0].(map[string]interface{}),
+		"provider", "job", "spec", "template", "spec", "containers")
+	assert.Equal(t, []interface{}{"/bin/migrate"}, containers[0].(map[string]interface{})["command"])
+
+	entries := output.Report.ByPath()
+	assert.NotContains(t, entries, "spec.strategy.rollingParams.updatePeriodSeconds")
+	assert.Contains(t, entries, "spec.strategy.rollingParams.intervalSeconds")
+	assert.Equal(t, "pre hook is run by the AnalysisTemplate docker-registry-pre-hook before the canary is scaled up, "+
+		"the previous pods are kept running", entries["spec.strategy.rollingParams.pre"].Message)
+	assert.Equal(t, "a failed analysis aborts the Rollout, the DeploymentConfig ignored the hook failures",
+		entries["spec.strategy.rollingParams.pre.failurePolicy"].Message)
+	assert.NotContains(t, entries, "spec.strategy.rollingParams.post.failurePolicy")
+}
+
+func TestMutateCanaryIntegerParams(t *testing.T) {
+	dc := newDeploymentConfigFromFile(t, "example_with_Rolling.json")
+	maxSurge, maxUnavailable := intstr.FromInt(2), intstr.FromInt(0)
+	dc.Spec.Strategy.RollingParams.MaxSurge = &maxSurge
+	dc.Spec.Strategy.RollingParams.MaxUnavailable = &maxUnavailable
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	canary, _, _ := unstructured.NestedMap(output.Rollout.Object, "spec", "strategy", "canary")
+	assert.Equal(t, int64(2), canary["maxSurge"])
+	assert.Equal(t, int64(0), canary["maxUnavailable"])
+
+	// a number of pods gives no weight increment
+	assert.NotContains(t, canary, "steps")
+
+	// the rollout must be a valid JSON compatible unstructured object
+	assert.NotPanics(t, func() { output.Rollout.DeepCopy() })
+}
+
+func TestMutateCanaryWithoutParams(t *testing.T) {
+	dc := newDeploymentConfigFromFile(t, "example_with_Rolling.json")
+	dc.Spec.Strategy.RollingParams = nil
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	canary, found, _ := unstructured.NestedMap(output.Rollout.Object, "spec", "strategy", "canary")
+	assert.True(t, found)
+	assert.Empty(t, canary)
+}
+
+func TestMutateBlueGreen(t *testing.T) {
+	dc := newDeploymentConfigFromFile(t, "example_with_Recreate.json")
+	dc.Spec.Strategy.RecreateParams = &apps.RecreateDeploymentStrategyParams{
+		Pre:  newHook(apps.LifecycleHookFailurePolicyAbort, "/bin/migrate"),
+		Mid:  newHook(apps.LifecycleHookFailurePolicyAbort, "/bin/cleanup"),
+		Post: newHook(apps.LifecycleHookFailurePolicyAbort, "/bin/notify"),
+	}
+
+	m := NewMutator("testClient", logrus.New(), dc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	blueGreen, _, _ := unstructured.NestedMap(output.Rollout.Object, "spec", "strategy", "blueGreen")
+	assert.Equal(t, map[string]interface{}{
+		"activeService": "docker-registry",
+		"prePromotionAnalysis": map[string]interface{}{"templates": []interface{}{
+			map[string]interface{}{"templateName": "docker-registry-pre-hook"},
+			map[string]interface{}{"templateName": "docker-registry-mid-hook"},
+		}},
+		"postPromotionAnalysis": map[string]interface{}{"templates": []interface{}{
+			map[string]interface{}{"templateName": "docker-registry-post-hook"},
+		}},
+	}, blueGreen)
+	assert.Equal(t, 3, len(output.AnalysisTemplates))
+
+	entries := output.Report.ByPath()
+	assert.Equal(t, mutator.ActionDefaulted, entries["spec.selector"].Action)
+	assert.Equal(t, mutator.SeverityHigh, entries["spec.strategy.recreateParams.mid"].Severity)
+	assert.Equal(t, "mid hook is run by the AnalysisTemplate docker-registry-mid-hook before the new pods are promoted, "+
+		"while the previous pods are still active", entries["spec.strategy.recreateParams.mid"].Message)
+
+	options := DefaultOptions()
+	options.ActiveService = "registry"
+	options.PreviewService = "registry-preview"
+
+	m = NewMutator("testClient", logrus.New(), dc, options)
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+
+	blueGreen, _, _ = unstructured.NestedMap(output.Rollout.Object, "spec", "strategy", "blueGreen")
+	assert.Equal(t, "registry", blueGreen["activeService"])
+	assert.Equal(t, "registry-preview", blueGreen["previewService"])
+	assert.NotContains(t, output.Report.ByPath(), "spec.selector")
+}
+
+func TestMutateStrategyOverride(t *testing.T) {
+	dc := newDeploymentConfigFromFile(t, "example_with_Recreate.json")
+
+	options := DefaultOptions()
+	options.Strategy = StrategyCanary
+
+	m := NewMutator("testClient", logrus.New(), dc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	_, found, _ := unstructured.NestedMap(output.Rollout.Object, "spec", "strategy", "canary")
+	assert.True(t, found)
+	assert.Equal(t, mutator.SeverityWarning, output.Report.ByPath()["spec.strategy.type"].Severity)
+
+	dc = newDeploymentConfigFromFile(t, "example_with_Rolling.json")
+	options.Strategy = StrategyBlueGreen
+
+	m = NewMutator("testClient", logrus.New(), dc, options)
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+
+	_, found, _ = unstructured.NestedMap(output.Rollout.Object, "spec", "strategy", "blueGreen")
+	assert.True(t, found)
+	assert.Equal(t, mutator.SeverityInfo, output.Report.ByPath()["spec.strategy.type"].Severity)
+}
@@ -1,12 +1,15 @@
 package ingress2httpproxy
 
 import (
+	"fmt"
 	"strings"
 
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
 	contour "github.com/projectcontour/contour/apis/projectcontour/v1"
 	"github.com/sirupsen/logrus"
 	networking "k8s.io/api/networking/v1beta1"
 	meta "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 const (
@@ -16,6 +19,7 @@ const (
 // MutatorOutput contains the mutated output structures
 type MutatorOutput struct {
 	HTTPProxy contour.HTTPProxy
+	Report    mutator.Report
 }
 
 // Mutator contains common atttributes and the mutation input source structure
@@ -24,6 +28,7 @@ type Mutator struct {
 	log    logrus.FieldLogger
 	input  networking.Ingress
 	domain string
+	report mutator.Report
 }
 
 // NewMutator creates a new Mutator. Clients of this API should set a meaningful name that can be used
@@ -37,15 +42,28 @@ func NewMutator(name string, log logrus.FieldLogger, ingress networking.Ingress,
 	}
 }
 
-// Mutate converts a Ingress into HTTPProxy
-func (m *Mutator) Mutate() *MutatorOutput {
-	return &MutatorOutput{
-		HTTPProxy: m.buildHTTPProxy(),
+// Mutate converts a Ingress into HTTPProxy. An error is returned when the Ingress has no HTTP rule.
+func (m *Mutator) Mutate() (*MutatorOutput, error) {
+	m.report = mutator.Report{}
+
+	hp, err := m.buildHTTPProxy()
+	if err != nil {
+		return nil, err
 	}
+
+	return &MutatorOutput{
+		HTTPProxy: hp,
+		Report:    m.report,
+	}, nil
 }
 
 // buildHTTPProxy takes ingress object as an input and returns  Contour HTTPProxy
-func (m *Mutator) buildHTTPProxy() contour.HTTPProxy {
+func (m *Mutator) buildHTTPProxy() (contour.HTTPProxy, error) {
+	// the HTTPProxy virtual host and routes are taken from the first rule
+	if len(m.input.Spec.Rules) == 0 || m.input.Spec.Rules[0].HTTP == nil {
+		return contour.HTTPProxy{}, fmt.Errorf("Ingress %s has no HTTP rule to convert", m.input.Name)
+	}
+
 	var httpAnnotations = make(map[string]string)
 	hpTranslatedRoute, httpAnnotations := m.createRoute(httpAnnotations)
 	hp := contour.HTTPProxy{
@@ -66,31 +84,28 @@ func (m *Mutator) buildHTTPProxy() contour.HTTPProxy {
 	httpProxyFqdn := m.input.Spec.Rules[0].Host
 	if m.domain != "" {
 		normalizedDomain := m.domain
-		if m.domain[0:2] == "*." {
+		if strings.HasPrefix(m.domain, "*.") {
 			normalizedDomain = m.domain[2:]
 		}
-		if m.domain[0:1] == "." {
+		if strings.HasPrefix(m.domain, ".") {
 			normalizedDomain = m.domain[1:]
 		}
 		prefix := strings.SplitN(m.input.Spec.Rules[0].Host, ".", 2)
 		httpProxyFqdn = prefix[0] + "." + normalizedDomain
 	} else {
-		m.log.Warnf(
-			"[%s] No new wildcard DNS domain specified, use original Ingress host domain %s.",
-			m.name,
-			m.input.Spec.Rules[0].Host,
-		)
+		m.report.Defaulted("spec.rules[0].host", mutator.SeverityInfo, m.input.Spec.Rules[0].Host,
+			"no new wildcard DNS domain specified, the original Ingress host domain is used")
 	}
 
 	hp.Spec.VirtualHost = &contour.VirtualHost{
 		Fqdn: httpProxyFqdn,
 	}
 
-	if m.input.Spec.TLS[0].SecretName != "" {
+	if len(m.input.Spec.TLS) > 0 && m.input.Spec.TLS[0].SecretName != "" {
 		hp.Spec.VirtualHost.TLS = &contour.TLS{}
 		hp.Spec.VirtualHost.TLS.SecretName = m.input.Spec.TLS[0].SecretName
 	}
-	return hp
+	return hp, nil
 }
 
 // createRoute creates the route object which includes conditions and service details
@@ -112,12 +127,52 @@ func (m *Mutator) createRoute(httpAnnotations map[string]string) ([]contour.Rout
 	// Check if multiple rules present in Ingress object
 	if len(inrules) > 1 {
 		hosts := make([]string, 0, len(inrules)-1)
-		for _, inrule := range inrules[1:] {
+		for i, inrule := range inrules[1:] {
 			hosts = append(hosts, inrule.Host)
+			m.report.Dropped(fmt.Sprintf("spec.rules[%d]", i+1), mutator.SeverityHigh, inrule,
+				"a HTTPProxy serves a single host, the rule for "+inrule.Host+" is not converted")
 		}
-		m.log.Infof("[%s] unsupported hosts: %s", m.name, strings.Join(hosts, ", "))
 		httpAnnotations[m.name+"/"+unsupportedHosts] = strings.Join(hosts, ", ")
 	}
 
 	return routes, httpAnnotations
 }
+
+// GroupVersionKind is the kind of the source objects converted by this package
+var GroupVersionKind = networking.SchemeGroupVersion.WithKind("Ingress")
+
+// ObjectMutator adapts this package to the mutator.Mutator interface
+type ObjectMutator struct {
+	name   string
+	log    logrus.FieldLogger
+	domain string
+}
+
+// NewObjectMutator creates a mutator.Mutator converting Ingress objects using the given wildcard DNS domain.
+// Clients of this API should set a meaningful name that can be used to easily identify the calling client.
+func NewObjectMutator(name string, log logrus.FieldLogger, domain string) *ObjectMutator {
+	return &ObjectMutator{
+		name:   name,
+		log:    log,
+		domain: domain,
+	}
+}
+
+// Mutate converts an Ingress object into a HTTPProxy object
+func (o *ObjectMutator) Mutate(obj runtime.Object) (*mutator.Result, error) {
+	ingress := networking.Ingress{}
+	if err := mutator.Convert(obj, &ingress); err != nil {
+		return nil, err
+	}
+
+	m := NewMutator(o.name, o.log, ingress, o.domain)
+	output, err := m.Mutate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &mutator.Result{
+		Objects: []runtime.Object{&output.HTTPProxy},
+		Report:  output.Report,
+	}, nil
+}
@@ -6,9 +6,12 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	contour "github.com/projectcontour/contour/apis/projectcontour/v1"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	networking "k8s.io/api/networking/v1beta1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 const clientName = "testClient"
@@ -56,7 +59,8 @@ func TestBuildHTTPProxy(t *testing.T) {
 
 	for _, tc := range tests {
 		m := newMutatorFromFileData(t, tc.input, tc.domain, tc.name)
-		hp := m.buildHTTPProxy()
+		hp, err := m.buildHTTPProxy()
+		assert.NoError(t, err)
 
 		assert.Equal(t, tc.want.httpProxy, hp.Kind)
 		assert.Equal(t, tc.want.apiVersion, hp.APIVersion)
@@ -71,6 +75,64 @@ func TestBuildHTTPProxy(t *testing.T) {
 	}
 }
 
+func TestObjectMutator(t *testing.T) {
+	ingressFile, err := ioutil.ReadFile(filepath.Join("testdata", "example_without_wildcard.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal(ingressFile, &obj.Object); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mutator.NewRegistry()
+	assert.NoError(t, r.Register(GroupVersionKind, NewObjectMutator(clientName, logrus.New(), "")))
+
+	result, err := r.Mutate(obj)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result.Objects))
+	assert.Equal(t, obj.GetName(), result.Objects[0].(*contour.HTTPProxy).Name)
+}
+
+func TestMutateReport(t *testing.T) {
+	m := newMutatorFromFileData(t, "example_with_wildcard.json", "", t.Name())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 3, len(output.Report.Entries))
+	assert.Equal(t, "spec.rules[1]", output.Report.Entries[0].Path)
+	assert.Equal(t, "spec.rules[2]", output.Report.Entries[1].Path)
+	assert.Equal(t, mutator.SeverityHigh, output.Report.Entries[1].Severity)
+	assert.Equal(t, mutator.ActionDefaulted, output.Report.Entries[2].Action)
+}
+
+func TestMutateWithoutTLS(t *testing.T) {
+	m := newMutatorFromFileData(t, "example_without_wildcard.json", "", t.Name())
+	m.input.Spec.TLS = nil
+
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+	assert.Nil(t, output.HTTPProxy.Spec.VirtualHost.TLS)
+	assert.Equal(t, m.input.Spec.Rules[0].Host, output.HTTPProxy.Spec.VirtualHost.Fqdn)
+}
+
+func TestMutateWithoutRules(t *testing.T) {
+	m := newMutatorFromFileData(t, "example_without_wildcard.json", "", t.Name())
+	m.input.Spec.Rules[0].HTTP = nil
+
+	_, err := m.Mutate()
+	assert.Error(t, err)
+
+	m.input.Spec.Rules = nil
+	_, err = m.Mutate()
+	assert.Error(t, err)
+
+	_, err = NewObjectMutator(clientName, logrus.New(), "").Mutate(&m.input)
+	assert.Error(t, err)
+}
+
 func newMutatorFromFileData(t *testing.T, fileName, domain, testName string) Mutator {
 	ingressFilePath := filepath.Join("testdata", fileName)
 	ingressFile, err := ioutil.ReadFile(ingressFilePath)
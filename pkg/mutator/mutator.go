@@ -0,0 +1,83 @@
+// Package mutator defines the contract shared by the mutators under pkg/ and a registry that
+// dispatches a source object to the mutator registered for its GroupVersionKind.
+package mutator
+
+import (
+	"fmt"
+
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+// Mutator converts a source object, either typed or *unstructured.Unstructured, into its target objects
+type Mutator interface {
+	Mutate(obj runtime.Object) (*Result, error)
+}
+
+// Result contains the mutated objects and the report of the conversion
+type Result struct {
+	Objects []runtime.Object
+	Report  Report
+}
+
+// Registry maps source GroupVersionKinds to the Mutator converting them
+type Registry struct {
+	mutators map[schema.GroupVersionKind]Mutator
+}
+
+// NewRegistry creates an empty Registry
+func NewRegistry() *Registry {
+	return &Registry{
+		mutators: make(map[schema.GroupVersionKind]Mutator),
+	}
+}
+
+// Register adds a Mutator for the given source GroupVersionKind. Registering the same
+// GroupVersionKind twice is an error.
+func (r *Registry) Register(gvk schema.GroupVersionKind, m Mutator) error {
+	if gvk.Kind == "" {
+		return fmt.Errorf("cannot register a mutator without kind for %s", gvk.GroupVersion())
+	}
+
+	if _, found := r.mutators[gvk]; found {
+		return fmt.Errorf("a mutator is already registered for %s", gvk)
+	}
+
+	r.mutators[gvk] = m
+
+	return nil
+}
+
+// Lookup returns the Mutator registered for the given source GroupVersionKind
+func (r *Registry) Lookup(gvk schema.GroupVersionKind) (Mutator, bool) {
+	m, found := r.mutators[gvk]
+	return m, found
+}
+
+// Mutate dispatches obj to the Mutator registered for its GroupVersionKind. The object must carry
+// its apiVersion and kind.
+func (r *Registry) Mutate(obj runtime.Object) (*Result, error) {
+	gvk := obj.GetObjectKind().GroupVersionKind()
+
+	if gvk.Kind == "" {
+		return nil, fmt.Errorf("object %T has no kind set", obj)
+	}
+
+	m, found := r.Lookup(gvk)
+	if !found {
+		return nil, fmt.Errorf("no mutator registered for %s", gvk)
+	}
+
+	return m.Mutate(obj)
+}
+
+// Convert decodes obj, either typed or *unstructured.Unstructured, into out which must be a pointer
+// to the typed structure expected by the calling mutator
+func Convert(obj runtime.Object, out interface{}) error {
+	content, err := runtime.DefaultUnstructuredConverter.ToUnstructured(obj)
+	if err != nil {
+		return err
+	}
+
+	return runtime.DefaultUnstructuredConverter.FromUnstructured(content, out)
+}
@@ -0,0 +1,84 @@
+package mutator
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+var configMapKind = schema.GroupVersionKind{Version: "v1", Kind: "ConfigMap"}
+
+type configMapToSecret struct{}
+
+func (c configMapToSecret) Mutate(obj runtime.Object) (*Result, error) {
+	cm := core.ConfigMap{}
+	if err := Convert(obj, &cm); err != nil {
+		return nil, err
+	}
+
+	secret := &core.Secret{}
+	secret.Name = cm.Name
+	secret.StringData = cm.Data
+
+	return &Result{Objects: []runtime.Object{secret}}, nil
+}
+
+func TestRegistryRegister(t *testing.T) {
+	r := NewRegistry()
+
+	assert.NoError(t, r.Register(configMapKind, configMapToSecret{}))
+	assert.Error(t, r.Register(configMapKind, configMapToSecret{}))
+	assert.Error(t, r.Register(schema.GroupVersionKind{Version: "v1"}, configMapToSecret{}))
+
+	_, found := r.Lookup(configMapKind)
+	assert.True(t, found)
+
+	_, found = r.Lookup(schema.GroupVersionKind{Version: "v1", Kind: "Secret"})
+	assert.False(t, found)
+}
+
+func TestRegistryMutate(t *testing.T) {
+	r := NewRegistry()
+	assert.NoError(t, r.Register(configMapKind, configMapToSecret{}))
+
+	typed := &core.ConfigMap{}
+	typed.APIVersion = "v1"
+	typed.Kind = "ConfigMap"
+	typed.Name = "typed"
+	typed.Data = map[string]string{"key": "value"}
+
+	untyped := &unstructured.Unstructured{Object: map[string]interface{}{
+		"apiVersion": "v1",
+		"kind":       "ConfigMap",
+		"metadata":   map[string]interface{}{"name": "untyped"},
+		"data":       map[string]interface{}{"key": "value"},
+	}}
+
+	for _, obj := range []runtime.Object{typed, untyped} {
+		result, err := r.Mutate(obj)
+
+		assert.NoError(t, err)
+		assert.Equal(t, 1, len(result.Objects))
+
+		secret := result.Objects[0].(*core.Secret)
+		assert.Equal(t, "value", secret.StringData["key"])
+	}
+}
+
+func TestRegistryMutateUnknownKind(t *testing.T) {
+	r := NewRegistry()
+
+	_, err := r.Mutate(&core.ConfigMap{})
+	assert.Error(t, err)
+
+	secret := &core.Secret{}
+	secret.APIVersion = "v1"
+	secret.Kind = "Secret"
+
+	_, err = r.Mutate(secret)
+	assert.Error(t, err)
+}
@@ -0,0 +1,139 @@
+package mutator
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Severity ranks how much a report entry changes the behaviour of the mutated objects
+type Severity int
+
+const (
+	// SeverityInfo entries do not change the behaviour of the mutated objects
+	SeverityInfo Severity = iota
+	// SeverityWarning entries change the behaviour of the mutated objects in a way that should be reviewed
+	SeverityWarning
+	// SeverityHigh entries change the behaviour or the security posture of the mutated objects
+	SeverityHigh
+)
+
+var severityNames = []string{"info", "warning", "high"}
+
+func (s Severity) String() string {
+	if s < 0 || int(s) >= len(severityNames) {
+		return fmt.Sprintf("Severity(%d)", int(s))
+	}
+
+	return severityNames[s]
+}
+
+// MarshalText encodes the severity by name
+func (s Severity) MarshalText() ([]byte, error) {
+	return []byte(s.String()), nil
+}
+
+// UnmarshalText decodes a severity name
+func (s *Severity) UnmarshalText(text []byte) error {
+	for i, name := range severityNames {
+		if strings.EqualFold(name, string(text)) {
+			*s = Severity(i)
+			return nil
+		}
+	}
+
+	return fmt.Errorf("unknown severity %q", string(text))
+}
+
+// Action describes what happened to a source field
+type Action string
+
+const (
+	// ActionDropped means the field has no equivalent and is not present in the mutated objects
+	ActionDropped Action = "Dropped"
+	// ActionDefaulted means a value was chosen by the mutator because the source did not provide one
+	// or provided one that cannot be expressed
+	ActionDefaulted Action = "Defaulted"
+	// ActionApproximated means the field was converted into the closest, but not identical, equivalent
+	ActionApproximated Action = "Approximated"
+)
+
+// Entry describes a single source field that was not converted as is
+type Entry struct {
+	// Path is the JSON path of the field in the source object, e.g. spec.strategy.type
+	Path     string      `json:"path"`
+	Action   Action      `json:"action"`
+	Severity Severity    `json:"severity"`
+	Original interface{} `json:"original,omitempty"`
+	Message  string      `json:"message"`
+}
+
+func (e Entry) String() string {
+	return fmt.Sprintf("%s %s (%s): %s", e.Action, e.Path, e.Severity, e.Message)
+}
+
+// Report describes what happened to the source object fields during a mutation
+type Report struct {
+	Entries []Entry `json:"entries"`
+}
+
+// Add appends an entry to the report
+func (r *Report) Add(entry Entry) {
+	r.Entries = append(r.Entries, entry)
+}
+
+// Dropped records a source field that has no equivalent in the mutated objects
+func (r *Report) Dropped(path string, severity Severity, original interface{}, message string) {
+	r.Add(Entry{Path: path, Action: ActionDropped, Severity: severity, Original: original, Message: message})
+}
+
+// Defaulted records a value chosen by the mutator in place of the source field
+func (r *Report) Defaulted(path string, severity Severity, original interface{}, message string) {
+	r.Add(Entry{Path: path, Action: ActionDefaulted, Severity: severity, Original: original, Message: message})
+}
+
+// Approximated records a source field converted into its closest equivalent
+func (r *Report) Approximated(path string, severity Severity, original interface{}, message string) {
+	r.Add(Entry{Path: path, Action: ActionApproximated, Severity: severity, Original: original, Message: message})
+}
+
+// Append adds all the entries of another report
+func (r *Report) Append(other Report) {
+	r.Entries = append(r.Entries, other.Entries...)
+}
+
+// ByPath returns the entries indexed by their path, the last entry wins when several share a path
+func (r Report) ByPath() map[string]Entry {
+	entries := map[string]Entry{}
+
+	for _, entry := range r.Entries {
+		entries[entry.Path] = entry
+	}
+
+	return entries
+}
+
+// MaxSeverity returns the highest severity of the report entries, SeverityInfo when the report is empty
+func (r Report) MaxSeverity() Severity {
+	max := SeverityInfo
+
+	for _, entry := range r.Entries {
+		if entry.Severity > max {
+			max = entry.Severity
+		}
+	}
+
+	return max
+}
+
+// AtLeast returns the entries whose severity is equal or higher than the given one
+func (r Report) AtLeast(severity Severity) []Entry {
+	entries := []Entry{}
+
+	for _, entry := range r.Entries {
+		if entry.Severity >= severity {
+			entries = append(entries, entry)
+		}
+	}
+
+	return entries
+}
@@ -0,0 +1,61 @@
+package mutator
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReportSeverities(t *testing.T) {
+	r := Report{}
+	assert.Equal(t, SeverityInfo, r.MaxSeverity())
+
+	r.Defaulted("spec.host", SeverityInfo, "example.com", "defaulted")
+	r.Approximated("spec.strategy.type", SeverityWarning, "Custom", "approximated")
+	assert.Equal(t, SeverityWarning, r.MaxSeverity())
+
+	r.Dropped("spec.test", SeverityHigh, true, "dropped")
+	assert.Equal(t, SeverityHigh, r.MaxSeverity())
+
+	assert.Equal(t, 3, len(r.AtLeast(SeverityInfo)))
+	assert.Equal(t, 2, len(r.AtLeast(SeverityWarning)))
+	assert.Equal(t, 1, len(r.AtLeast(SeverityHigh)))
+	assert.Equal(t, ActionDropped, r.AtLeast(SeverityHigh)[0].Action)
+
+	other := Report{}
+	other.Append(r)
+	assert.Equal(t, r.Entries, other.Entries)
+}
+
+func TestReportByPath(t *testing.T) {
+	r := Report{}
+	assert.Empty(t, r.ByPath())
+
+	r.Defaulted("spec.host", SeverityInfo, "example.com", "defaulted")
+	r.Dropped("spec.test", SeverityWarning, true, "dropped")
+	r.Dropped("spec.test", SeverityHigh, false, "dropped again")
+
+	entries := r.ByPath()
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, "example.com", entries["spec.host"].Original)
+	assert.Equal(t, SeverityHigh, entries["spec.test"].Severity)
+}
+
+func TestReportJSON(t *testing.T) {
+	r := Report{}
+	r.Dropped("spec.triggers", SeverityWarning, []string{"ConfigChange"}, "dropped")
+
+	data, err := json.Marshal(r)
+	assert.NoError(t, err)
+	assert.JSONEq(t,
+		`{"entries":[{"path":"spec.triggers","action":"Dropped","severity":"warning","original":["ConfigChange"],"message":"dropped"}]}`,
+		string(data))
+
+	decoded := Report{}
+	assert.NoError(t, json.Unmarshal(data, &decoded))
+	assert.Equal(t, SeverityWarning, decoded.Entries[0].Severity)
+
+	var severity Severity
+	assert.Error(t, severity.UnmarshalText([]byte("critical")))
+}
@@ -0,0 +1,178 @@
+package podtemplate
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	"github.com/sirupsen/logrus"
+	core "k8s.io/api/core/v1"
+)
+
+// RegistryRule rewrites the images of a registry, From is the registry host and To the registry host,
+// optionally followed by a path, replacing it
+type RegistryRule struct {
+	From string
+	To   string
+}
+
+// Options configures the OpenShift specific content removed from or rewritten in the pod templates
+type Options struct {
+	// StripLabels and StripAnnotations are removed from the pod template metadata, the labels used by the
+	// workload selector are kept
+	StripLabels      []string
+	StripAnnotations []string
+	// Registries rewrites the image references of the containers
+	Registries []RegistryRule
+	// InternalRegistries are reported when the images they hold are not rewritten, they are not reachable
+	// from other clusters
+	InternalRegistries []string
+	// PullSecretPatterns are the path.Match patterns of the image pull secrets removed from the pod spec
+	PullSecretPatterns []string
+}
+
+// DefaultOptions returns the Options removing the labels, annotations and service account pull secrets
+// OpenShift adds to the pod templates and reporting the images of the internal registries
+func DefaultOptions() Options {
+	return Options{
+		StripLabels:        []string{"deploymentconfig", "deployment"},
+		StripAnnotations:   []string{"openshift.io/scc"},
+		InternalRegistries: []string{"image-registry.openshift-image-registry.svc:5000", "docker-registry.default.svc:5000"},
+		PullSecretPatterns: []string{"*-dockercfg-*"},
+	}
+}
+
+// Sanitizer removes the OpenShift specific content of pod templates
+type Sanitizer struct {
+	name    string
+	log     logrus.FieldLogger
+	options Options
+}
+
+// NewSanitizer creates a new Sanitizer. Clients of this API should set a meaningful name that can be used
+// to easily identify the calling client, and can start from DefaultOptions.
+func NewSanitizer(name string, log logrus.FieldLogger, options Options) *Sanitizer {
+	return &Sanitizer{
+		name:    name,
+		log:     log,
+		options: options,
+	}
+}
+
+// Sanitize removes the OpenShift specific content of the pod template in place, the labels of the
+// selector are kept. The returned report has an entry, under the root path, for every change.
+func (s *Sanitizer) Sanitize(root string, template *core.PodTemplateSpec, selector map[string]string) mutator.Report {
+	report := mutator.Report{}
+
+	for _, label := range s.options.StripLabels {
+		value, found := template.Labels[label]
+		if !found {
+			continue
+		}
+
+		if _, selected := selector[label]; selected {
+			report.Approximated(root+".metadata.labels."+label, mutator.SeverityInfo, value,
+				"label is set by OpenShift, it is kept as the selector uses it")
+			continue
+		}
+
+		delete(template.Labels, label)
+		report.Dropped(root+".metadata.labels."+label, mutator.SeverityInfo, value, "label is set by OpenShift")
+	}
+
+	for _, annotation := range s.options.StripAnnotations {
+		if value, found := template.Annotations[annotation]; found {
+			delete(template.Annotations, annotation)
+			report.Dropped(root+".metadata.annotations."+annotation, mutator.SeverityInfo, value, "annotation is set by OpenShift")
+		}
+	}
+
+	pod := &template.Spec
+
+	for i := range pod.InitContainers {
+		report.Append(s.SanitizeImage(fmt.Sprintf("%s.spec.initContainers[%d].image", root, i), &pod.InitContainers[i]))
+	}
+
+	for i := range pod.Containers {
+		report.Append(s.SanitizeImage(fmt.Sprintf("%s.spec.containers[%d].image", root, i), &pod.Containers[i]))
+	}
+
+	pullSecrets := pod.ImagePullSecrets[:0:0]
+	for _, secret := range pod.ImagePullSecrets {
+		if s.generatedPullSecret(secret.Name) {
+			report.Dropped(root+".spec.imagePullSecrets", mutator.SeverityInfo, secret.Name,
+				"pull secret is generated by OpenShift for the service account")
+			continue
+		}
+
+		pullSecrets = append(pullSecrets, secret)
+	}
+
+	pod.ImagePullSecrets = pullSecrets
+	if len(pod.ImagePullSecrets) == 0 {
+		pod.ImagePullSecrets = nil
+	}
+
+	s.log.Debugf("[%s] sanitized pod template = %#v", s.name, template)
+
+	return report
+}
+
+// Image returns the image rewritten by the first matching registry rule
+func (s *Sanitizer) Image(image string) string {
+	registry, rest := splitRegistry(image)
+
+	for _, rule := range s.options.Registries {
+		if registry == rule.From {
+			return strings.TrimSuffix(rule.To, "/") + "/" + rest
+		}
+	}
+
+	return image
+}
+
+// SanitizeImage rewrites the image of the container in place. The returned report has an entry, under the
+// field path, when the image is rewritten or left in an internal registry.
+func (s *Sanitizer) SanitizeImage(field string, container *core.Container) mutator.Report {
+	report := mutator.Report{}
+	image := s.Image(container.Image)
+
+	if image != container.Image {
+		report.Approximated(field, mutator.SeverityInfo, container.Image, "image registry is rewritten to "+image)
+		container.Image = image
+		return report
+	}
+
+	registry, _ := splitRegistry(image)
+	for _, internal := range s.options.InternalRegistries {
+		if registry == internal {
+			report.Dropped(field, mutator.SeverityHigh, image,
+				"image is in the OpenShift internal registry "+internal+", which has no equivalent on other clusters, "+
+					"the image cannot be pulled until it is pushed to another registry and a rule rewrites it")
+		}
+	}
+
+	return report
+}
+
+func (s *Sanitizer) generatedPullSecret(name string) bool {
+	for _, pattern := range s.options.PullSecretPatterns {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+
+	return false
+}
+
+// splitRegistry splits the registry host of an image from its repository, the host is empty for the
+// images of the default registry
+func splitRegistry(image string) (string, string) {
+	parts := strings.SplitN(image, "/", 2)
+	if len(parts) == 1 || !strings.ContainsAny(parts[0], ".:") && parts[0] != "localhost" {
+		return "", image
+	}
+
+	return parts[0], parts[1]
+}
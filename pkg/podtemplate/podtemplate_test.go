@@ -0,0 +1,114 @@
+package podtemplate
+
+import (
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+)
+
+func newTemplate() core.PodTemplateSpec {
+	template := core.PodTemplateSpec{}
+	template.Labels = map[string]string{"app": "registry", "deploymentconfig": "registry", "deployment": "registry-3"}
+	template.Annotations = map[string]string{"openshift.io/scc": "restricted", "team": "platform"}
+	template.Spec.InitContainers = []core.Container{{Name: "init", Image: "busybox"}}
+	template.Spec.Containers = []core.Container{
+		{Name: "registry", Image: "image-registry.openshift-image-registry.svc:5000/default/registry@sha256:1234"},
+		{Name: "proxy", Image: "docker-registry.default.svc:5000/default/proxy:latest"},
+	}
+	template.Spec.ImagePullSecrets = []core.LocalObjectReference{{Name: "default-dockercfg-x2b4n"}, {Name: "quay"}}
+
+	return template
+}
+
+func TestSanitize(t *testing.T) {
+	template := newTemplate()
+
+	s := NewSanitizer("testClient", logrus.New(), DefaultOptions())
+	report := s.Sanitize("spec.template", &template, map[string]string{"deploymentconfig": "registry"})
+
+	assert.Equal(t, map[string]string{"app": "registry", "deploymentconfig": "registry"}, template.Labels)
+	assert.Equal(t, map[string]string{"team": "platform"}, template.Annotations)
+	assert.Equal(t, []core.LocalObjectReference{{Name: "quay"}}, template.Spec.ImagePullSecrets)
+	assert.Equal(t, "busybox", template.Spec.InitContainers[0].Image)
+
+	entries := report.ByPath()
+	assert.Equal(t, 6, len(report.Entries))
+	assert.Equal(t, mutator.ActionApproximated, entries["spec.template.metadata.labels.deploymentconfig"].Action)
+	assert.Equal(t, "registry-3", entries["spec.template.metadata.labels.deployment"].Original)
+	assert.Equal(t, "restricted", entries["spec.template.metadata.annotations.openshift.io/scc"].Original)
+	assert.Equal(t, "default-dockercfg-x2b4n", entries["spec.template.spec.imagePullSecrets"].Original)
+	assert.Equal(t, mutator.SeverityHigh, entries["spec.template.spec.containers[0].image"].Severity)
+	assert.Equal(t, mutator.ActionDropped, entries["spec.template.spec.containers[0].image"].Action)
+	assert.Equal(t, mutator.SeverityHigh, entries["spec.template.spec.containers[1].image"].Severity)
+}
+
+func TestSanitizeRegistries(t *testing.T) {
+	template := newTemplate()
+
+	options := DefaultOptions()
+	options.Registries = []RegistryRule{
+		{From: "image-registry.openshift-image-registry.svc:5000", To: "quay.io/mirror/"},
+		{From: "docker.io", To: "registry.example.com"},
+	}
+
+	s := NewSanitizer("testClient", logrus.New(), options)
+	report := s.Sanitize("spec.template", &template, nil)
+
+	assert.Equal(t, "quay.io/mirror/default/registry@sha256:1234", template.Spec.Containers[0].Image)
+	assert.NotContains(t, template.Labels, "deploymentconfig")
+
+	entries := report.ByPath()
+	entry := entries["spec.template.spec.containers[0].image"]
+	assert.Equal(t, mutator.SeverityInfo, entry.Severity)
+	assert.Equal(t, mutator.ActionApproximated, entry.Action)
+	assert.Equal(t, "image-registry.openshift-image-registry.svc:5000/default/registry@sha256:1234", entry.Original)
+	assert.Equal(t, mutator.SeverityHigh, entries["spec.template.spec.containers[1].image"].Severity)
+
+	tests := []struct {
+		image string
+		want  string
+	}{
+		{"busybox", "busybox"},
+		{"library/busybox:1.32", "library/busybox:1.32"},
+		{"docker.io/library/busybox", "registry.example.com/library/busybox"},
+		{"localhost/busybox", "localhost/busybox"},
+	}
+
+	for _, tc := range tests {
+		assert.Equal(t, tc.want, s.Image(tc.image), tc.image)
+	}
+}
+
+func TestSanitizeImage(t *testing.T) {
+	options := DefaultOptions()
+	options.Registries = []RegistryRule{{From: "docker-registry.default.svc:5000", To: "quay.io/mirror"}}
+	s := NewSanitizer("testClient", logrus.New(), options)
+
+	container := core.Container{Name: "hook", Image: "docker-registry.default.svc:5000/default/proxy:latest"}
+	report := s.SanitizeImage("hook.image", &container)
+	assert.Equal(t, "quay.io/mirror/default/proxy:latest", container.Image)
+	assert.Equal(t, mutator.SeverityInfo, report.ByPath()["hook.image"].Severity)
+
+	container.Image = "image-registry.openshift-image-registry.svc:5000/default/registry:2"
+	report = s.SanitizeImage("hook.image", &container)
+	assert.Equal(t, "image-registry.openshift-image-registry.svc:5000/default/registry:2", container.Image)
+	assert.Equal(t, mutator.SeverityHigh, report.ByPath()["hook.image"].Severity)
+	assert.Equal(t, mutator.ActionDropped, report.ByPath()["hook.image"].Action)
+
+	container.Image = "busybox"
+	assert.Empty(t, s.SanitizeImage("hook.image", &container).Entries)
+}
+
+func TestSanitizeNothing(t *testing.T) {
+	template := newTemplate()
+	original := *template.DeepCopy()
+
+	s := NewSanitizer("testClient", logrus.New(), Options{})
+	report := s.Sanitize("spec.template", &template, nil)
+
+	assert.Equal(t, original, template)
+	assert.Empty(t, report.Entries)
+}
@@ -0,0 +1,471 @@
+package psp2scc
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	security "github.com/openshift/api/security/v1"
+	"github.com/sirupsen/logrus"
+	policy "k8s.io/api/policy/v1beta1"
+	rbac "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+// PodSecurityPolicy annotations without a dedicated field
+const (
+	seccompAllowedProfilesAnnotation  = "seccomp.security.alpha.kubernetes.io/allowedProfileNames"
+	seccompDefaultProfileAnnotation   = "seccomp.security.alpha.kubernetes.io/defaultProfileName"
+	appArmorAllowedProfilesAnnotation = "apparmor.security.beta.kubernetes.io/allowedProfileNames"
+	appArmorDefaultProfileAnnotation  = "apparmor.security.beta.kubernetes.io/defaultProfileName"
+)
+
+// RBAC holds the roles and bindings that may grant the use of the PodSecurityPolicy
+type RBAC struct {
+	ClusterRoles        []rbac.ClusterRole
+	Roles               []rbac.Role
+	ClusterRoleBindings []rbac.ClusterRoleBinding
+	RoleBindings        []rbac.RoleBinding
+}
+
+// MutatorOutput contains the mutated output structures
+type MutatorOutput struct {
+	SecurityContextConstraints security.SecurityContextConstraints
+	Report                     mutator.Report
+}
+
+// Mutator contains common atttributes and the mutation input source structure
+type Mutator struct {
+	name   string
+	log    logrus.FieldLogger
+	input  policy.PodSecurityPolicy
+	rbac   RBAC
+	report mutator.Report
+}
+
+// NewMutator creates a new Mutator. Clients of this API should set a meaningful name that can be used
+// to easily identify the calling client.
+func NewMutator(name string, log logrus.FieldLogger, psp policy.PodSecurityPolicy, rbac RBAC) Mutator {
+	return Mutator{
+		name:  name,
+		log:   log,
+		input: psp,
+		rbac:  rbac,
+	}
+}
+
+// Mutate converts a PodSecurityPolicy into a SecurityContextConstraints granted to the subjects bound to
+// the roles allowing the use of the PodSecurityPolicy
+func (m *Mutator) Mutate() (*MutatorOutput, error) {
+	m.log.Debugf("[%s] input to mutate = %#v", m.name, m.input)
+	m.report = mutator.Report{}
+
+	if m.input.Name == "" {
+		return nil, fmt.Errorf("PodSecurityPolicy has no name")
+	}
+
+	scc := m.buildScc()
+	scc.Users, scc.Groups = m.buildSubjects()
+
+	m.log.Debugf("[%s] mutated SCC = %#v", m.name, scc)
+
+	return &MutatorOutput{
+		SecurityContextConstraints: scc,
+		Report:                     m.report,
+	}, nil
+}
+
+func (m *Mutator) buildScc() security.SecurityContextConstraints {
+	psp := m.input
+
+	scc := security.SecurityContextConstraints{}
+	scc.Kind = "SecurityContextConstraints"
+	scc.APIVersion = security.GroupVersion.String()
+	scc.Name = psp.Name
+	scc.Labels = psp.Labels
+	scc.Annotations = m.buildAnnotations()
+
+	scc.AllowPrivilegedContainer = psp.Spec.Privileged
+	scc.DefaultAddCapabilities = psp.Spec.DefaultAddCapabilities
+	scc.RequiredDropCapabilities = psp.Spec.RequiredDropCapabilities
+	scc.AllowedCapabilities = psp.Spec.AllowedCapabilities
+
+	if psp.Spec.Volumes != nil {
+		scc.Volumes = make([]security.FSType, len(psp.Spec.Volumes))
+
+		for i := range psp.Spec.Volumes {
+			scc.Volumes[i] = security.FSType(psp.Spec.Volumes[i])
+
+			if psp.Spec.Volumes[i] == policy.HostPath || psp.Spec.Volumes[i] == policy.All {
+				scc.AllowHostDirVolumePlugin = true
+			}
+		}
+	}
+
+	if len(psp.Spec.AllowedHostPaths) > 0 && scc.AllowHostDirVolumePlugin {
+		m.report.Dropped("spec.allowedHostPaths", mutator.SeverityHigh, psp.Spec.AllowedHostPaths,
+			"SecurityContextConstraints cannot restrict the host paths, any hostPath volume is allowed")
+	}
+
+	if psp.Spec.AllowedFlexVolumes != nil {
+		scc.AllowedFlexVolumes = make([]security.AllowedFlexVolume, len(psp.Spec.AllowedFlexVolumes))
+
+		for i := range psp.Spec.AllowedFlexVolumes {
+			scc.AllowedFlexVolumes[i].Driver = psp.Spec.AllowedFlexVolumes[i].Driver
+		}
+	}
+
+	if len(psp.Spec.AllowedCSIDrivers) > 0 {
+		m.report.Dropped("spec.allowedCSIDrivers", mutator.SeverityWarning, psp.Spec.AllowedCSIDrivers,
+			"SecurityContextConstraints cannot restrict the inline CSI drivers")
+	}
+
+	scc.AllowHostNetwork = psp.Spec.HostNetwork
+	scc.AllowHostPID = psp.Spec.HostPID
+	scc.AllowHostIPC = psp.Spec.HostIPC
+	scc.AllowHostPorts = len(psp.Spec.HostPorts) > 0
+
+	if scc.AllowHostPorts && !(len(psp.Spec.HostPorts) == 1 && psp.Spec.HostPorts[0].Min == 0 && psp.Spec.HostPorts[0].Max == 65535) {
+		m.report.Approximated("spec.hostPorts", mutator.SeverityWarning, psp.Spec.HostPorts,
+			"SecurityContextConstraints cannot restrict the host port ranges, any host port is allowed")
+	}
+
+	scc.DefaultAllowPrivilegeEscalation = psp.Spec.DefaultAllowPrivilegeEscalation
+	scc.AllowPrivilegeEscalation = psp.Spec.AllowPrivilegeEscalation
+	scc.ReadOnlyRootFilesystem = psp.Spec.ReadOnlyRootFilesystem
+	scc.AllowedUnsafeSysctls = psp.Spec.AllowedUnsafeSysctls
+	scc.ForbiddenSysctls = psp.Spec.ForbiddenSysctls
+
+	scc.SELinuxContext.Type = security.SELinuxContextStrategyType(psp.Spec.SELinux.Rule)
+
+	if psp.Spec.SELinux.SELinuxOptions != nil {
+		scc.SELinuxContext.SELinuxOptions = psp.Spec.SELinux.SELinuxOptions.DeepCopy()
+	}
+
+	scc.RunAsUser = m.buildRunAsUser()
+	rule, ranges := m.buildGroupsStrategy("spec.supplementalGroups", string(psp.Spec.SupplementalGroups.Rule), psp.Spec.SupplementalGroups.Ranges)
+	scc.SupplementalGroups.Type = security.SupplementalGroupsStrategyType(rule)
+	scc.SupplementalGroups.Ranges = ranges
+
+	rule, ranges = m.buildGroupsStrategy("spec.fsGroup", string(psp.Spec.FSGroup.Rule), psp.Spec.FSGroup.Ranges)
+	scc.FSGroup.Type = security.FSGroupStrategyType(rule)
+	scc.FSGroup.Ranges = ranges
+
+	if psp.Spec.RunAsGroup != nil && psp.Spec.RunAsGroup.Rule != policy.RunAsGroupStrategyRunAsAny {
+		m.report.Dropped("spec.runAsGroup", mutator.SeverityWarning, *psp.Spec.RunAsGroup,
+			"SecurityContextConstraints cannot restrict the primary group")
+	}
+
+	if len(psp.Spec.AllowedProcMountTypes) > 0 {
+		m.report.Dropped("spec.allowedProcMountTypes", mutator.SeverityWarning, psp.Spec.AllowedProcMountTypes,
+			"SecurityContextConstraints only allow the default proc mount")
+	}
+
+	if psp.Spec.RuntimeClass != nil {
+		m.report.Dropped("spec.runtimeClass", mutator.SeverityWarning, *psp.Spec.RuntimeClass,
+			"SecurityContextConstraints cannot restrict the runtime classes")
+	}
+
+	scc.SeccompProfiles = m.buildSeccompProfiles()
+
+	return scc
+}
+
+// buildAnnotations copies the PSP annotations but the ones translated into SCC fields
+func (m *Mutator) buildAnnotations() map[string]string {
+	psp := m.input
+	annotations := map[string]string{}
+
+	for key, value := range psp.Annotations {
+		switch key {
+		case seccompAllowedProfilesAnnotation, seccompDefaultProfileAnnotation:
+		case appArmorAllowedProfilesAnnotation, appArmorDefaultProfileAnnotation:
+			m.report.Dropped("metadata.annotations."+key, mutator.SeverityWarning, value,
+				"SecurityContextConstraints cannot restrict the AppArmor profiles")
+		default:
+			annotations[key] = value
+		}
+	}
+
+	if len(annotations) == 0 {
+		return nil
+	}
+
+	return annotations
+}
+
+func (m *Mutator) buildRunAsUser() security.RunAsUserStrategyOptions {
+	psp := m.input
+	strategy := security.RunAsUserStrategyOptions{}
+
+	switch psp.Spec.RunAsUser.Rule {
+	case policy.RunAsUserStrategyMustRunAs:
+		ranges := psp.Spec.RunAsUser.Ranges
+
+		switch {
+		case len(ranges) == 0:
+			strategy.Type = security.RunAsUserStrategyMustRunAsRange
+			m.report.Defaulted("spec.runAsUser.ranges", mutator.SeverityInfo, ranges,
+				"no UID range is set, the range allocated to the namespace is used")
+		default:
+			merged := mergeRanges(ranges)
+
+			// a single range covering more UIDs would allow the UIDs between the ranges, the narrowest
+			// range is kept so the SecurityContextConstraints never allow more than the policy
+			uidRange := merged[0]
+			for _, r := range merged[1:] {
+				if r.Max-r.Min < uidRange.Max-uidRange.Min {
+					uidRange = r
+				}
+			}
+
+			if len(merged) > 1 {
+				m.report.Approximated("spec.runAsUser.ranges", mutator.SeverityHigh, ranges,
+					fmt.Sprintf("SecurityContextConstraints allow a single UID range, the narrowest range %d-%d is used "+
+						"and the UIDs of the other ranges are denied", uidRange.Min, uidRange.Max))
+			}
+
+			if uidRange.Min == uidRange.Max {
+				uid := uidRange.Min
+				strategy.Type = security.RunAsUserStrategyMustRunAs
+				strategy.UID = &uid
+			} else {
+				strategy.Type = security.RunAsUserStrategyMustRunAsRange
+				strategy.UIDRangeMin = &uidRange.Min
+				strategy.UIDRangeMax = &uidRange.Max
+			}
+		}
+	case policy.RunAsUserStrategyMustRunAsNonRoot:
+		strategy.Type = security.RunAsUserStrategyMustRunAsNonRoot
+	default:
+		strategy.Type = security.RunAsUserStrategyRunAsAny
+	}
+
+	return strategy
+}
+
+// mergeRanges returns the ranges sorted, with the overlapping and adjacent ranges merged
+func mergeRanges(ranges []policy.IDRange) []policy.IDRange {
+	sorted := append([]policy.IDRange{}, ranges...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Min < sorted[j].Min })
+
+	merged := []policy.IDRange{sorted[0]}
+	for _, r := range sorted[1:] {
+		last := &merged[len(merged)-1]
+
+		switch {
+		case r.Min > last.Max+1:
+			merged = append(merged, r)
+		case r.Max > last.Max:
+			last.Max = r.Max
+		}
+	}
+
+	return merged
+}
+
+// buildGroupsStrategy converts the supplemental groups and FSGroup rules, which share their values
+func (m *Mutator) buildGroupsStrategy(path, rule string, ranges []policy.IDRange) (string, []security.IDRange) {
+	var sccRanges []security.IDRange
+
+	for _, r := range ranges {
+		sccRanges = append(sccRanges, security.IDRange{Min: r.Min, Max: r.Max})
+	}
+
+	switch rule {
+	case string(policy.FSGroupStrategyMustRunAs):
+		return rule, sccRanges
+	case string(policy.FSGroupStrategyMayRunAs):
+		m.report.Approximated(path+".rule", mutator.SeverityWarning, rule,
+			"SecurityContextConstraints have no MayRunAs rule, MustRunAs sets a group on the pods not requesting one")
+		return string(policy.FSGroupStrategyMustRunAs), sccRanges
+	}
+
+	return string(policy.FSGroupStrategyRunAsAny), nil
+}
+
+// buildSeccompProfiles converts the seccomp annotations, the default profile being the first SCC profile
+func (m *Mutator) buildSeccompProfiles() []string {
+	psp := m.input
+	profiles := []string{}
+
+	defaultProfile := psp.Annotations[seccompDefaultProfileAnnotation]
+	if defaultProfile != "" {
+		profiles = append(profiles, defaultProfile)
+	}
+
+	for _, profile := range strings.Split(psp.Annotations[seccompAllowedProfilesAnnotation], ",") {
+		profile = strings.TrimSpace(profile)
+
+		if profile != "" && profile != defaultProfile {
+			profiles = append(profiles, profile)
+		}
+	}
+
+	if len(profiles) == 0 {
+		return nil
+	}
+
+	return profiles
+}
+
+// buildSubjects returns the users and groups bound to a role granting the use of the PodSecurityPolicy
+func (m *Mutator) buildSubjects() (users, groups []string) {
+	seen := map[string]bool{}
+
+	add := func(subject rbac.Subject, namespace string) {
+		var name string
+
+		switch subject.Kind {
+		case rbac.ServiceAccountKind:
+			if subject.Namespace != "" {
+				namespace = subject.Namespace
+			}
+
+			// only an invalid ClusterRoleBinding has a ServiceAccount subject without a namespace
+			if namespace == "" {
+				m.report.Dropped("subjects", mutator.SeverityHigh, subject.Name,
+					"ServiceAccount "+subject.Name+" has no namespace, it is not granted the SecurityContextConstraints")
+				return
+			}
+
+			name = "system:serviceaccount:" + namespace + ":" + subject.Name
+		case rbac.UserKind, rbac.GroupKind:
+			name = subject.Name
+
+			if namespace != "" && name != "system:serviceaccounts:"+namespace {
+				m.report.Approximated("subjects", mutator.SeverityHigh, name,
+					subject.Kind+" "+name+" may use the PodSecurityPolicy in namespace "+namespace+
+						" only, the SecurityContextConstraints grant applies to every namespace")
+			}
+		default:
+			return
+		}
+
+		if seen[subject.Kind+"/"+name] {
+			return
+		}
+		seen[subject.Kind+"/"+name] = true
+
+		if subject.Kind == rbac.GroupKind {
+			groups = append(groups, name)
+		} else {
+			users = append(users, name)
+		}
+	}
+
+	for _, crb := range m.rbac.ClusterRoleBindings {
+		if crb.RoleRef.Kind == "ClusterRole" && m.clusterRoleGrantsUse(crb.RoleRef.Name) {
+			for _, subject := range crb.Subjects {
+				add(subject, "")
+			}
+		}
+	}
+
+	for _, rb := range m.rbac.RoleBindings {
+		granted := false
+
+		switch rb.RoleRef.Kind {
+		case "ClusterRole":
+			granted = m.clusterRoleGrantsUse(rb.RoleRef.Name)
+		case "Role":
+			granted = m.roleGrantsUse(rb.Namespace, rb.RoleRef.Name)
+		}
+
+		if granted {
+			for _, subject := range rb.Subjects {
+				add(subject, rb.Namespace)
+			}
+		}
+	}
+
+	if len(users)+len(groups) == 0 {
+		m.report.Dropped("subjects", mutator.SeverityWarning, nil,
+			"no binding grants the use of the PodSecurityPolicy, the SecurityContextConstraints has no user nor group")
+	}
+
+	return users, groups
+}
+
+func (m *Mutator) clusterRoleGrantsUse(name string) bool {
+	for _, role := range m.rbac.ClusterRoles {
+		if role.Name == name {
+			return rulesGrantUse(role.Rules, m.input.Name)
+		}
+	}
+
+	return false
+}
+
+func (m *Mutator) roleGrantsUse(namespace, name string) bool {
+	for _, role := range m.rbac.Roles {
+		if role.Namespace == namespace && role.Name == name {
+			return rulesGrantUse(role.Rules, m.input.Name)
+		}
+	}
+
+	return false
+}
+
+// rulesGrantUse checks whether a rule allows the use of the named PodSecurityPolicy
+func rulesGrantUse(rules []rbac.PolicyRule, pspName string) bool {
+	for _, rule := range rules {
+		if matches(rule.Verbs, "use") && (matches(rule.APIGroups, "policy") || matches(rule.APIGroups, "extensions")) &&
+			matches(rule.Resources, "podsecuritypolicies") &&
+			(len(rule.ResourceNames) == 0 || matches(rule.ResourceNames, pspName)) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func matches(values []string, value string) bool {
+	for _, v := range values {
+		if v == value || v == "*" {
+			return true
+		}
+	}
+
+	return false
+}
+
+// GroupVersionKind is the kind of the source objects converted by this package
+var GroupVersionKind = policy.SchemeGroupVersion.WithKind("PodSecurityPolicy")
+
+// ObjectMutator adapts this package to the mutator.Mutator interface
+type ObjectMutator struct {
+	name string
+	log  logrus.FieldLogger
+	rbac RBAC
+}
+
+// NewObjectMutator creates a mutator.Mutator converting PodSecurityPolicy objects, granted by the given RBAC.
+// Clients of this API should set a meaningful name that can be used to easily identify the calling client.
+func NewObjectMutator(name string, log logrus.FieldLogger, rbac RBAC) *ObjectMutator {
+	return &ObjectMutator{
+		name: name,
+		log:  log,
+		rbac: rbac,
+	}
+}
+
+// Mutate converts a PodSecurityPolicy object into a SecurityContextConstraints object
+func (o *ObjectMutator) Mutate(obj runtime.Object) (*mutator.Result, error) {
+	psp := policy.PodSecurityPolicy{}
+	if err := mutator.Convert(obj, &psp); err != nil {
+		return nil, err
+	}
+
+	m := NewMutator(o.name, o.log, psp, o.rbac)
+	output, err := m.Mutate()
+	if err != nil {
+		return nil, err
+	}
+
+	return &mutator.Result{
+		Objects: []runtime.Object{&output.SecurityContextConstraints},
+		Report:  output.Report,
+	}, nil
+}
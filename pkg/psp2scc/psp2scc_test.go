@@ -0,0 +1,242 @@
+package psp2scc
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"path/filepath"
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	security "github.com/openshift/api/security/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/api/policy/v1beta1"
+	rbac "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const clientName = "testClient"
+
+func newRBAC() RBAC {
+	useRestricted := rbac.PolicyRule{
+		Verbs:         []string{"use"},
+		APIGroups:     []string{"policy"},
+		Resources:     []string{"podsecuritypolicies"},
+		ResourceNames: []string{"restricted"},
+	}
+
+	clusterRole := rbac.ClusterRole{Rules: []rbac.PolicyRule{useRestricted}}
+	clusterRole.Name = "psp:restricted"
+
+	otherRole := rbac.ClusterRole{Rules: []rbac.PolicyRule{{
+		Verbs:         []string{"use"},
+		APIGroups:     []string{"policy"},
+		Resources:     []string{"podsecuritypolicies"},
+		ResourceNames: []string{"privileged"},
+	}}}
+	otherRole.Name = "psp:privileged"
+
+	role := rbac.Role{Rules: []rbac.PolicyRule{{Verbs: []string{"*"}, APIGroups: []string{"*"}, Resources: []string{"*"}}}}
+	role.Name = "admin"
+	role.Namespace = "web"
+
+	crb := rbac.ClusterRoleBinding{
+		RoleRef: rbac.RoleRef{Kind: "ClusterRole", Name: "psp:restricted"},
+		Subjects: []rbac.Subject{
+			{Kind: "Group", Name: "system:authenticated"},
+			{Kind: "ServiceAccount", Name: "default", Namespace: "api"},
+		},
+	}
+
+	otherCrb := rbac.ClusterRoleBinding{
+		RoleRef:  rbac.RoleRef{Kind: "ClusterRole", Name: "psp:privileged"},
+		Subjects: []rbac.Subject{{Kind: "User", Name: "admin"}},
+	}
+
+	rb := rbac.RoleBinding{
+		RoleRef: rbac.RoleRef{Kind: "Role", Name: "admin"},
+		Subjects: []rbac.Subject{
+			{Kind: "ServiceAccount", Name: "deployer"},
+			{Kind: "User", Name: "alice"},
+			{Kind: "Group", Name: "system:serviceaccounts:web"},
+		},
+	}
+	rb.Namespace = "web"
+
+	return RBAC{
+		ClusterRoles:        []rbac.ClusterRole{clusterRole, otherRole},
+		Roles:               []rbac.Role{role},
+		ClusterRoleBindings: []rbac.ClusterRoleBinding{crb, otherCrb},
+		RoleBindings:        []rbac.RoleBinding{rb},
+	}
+}
+
+func TestMutate(t *testing.T) {
+	m := newMutatorFromFileData(t, "restricted.json", newRBAC())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	scc := output.SecurityContextConstraints
+
+	assert.Equal(t, "SecurityContextConstraints", scc.Kind)
+	assert.Equal(t, "security.openshift.io/v1", scc.APIVersion)
+	assert.Equal(t, "restricted", scc.Name)
+	assert.Equal(t, "testval", scc.Labels["testkey"])
+	assert.Equal(t, map[string]string{"kubernetes.io/description": "restricted PSP test data"}, scc.Annotations)
+
+	assert.False(t, scc.AllowPrivilegedContainer)
+	assert.False(t, *scc.AllowPrivilegeEscalation)
+	assert.True(t, scc.AllowHostDirVolumePlugin)
+	assert.True(t, scc.AllowHostPorts)
+	assert.Equal(t, 7, len(scc.Volumes))
+
+	assert.Equal(t, security.RunAsUserStrategyMustRunAsRange, scc.RunAsUser.Type)
+	assert.Equal(t, int64(1000), *scc.RunAsUser.UIDRangeMin)
+	assert.Equal(t, int64(2000), *scc.RunAsUser.UIDRangeMax)
+	assert.Equal(t, security.SELinuxStrategyRunAsAny, scc.SELinuxContext.Type)
+	assert.Equal(t, security.SupplementalGroupsStrategyMustRunAs, scc.SupplementalGroups.Type)
+	assert.Equal(t, security.FSGroupStrategyMustRunAs, scc.FSGroup.Type)
+	assert.Equal(t, []security.IDRange{{Min: 1, Max: 65535}}, scc.FSGroup.Ranges)
+
+	assert.Equal(t, []string{"runtime/default", "docker/default"}, scc.SeccompProfiles)
+
+	assert.Equal(t, []string{"system:serviceaccount:api:default", "system:serviceaccount:web:deployer", "alice"}, scc.Users)
+	assert.Equal(t, []string{"system:authenticated", "system:serviceaccounts:web"}, scc.Groups)
+
+	paths := []string{}
+	for _, entry := range output.Report.Entries {
+		paths = append(paths, entry.Path)
+	}
+
+	assert.ElementsMatch(t, []string{
+		"metadata.annotations.apparmor.security.beta.kubernetes.io/allowedProfileNames",
+		"spec.allowedHostPaths",
+		"spec.hostPorts",
+		"spec.runAsUser.ranges",
+		"spec.fsGroup.rule",
+		"subjects",
+	}, paths)
+
+	// alice may only use the policy in the web namespace
+	subjects := output.Report.AtLeast(mutator.SeverityHigh)
+	assert.Equal(t, "alice", subjects[len(subjects)-1].Original)
+}
+
+func TestMutateSingleUID(t *testing.T) {
+	psp := v1beta1.PodSecurityPolicy{}
+	psp.Name = "single"
+	psp.Spec.RunAsUser.Rule = v1beta1.RunAsUserStrategyMustRunAs
+	psp.Spec.RunAsUser.Ranges = []v1beta1.IDRange{{Min: 1001, Max: 1001}}
+
+	m := NewMutator(clientName, logrus.New(), psp, RBAC{})
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	scc := output.SecurityContextConstraints
+	assert.Equal(t, security.RunAsUserStrategyMustRunAs, scc.RunAsUser.Type)
+	assert.Equal(t, int64(1001), *scc.RunAsUser.UID)
+	assert.Equal(t, 0, len(scc.Users)+len(scc.Groups))
+	assert.Equal(t, mutator.ActionDropped, output.Report.Entries[0].Action)
+
+	m = NewMutator(clientName, logrus.New(), v1beta1.PodSecurityPolicy{}, RBAC{})
+	_, err = m.Mutate()
+	assert.Error(t, err)
+}
+
+func TestMutateServiceAccountWithoutNamespace(t *testing.T) {
+	rbacs := newRBAC()
+	rbacs.ClusterRoleBindings[0].Subjects = append(rbacs.ClusterRoleBindings[0].Subjects,
+		rbac.Subject{Kind: "ServiceAccount", Name: "builder"})
+
+	m := newMutatorFromFileData(t, "restricted.json", rbacs)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.NotContains(t, output.SecurityContextConstraints.Users, "system:serviceaccount::builder")
+	assert.Equal(t, []string{"system:serviceaccount:api:default", "system:serviceaccount:web:deployer", "alice"},
+		output.SecurityContextConstraints.Users)
+
+	dropped := false
+	for _, entry := range output.Report.Entries {
+		if entry.Path == "subjects" && entry.Action == mutator.ActionDropped {
+			dropped = true
+			assert.Equal(t, "builder", entry.Original)
+			assert.Equal(t, mutator.SeverityHigh, entry.Severity)
+		}
+	}
+	assert.True(t, dropped)
+}
+
+func TestMutateUIDRanges(t *testing.T) {
+	tests := []struct {
+		name     string
+		ranges   []v1beta1.IDRange
+		min, max int64
+		reported bool
+	}{
+		{"adjacent ranges", []v1beta1.IDRange{{Min: 2001, Max: 3000}, {Min: 1000, Max: 2000}}, 1000, 3000, false},
+		{"overlapping ranges", []v1beta1.IDRange{{Min: 1000, Max: 2500}, {Min: 2000, Max: 3000}, {Min: 1500, Max: 1600}}, 1000, 3000, false},
+		{"separate ranges", []v1beta1.IDRange{{Min: 1000, Max: 5000}, {Min: 7000, Max: 7100}}, 7000, 7100, true},
+	}
+
+	for _, tc := range tests {
+		psp := v1beta1.PodSecurityPolicy{}
+		psp.Name = "ranges"
+		psp.Spec.RunAsUser.Rule = v1beta1.RunAsUserStrategyMustRunAs
+		psp.Spec.RunAsUser.Ranges = tc.ranges
+
+		m := NewMutator(clientName, logrus.New(), psp, RBAC{})
+		output, err := m.Mutate()
+		assert.NoError(t, err, tc.name)
+
+		runAsUser := output.SecurityContextConstraints.RunAsUser
+		assert.Equal(t, security.RunAsUserStrategyMustRunAsRange, runAsUser.Type, tc.name)
+		assert.Equal(t, tc.min, *runAsUser.UIDRangeMin, tc.name)
+		assert.Equal(t, tc.max, *runAsUser.UIDRangeMax, tc.name)
+
+		reported := false
+		for _, entry := range output.Report.Entries {
+			if entry.Path == "spec.runAsUser.ranges" {
+				reported = true
+				assert.Equal(t, mutator.SeverityHigh, entry.Severity, tc.name)
+			}
+		}
+		assert.Equal(t, tc.reported, reported, tc.name)
+	}
+}
+
+func TestObjectMutator(t *testing.T) {
+	pspFile, err := ioutil.ReadFile(filepath.Join("testdata", "restricted.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal(pspFile, &obj.Object); err != nil {
+		t.Fatal(err)
+	}
+
+	r := mutator.NewRegistry()
+	assert.NoError(t, r.Register(GroupVersionKind, NewObjectMutator(clientName, logrus.New(), newRBAC())))
+
+	result, err := r.Mutate(obj)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(result.Objects))
+	assert.Equal(t, "restricted", result.Objects[0].(*security.SecurityContextConstraints).Name)
+	assert.Equal(t, mutator.SeverityHigh, result.Report.MaxSeverity())
+}
+
+func newMutatorFromFileData(t *testing.T, fileName string, rbac RBAC) Mutator {
+	pspFile, err := ioutil.ReadFile(filepath.Join("testdata", fileName))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	psp := v1beta1.PodSecurityPolicy{}
+	if err := json.Unmarshal(pspFile, &psp); err != nil {
+		t.Errorf("Failed to unmarshall PodSecurityPolicy JSON = %v", err)
+	}
+
+	return NewMutator(clientName, logrus.New(), psp, rbac)
+}
@@ -2,8 +2,11 @@ package route2httpproxy
 
 import (
 	"encoding/base64"
+	"encoding/json"
 	"errors"
+	"fmt"
 
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
 	routev1API "github.com/openshift/api/route/v1"
 	contourv1 "github.com/projectcontour/contour/apis/projectcontour/v1"
 
@@ -12,12 +15,12 @@ import (
 	"github.com/sirupsen/logrus"
 	core "k8s.io/api/core/v1"
 	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
 // declare a list of OCP routes Spec fields that are not supported in httpproxy
 var (
 	ocpRouteWildCardPolicy                = "Route.Spec.WildCardPolicy"
-	ocpRouteWeight                        = "Route.Spec.Weight"
 	ocpRouteAlternateBackends             = "Route.Spec.AlternateBackends"
 	ocpRouteInsecureEdgeTerminationPolicy = "Route.Spec.InsecureEdgeTerminationPolicy"
 	ocpRouteDestinationCACertificate      = "Route.Spec.DestinationCACertificate"
@@ -31,26 +34,97 @@ func checkError(pluginName string, log logrus.FieldLogger, msgString string, err
 	}
 }
 
-func unsupportedField(pluginName string, log logrus.FieldLogger, msgString string) {
-	// maybe only print out if log level is debug or ...
-	log.Warnf("[%s] %s %s", pluginName, msgString, "unsupported")
-}
+// annotateUnsupported marks the OCP Route fields that are set but not converted into the HTTPProxy.
+// The annotation value is the JSON encoded original value so the information travels with the HTTPProxy.
+func (m *Mutator) annotateUnsupported() map[string]string {
+	ocpRoute := m.input
+
+	annotations := make(map[string]string, len(ocpRoute.Annotations))
+	for key, value := range ocpRoute.Annotations {
+		annotations[key] = value
+	}
+
+	annotateUnsupportedField := func(field string, entry mutator.Entry) {
+		value, err := json.Marshal(entry.Original)
+		if err != nil {
+			m.log.Errorf("[%s] cannot encode %s: %v", m.name, entry.Path, err)
+			return
+		}
 
-// append the list of unsupported fields
-func annotateUnsupported(pluginName string, src routev1API.Route) map[string]string {
+		annotations[m.name+"/"+field] = string(value)
+		m.report.Add(entry)
+	}
 
-	annotations := src.GetAnnotations()
+	if ocpRoute.Spec.WildcardPolicy != "" && ocpRoute.Spec.WildcardPolicy != routev1API.WildcardPolicyNone {
+		annotateUnsupportedField(ocpRouteWildCardPolicy, mutator.Entry{
+			Path:     "spec.wildcardPolicy",
+			Action:   mutator.ActionDropped,
+			Severity: mutator.SeverityHigh,
+			Original: ocpRoute.Spec.WildcardPolicy,
+			Message:  "the HTTPProxy only serves its own host, not the wildcard subdomains",
+		})
+	}
 
-	if annotations == nil {
-		annotations = make(map[string]string)
+	// the alternate backends without Service are not converted, the router answered their share of the
+	// traffic with errors
+	missingBackends := []routev1API.RouteTargetReference{}
+	missingNames := []string{}
+	for _, backend := range ocpRoute.Spec.AlternateBackends {
+		if _, found := m.lookupService(backend); !found {
+			missingBackends = append(missingBackends, backend)
+			missingNames = append(missingNames, backend.Kind+" "+backend.Name)
+		}
 	}
 
-	annotations[pluginName+"/"+ocpRouteWildCardPolicy] = "unsupported"
-	annotations[pluginName+"/"+ocpRouteWeight] = "unsupported"
-	annotations[pluginName+"/"+ocpRouteAlternateBackends] = "unsupported"
-	annotations[pluginName+"/"+ocpRouteInsecureEdgeTerminationPolicy] = "unsupported"
-	annotations[pluginName+"/"+ocpRouteDestinationCACertificate] = "unsupported"
-	annotations[pluginName+"/"+ocpRouteCACertificate] = "unsupported"
+	if len(missingBackends) > 0 {
+		annotateUnsupportedField(ocpRouteAlternateBackends, mutator.Entry{
+			Path:     "spec.alternateBackends",
+			Action:   mutator.ActionDropped,
+			Severity: mutator.SeverityHigh,
+			Original: missingBackends,
+			Message:  strings.Join(missingNames, ", ") + " not found, the share of the traffic is sent to the other backends",
+		})
+	}
+
+	if ocpRoute.Spec.TLS != nil {
+		policy := ocpRoute.Spec.TLS.InsecureEdgeTerminationPolicy
+
+		// Contour redirects HTTP to HTTPS on TLS virtual hosts, which is what Redirect asks for
+		if policy != "" && policy != routev1API.InsecureEdgeTerminationPolicyRedirect {
+			severity := mutator.SeverityInfo
+			if policy == routev1API.InsecureEdgeTerminationPolicyAllow {
+				severity = mutator.SeverityWarning
+			}
+
+			annotateUnsupportedField(ocpRouteInsecureEdgeTerminationPolicy, mutator.Entry{
+				Path:     "spec.tls.insecureEdgeTerminationPolicy",
+				Action:   mutator.ActionApproximated,
+				Severity: severity,
+				Original: policy,
+				Message:  "insecure traffic is redirected to HTTPS",
+			})
+		}
+
+		if ocpRoute.Spec.TLS.DestinationCACertificate != "" {
+			annotateUnsupportedField(ocpRouteDestinationCACertificate, mutator.Entry{
+				Path:     "spec.tls.destinationCACertificate",
+				Action:   mutator.ActionDropped,
+				Severity: mutator.SeverityWarning,
+				Original: ocpRoute.Spec.TLS.DestinationCACertificate,
+				Message:  "the destination CA certificate is not used to validate the backend",
+			})
+		}
+
+		if ocpRoute.Spec.TLS.CACertificate != "" {
+			annotateUnsupportedField(ocpRouteCACertificate, mutator.Entry{
+				Path:     "spec.tls.caCertificate",
+				Action:   mutator.ActionDropped,
+				Severity: mutator.SeverityInfo,
+				Original: ocpRoute.Spec.TLS.CACertificate,
+				Message:  "the CA certificate is not part of the generated Secret",
+			})
+		}
+	}
 
 	return annotations
 }
@@ -58,9 +132,7 @@ func annotateUnsupported(pluginName string, src routev1API.Route) map[string]str
 // translateRoute will return a route structure element for the HTTPProxy.Spec.Routes based on OCP RouteTargetRef
 // The main RouteTargetRef is Route.Spec.To, the alternate routes are under Route.Spec.AlternateBackends
 // One service object is required per RouteTargetRef
-// Today, this function is written only to return a single element, which is the translation of Route.Spec.To
-// TO DO : Make this function to return an array of httpproxy routes, including to parse Route.Spec.AlternateBackends
-// TO DO : Handle weight to be extracted from OCP Route into HTTPProxy Route
+// This function returns the translation of Route.Spec.To, translateBackends adds the alternate backends
 // TO DO : Handle OCP InsecureEdgeTerminationPolicy Allow as permitInsecure
 func translateRoute(pluginName string, log logrus.FieldLogger, ocpRoute routev1API.Route, service core.Service) (*contourv1.Route, error) {
 
@@ -80,14 +152,32 @@ func translateRoute(pluginName string, log logrus.FieldLogger, ocpRoute routev1A
 		return nil, myErr
 	}
 
-	// TODO: handle weights
-	// https://projectcontour.io/docs/main/config/request-routing/#upstream-weighting
-	// it must go along with AlternateBackends
-	if ocpRoute.Spec.To.Weight != nil {
-		log.Debugf("[%s] OCP Route %s has weights defined. This mutation does not support weights and they will be ignored.", pluginName, ocpRoute.Name)
+	matchedPort, err := servicePort(pluginName, log, ocpRoute, service)
+	if err != nil {
+		return nil, err
+	}
+
+	// The httpproxy service name
+	httpproxySvc := contourv1.Service{
+		Name: service.Name,
+	}
+
+	// the port of httpproxy service must be in integer
+	httpproxySvc.Port = int(matchedPort)
 
+	httpproxyRoute := contourv1.Route{}
+	if ocpRoute.Spec.Path != "" {
+		httpproxyRoute.Conditions = append(httpproxyRoute.Conditions, contourv1.MatchCondition{Prefix: ocpRoute.Spec.Path})
 	}
 
+	httpproxyRoute.Services = append(httpproxyRoute.Services, httpproxySvc)
+	log.Debugf("[%s] httpproxy Services array %#v", pluginName, httpproxyRoute.Services)
+
+	return &httpproxyRoute, nil
+}
+
+// servicePort returns the port of the service matching the OCP Route port
+func servicePort(pluginName string, log logrus.FieldLogger, ocpRoute routev1API.Route, service core.Service) (int32, error) {
 	// Route.Spec.Port: If specified, it is the port used by the OCP router.
 	// This is the value we want on httpproxy port
 	// but we have to look it up on the service object
@@ -118,32 +208,80 @@ func translateRoute(pluginName string, log logrus.FieldLogger, ocpRoute routev1A
 		}
 		if matchedPort == 0 {
 			log.Errorf("[%s] translateRoute cannot match Route.Spec.Port %#v with Service object %#v", pluginName, ocpRoute.Spec.Port, service.Spec.Ports)
-			myErr := errors.New("translateRoute cannot match Route.Spec.Port with Service object")
-			return nil, myErr
+			return 0, fmt.Errorf("translateRoute cannot match Route.Spec.Port with Service object %s", service.Name)
 		}
 	} else {
 		// Route.Spec.Port is not defined, picking the first Port from Service object
+		if serviceNumberPorts == 0 {
+			log.Errorf("[%s] translateRoute cannot pick a port, Service object %s has no ports", pluginName, service.Name)
+			return 0, fmt.Errorf("translateRoute cannot pick a port, Service object %s has no ports", service.Name)
+		}
 		matchedPort = service.Spec.Ports[0].Port
 	}
 	log.Debugf("[%s] This is the matched port to be used: %v\n", pluginName, matchedPort)
 
-	// The httpproxy service name
-	httpproxySvc := contourv1.Service{
-		Name: service.Name,
+	return matchedPort, nil
+}
+
+// routeWeight returns the weight of an OCP Route backend, the OCP router defaults it to 100
+func routeWeight(weight *int32) int64 {
+	if weight == nil {
+		return 100
 	}
 
-	// the port of httpproxy service must be in integer
-	httpproxySvc.Port = int(matchedPort)
+	return int64(*weight)
+}
 
-	httpproxyRoute := contourv1.Route{}
-	if ocpRoute.Spec.Path != "" {
-		httpproxyRoute.Conditions[0].Prefix = ocpRoute.Spec.Path
+// translateBackends adds the services of the alternate backends to the httpproxy route and sets the
+// weight of every service from the OCP Route weights. The alternate backends without Service are skipped,
+// annotateUnsupported reports them.
+func (m *Mutator) translateBackends(hpRoute *contourv1.Route) error {
+	ocpRoute := m.input
+
+	if len(ocpRoute.Spec.AlternateBackends) == 0 {
+		// a single backend gets all the traffic whatever its weight, unless it is zero
+		if weight := ocpRoute.Spec.To.Weight; weight != nil && *weight == 0 {
+			m.report.Approximated("spec.to.weight", mutator.SeverityHigh, *weight,
+				"the OCP Route serves no traffic with a zero weight, the HTTPProxy sends all the traffic to spec.to")
+		}
+
+		return nil
 	}
 
-	httpproxyRoute.Services = append(httpproxyRoute.Services, httpproxySvc)
-	log.Debugf("[%s] httpproxy Services array %#v", pluginName, httpproxyRoute.Services)
+	hpRoute.Services[0].Weight = routeWeight(ocpRoute.Spec.To.Weight)
 
-	return &httpproxyRoute, nil
+	for _, backend := range ocpRoute.Spec.AlternateBackends {
+		service, found := m.lookupService(backend)
+		if !found {
+			continue
+		}
+
+		port, err := servicePort(m.name, m.log, ocpRoute, service)
+		if err != nil {
+			return err
+		}
+
+		hpRoute.Services = append(hpRoute.Services, contourv1.Service{
+			Name:   service.Name,
+			Port:   int(port),
+			Weight: routeWeight(backend.Weight),
+		})
+	}
+
+	// Contour splits the traffic evenly when no service has a weight
+	totalWeight := int64(0)
+	for _, service := range hpRoute.Services {
+		totalWeight += service.Weight
+	}
+
+	if totalWeight == 0 {
+		m.report.Approximated("spec.to.weight", mutator.SeverityHigh, int64(0),
+			"the OCP Route serves no traffic when every backend has a zero weight, the HTTPProxy splits it evenly")
+	}
+
+	m.log.Debugf("[%s] httpproxy weighted Services %#v", m.name, hpRoute.Services)
+
+	return nil
 }
 
 func createSecret(pluginName string, log logrus.FieldLogger, ocpRoute routev1API.Route) (*core.Secret, error) {
@@ -176,33 +314,75 @@ func createSecret(pluginName string, log logrus.FieldLogger, ocpRoute routev1API
 
 }
 
-// Mutate converts an OpenShift (OCP) Route to Contour HTTProxy
-// If OCP route has a certificate, returns it as a secret
-// TO DO: Support OCP Route.Spec.AlternateBackends
-// TO DO : Handle OCP InsecureEdgeTerminationPolicy Allow as permitInsecure
-func Mutate(pluginName string, log logrus.FieldLogger, ocpRoute routev1API.Route, service core.Service, domain string) (*contourv1.HTTPProxy, *core.Secret, error) {
+// MutatorOutput contains the mutated output structures. Secret is only set when the OCP Route
+// carries its own certificate and key.
+type MutatorOutput struct {
+	HTTPProxy contourv1.HTTPProxy
+	Secret    *core.Secret
+	Report    mutator.Report
+}
 
-	log.Debugf("[%s] ocpRoute %#v", pluginName, ocpRoute)
+// Mutator contains common atttributes and the mutation input source structures
+type Mutator struct {
+	name     string
+	log      logrus.FieldLogger
+	input    routev1API.Route
+	services []core.Service
+	domain   string
+	report   mutator.Report
+}
 
-	if service.Namespace != ocpRoute.Namespace {
-		log.Errorf("[%s] The namespace of service is %s and the namespace of OCP Route is %s. They need to match.", pluginName, service.Namespace, ocpRoute.Namespace)
-		return nil, nil, errors.New("namespace of service and namespace of OCP Route do not match")
+// NewMutator creates a new Mutator. Clients of this API should set a meaningful name that can be used
+// to easily identify the calling client. The services are looked up by the namespace and names of the
+// Route.Spec.To and Route.Spec.AlternateBackends, domain is the new wildcard DNS domain, empty to keep
+// the OCP Route host.
+func NewMutator(name string, log logrus.FieldLogger, ocpRoute routev1API.Route, services []core.Service, domain string) Mutator {
+	return Mutator{
+		name:     name,
+		log:      log,
+		input:    ocpRoute,
+		services: services,
+		domain:   domain,
 	}
+}
 
-	if ocpRoute.Spec.AlternateBackends != nil {
-		log.Warnf("[%s] OCP Route %s has AlternateBackends defined. This mutation does not support them and they will be ignored.", pluginName, ocpRoute.Name)
+// Mutate converts an OpenShift (OCP) Route to Contour HTTPProxy and, if the OCP Route has a certificate, a Secret
+func (m *Mutator) Mutate() (*MutatorOutput, error) {
+	m.report = mutator.Report{}
+
+	hp, secret, err := m.buildHTTPProxy()
+	if err != nil {
+		return nil, err
 	}
 
-	// Check if the OCP Route allows HTTP
-	// TODO: Decide the mutation.
-	if ocpRoute.Spec.TLS != nil {
-		if (ocpRoute.Spec.TLS.InsecureEdgeTerminationPolicy != "") && (ocpRoute.Spec.TLS.InsecureEdgeTerminationPolicy == "Allow") {
-			log.Warnf("[%s] OCP Route %s InsecureEdgeTerminationPolicy is set as Allow. This mutation does not support it and it will default to HTTPS redirect.", pluginName, ocpRoute.Name)
-		}
+	return &MutatorOutput{
+		HTTPProxy: *hp,
+		Secret:    secret,
+		Report:    m.report,
+	}, nil
+}
 
-		if ocpRoute.Spec.TLS.DestinationCACertificate != "" {
-			log.Warnf("[%s] OCP Route %s has DestinationCACertificate set. This mutation does not support it and it will ignore it.", pluginName, ocpRoute.Name)
-		}
+// Mutate converts an OpenShift (OCP) Route to Contour HTTProxy
+// If OCP route has a certificate, returns it as a secret
+// It is kept for existing callers, new code should use NewMutator.
+func Mutate(pluginName string, log logrus.FieldLogger, ocpRoute routev1API.Route, service core.Service, domain string) (*contourv1.HTTPProxy, *core.Secret, error) {
+	m := NewMutator(pluginName, log, ocpRoute, []core.Service{service}, domain)
+
+	return m.buildHTTPProxy()
+}
+
+// buildHTTPProxy converts the OCP Route
+// TO DO : Handle OCP InsecureEdgeTerminationPolicy Allow as permitInsecure
+func (m *Mutator) buildHTTPProxy() (*contourv1.HTTPProxy, *core.Secret, error) {
+	ocpRoute := m.input
+	domain := m.domain
+
+	m.log.Debugf("[%s] ocpRoute %#v", m.name, ocpRoute)
+
+	service, found := m.lookupService(ocpRoute.Spec.To)
+	if !found {
+		m.log.Errorf("[%s] The service %s referenced by the OCP Route is not in the namespace %s.", m.name, ocpRoute.Spec.To.Name, ocpRoute.Namespace)
+		return nil, nil, fmt.Errorf("service %s/%s referenced by route %s not found", ocpRoute.Namespace, ocpRoute.Spec.To.Name, ocpRoute.Name)
 	}
 
 	hp := contourv1.HTTPProxy{}
@@ -212,20 +392,25 @@ func Mutate(pluginName string, log logrus.FieldLogger, ocpRoute routev1API.Route
 	hp.APIVersion = "projectcontour.io/v1"
 	hp.Name = ocpRoute.Name
 	hp.Namespace = ocpRoute.Namespace
-	hp.Annotations = annotateUnsupported(pluginName, ocpRoute)
+	hp.Annotations = m.annotateUnsupported()
 	hp.Labels = ocpRoute.Labels
 
 	// Start building the httpproxy Spec
 
 	// We need to convert the RouteTargetRef from OCP Route in the format of httpproxy route
-	hpTranslatedRoute, err := translateRoute(pluginName, log, ocpRoute, service)
+	hpTranslatedRoute, err := translateRoute(m.name, m.log, ocpRoute, service)
 	if err != nil {
-		log.Errorf("[%s] Error in parsing the OCP Route and Service.", pluginName)
+		m.log.Errorf("[%s] Error in parsing the OCP Route and Service.", m.name)
+		return nil, nil, err
+	}
+
+	if err := m.translateBackends(hpTranslatedRoute); err != nil {
+		m.log.Errorf("[%s] Error in parsing the OCP Route alternate backends.", m.name)
 		return nil, nil, err
 	}
 
 	hp.Spec.Routes = append(hp.Spec.Routes, *hpTranslatedRoute)
-	log.Debugf("[%s] httpproxy translated routes: %#v", pluginName, hp.Spec.Routes)
+	m.log.Debugf("[%s] httpproxy translated routes: %#v", m.name, hp.Spec.Routes)
 
 	// Handling the wildcard DNS domain
 	var httpproxyFqdn string
@@ -242,12 +427,13 @@ func Mutate(pluginName string, log logrus.FieldLogger, ocpRoute routev1API.Route
 	} else {
 		// user did not specify the new wild card DNS
 		httpproxyFqdn = ocpRoute.Spec.Host
-		log.Warnf("[%s] No new wildcard DNS domain specified. This mutation will use original domain from OCP route %s.", pluginName, httpproxyFqdn)
+		m.report.Defaulted("spec.host", mutator.SeverityInfo, httpproxyFqdn,
+			"no new wildcard DNS domain specified, the original domain from the OCP Route is used")
 
 	}
 
 	//extract the Prefix of OCP route
-	log.Debugf("[%s] FQDN of the httpproxy will be set to:] %s", pluginName, httpproxyFqdn)
+	m.log.Debugf("[%s] FQDN of the httpproxy will be set to:] %s", m.name, httpproxyFqdn)
 
 	hp.Spec.VirtualHost = &contourv1.VirtualHost{
 		Fqdn: httpproxyFqdn,
@@ -256,7 +442,7 @@ func Mutate(pluginName string, log logrus.FieldLogger, ocpRoute routev1API.Route
 	// Handling TLS
 	if ocpRoute.Spec.TLS != nil {
 
-		log.Debugf("[%s] OCP route TLS is set and termination is %s", pluginName, ocpRoute.Spec.TLS.Termination)
+		m.log.Debugf("[%s] OCP route TLS is set and termination is %s", m.name, ocpRoute.Spec.TLS.Termination)
 
 		if ocpRoute.Spec.TLS.Termination == "passthrough" {
 			hp.Spec.VirtualHost.TLS = &contourv1.TLS{
@@ -266,10 +452,10 @@ func Mutate(pluginName string, log logrus.FieldLogger, ocpRoute routev1API.Route
 
 		if ocpRoute.Spec.TLS.Termination == "edge" || ocpRoute.Spec.TLS.Termination == "reencrypt" {
 			if ocpRoute.Spec.TLS.Certificate != "" && ocpRoute.Spec.TLS.Key != "" {
-				log.Debugf("[%s] OCP route has certs and keys, generating secret.", pluginName)
-				hpSecret, err := createSecret(pluginName, log, ocpRoute)
+				m.log.Debugf("[%s] OCP route has certs and keys, generating secret.", m.name)
+				hpSecret, err := createSecret(m.name, m.log, ocpRoute)
 				if err != nil {
-					log.Errorf("[%s] Error in creating the secret.", pluginName)
+					m.log.Errorf("[%s] Error in creating the secret.", m.name)
 					return nil, nil, err
 				}
 				hp.Spec.VirtualHost.TLS = &contourv1.TLS{
@@ -282,3 +468,66 @@ func Mutate(pluginName string, log logrus.FieldLogger, ocpRoute routev1API.Route
 	}
 	return &hp, nil, nil
 }
+
+// GroupVersionKind is the kind of the source objects converted by this package
+var GroupVersionKind = routev1API.GroupVersion.WithKind("Route")
+
+// ObjectMutator adapts this package to the mutator.Mutator interface
+type ObjectMutator struct {
+	name     string
+	log      logrus.FieldLogger
+	services []core.Service
+	domain   string
+}
+
+// NewObjectMutator creates a mutator.Mutator converting Route objects. Services are looked up by the
+// namespace and name referenced by each Route, domain is the new wildcard DNS domain.
+// Clients of this API should set a meaningful name that can be used to easily identify the calling client.
+func NewObjectMutator(name string, log logrus.FieldLogger, services []core.Service, domain string) *ObjectMutator {
+	return &ObjectMutator{
+		name:     name,
+		log:      log,
+		services: services,
+		domain:   domain,
+	}
+}
+
+// Mutate converts a Route object into a HTTPProxy object and, if the Route has a certificate, a Secret object
+func (o *ObjectMutator) Mutate(obj runtime.Object) (*mutator.Result, error) {
+	ocpRoute := routev1API.Route{}
+	if err := mutator.Convert(obj, &ocpRoute); err != nil {
+		return nil, err
+	}
+
+	m := NewMutator(o.name, o.log, ocpRoute, o.services, o.domain)
+	output, err := m.Mutate()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &mutator.Result{
+		Objects: []runtime.Object{&output.HTTPProxy},
+		Report:  output.Report,
+	}
+
+	if output.Secret != nil {
+		result.Objects = append(result.Objects, output.Secret)
+	}
+
+	return result, nil
+}
+
+// lookupService returns the service of an OCP Route backend, in the namespace of the OCP Route
+func (m *Mutator) lookupService(backend routev1API.RouteTargetReference) (core.Service, bool) {
+	if backend.Kind != "Service" {
+		return core.Service{}, false
+	}
+
+	for _, service := range m.services {
+		if service.Namespace == m.input.Namespace && service.Name == backend.Name {
+			return service, true
+		}
+	}
+
+	return core.Service{}, false
+}
@@ -7,7 +7,9 @@ import (
 	"path/filepath"
 	"testing"
 
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
 	route "github.com/openshift/api/route/v1"
+	contourv1 "github.com/projectcontour/contour/apis/projectcontour/v1"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	core "k8s.io/api/core/v1"
@@ -94,6 +96,157 @@ func TestDeployment(t *testing.T) {
 	}
 }
 
+func TestObjectMutator(t *testing.T) {
+	routeInput, serviceInput := newMutatorFromFileData(t, "route_with_tls.json", "service-input.json", t.Name())
+
+	r := mutator.NewRegistry()
+	assert.NoError(t, r.Register(GroupVersionKind, NewObjectMutator("testClient", logrus.New(), []core.Service{serviceInput}, "")))
+
+	result, err := r.Mutate(&routeInput)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(result.Objects))
+	assert.Equal(t, routeInput.Name, result.Objects[0].(*contourv1.HTTPProxy).Name)
+	assert.Equal(t, "hpsecret-"+routeInput.Name, result.Objects[1].(*core.Secret).Name)
+
+	m := NewObjectMutator("testClient", logrus.New(), nil, "")
+	_, err = m.Mutate(&routeInput)
+	assert.Error(t, err)
+}
+
+func TestMutateReport(t *testing.T) {
+	routeInput, serviceInput := newMutatorFromFileData(t, "route_with_tls.json", "service-input.json", t.Name())
+	routeInput.Spec.TLS.InsecureEdgeTerminationPolicy = route.InsecureEdgeTerminationPolicyAllow
+	routeInput.Spec.AlternateBackends = []route.RouteTargetReference{{Kind: "Service", Name: "other"}}
+
+	m := NewMutator("testClient", logrus.New(), routeInput, []core.Service{serviceInput}, "")
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	paths := []string{}
+	for _, entry := range output.Report.Entries {
+		paths = append(paths, entry.Path)
+	}
+
+	assert.ElementsMatch(t, []string{"spec.alternateBackends", "spec.tls.insecureEdgeTerminationPolicy", "spec.tls.caCertificate", "spec.host"}, paths)
+	assert.Equal(t, mutator.SeverityHigh, output.Report.MaxSeverity())
+	assert.Equal(t, `"Allow"`, output.HTTPProxy.Annotations["testClient/"+ocpRouteInsecureEdgeTerminationPolicy])
+	assert.Equal(t, `[{"kind":"Service","name":"other","weight":null}]`, output.HTTPProxy.Annotations["testClient/"+ocpRouteAlternateBackends])
+}
+
+func TestAnnotateUnsupportedOnlySetFields(t *testing.T) {
+	routeInput, serviceInput := newMutatorFromFileData(t, "route_without_tls.json", "service-input.json", t.Name())
+
+	m := NewMutator("testClient", logrus.New(), routeInput, []core.Service{serviceInput}, "*.migrator.servicemesh.biz")
+	output, err := m.Mutate()
+
+	assert.NoError(t, err)
+	assert.Equal(t, routeInput.Annotations, output.HTTPProxy.Annotations)
+	assert.Equal(t, 0, len(output.Report.Entries))
+
+	routeInput.Spec.WildcardPolicy = route.WildcardPolicySubdomain
+
+	m = NewMutator("testClient", logrus.New(), routeInput, []core.Service{serviceInput}, "*.migrator.servicemesh.biz")
+	output, err = m.Mutate()
+
+	assert.NoError(t, err)
+	assert.Equal(t, len(routeInput.Annotations)+1, len(output.HTTPProxy.Annotations))
+	assert.Equal(t, `"Subdomain"`, output.HTTPProxy.Annotations["testClient/"+ocpRouteWildCardPolicy])
+	assert.NotContains(t, routeInput.Annotations, "testClient/"+ocpRouteWildCardPolicy)
+}
+
+func TestMutateAlternateBackends(t *testing.T) {
+	routeInput, serviceInput := newMutatorFromFileData(t, "route_without_tls.json", "service-input.json", t.Name())
+
+	canary := *serviceInput.DeepCopy()
+	canary.Name = "nginx-canary"
+	canary.Spec.Ports[0].Port = 8080
+
+	stopped := *serviceInput.DeepCopy()
+	stopped.Name = "nginx-stopped"
+
+	canaryWeight, stoppedWeight := int32(25), int32(0)
+	routeInput.Spec.AlternateBackends = []route.RouteTargetReference{
+		{Kind: "Service", Name: "nginx-canary", Weight: &canaryWeight},
+		{Kind: "Service", Name: "nginx-stopped", Weight: &stoppedWeight},
+		{Kind: "Service", Name: "nginx-missing"},
+	}
+
+	services := []core.Service{serviceInput, canary, stopped}
+
+	m := NewMutator("testClient", logrus.New(), routeInput, services, "")
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, []contourv1.Service{
+		{Name: "nginx", Port: 80, Weight: 100},
+		{Name: "nginx-canary", Port: 8080, Weight: 25},
+		{Name: "nginx-stopped", Port: 80, Weight: 0},
+	}, output.HTTPProxy.Spec.Routes[0].Services)
+
+	entries := output.Report.ByPath()
+
+	assert.Equal(t, "Service nginx-missing not found, the share of the traffic is sent to the other backends",
+		entries["spec.alternateBackends"].Message)
+	assert.NotContains(t, entries, "spec.to.weight")
+
+	// every backend has a zero weight
+	zero := int32(0)
+	routeInput.Spec.To.Weight = &zero
+	canaryWeight = 0
+
+	m = NewMutator("testClient", logrus.New(), routeInput, services, "")
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+
+	for _, entry := range output.Report.Entries {
+		entries[entry.Path] = entry
+	}
+
+	assert.Equal(t, mutator.SeverityHigh, entries["spec.to.weight"].Severity)
+
+	// a single zero weight backend
+	routeInput.Spec.AlternateBackends = nil
+
+	m = NewMutator("testClient", logrus.New(), routeInput, services, "")
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, int64(0), output.HTTPProxy.Spec.Routes[0].Services[0].Weight)
+	assert.Equal(t, "spec.to.weight", output.Report.AtLeast(mutator.SeverityHigh)[0].Path)
+}
+
+func TestMutateMissingService(t *testing.T) {
+	routeInput, serviceInput := newMutatorFromFileData(t, "route_without_tls.json", "service-input.json", t.Name())
+
+	serviceInput.Namespace = "other"
+
+	m := NewMutator("testClient", logrus.New(), routeInput, []core.Service{serviceInput}, "")
+	_, err := m.Mutate()
+	assert.EqualError(t, err, "service default/nginx referenced by route nginx not found")
+}
+
+func TestMutatePath(t *testing.T) {
+	routeInput, serviceInput := newMutatorFromFileData(t, "route_without_tls.json", "service-input.json", t.Name())
+	routeInput.Spec.Path = "/api"
+
+	m := NewMutator("testClient", logrus.New(), routeInput, []core.Service{serviceInput}, "")
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, []contourv1.MatchCondition{{Prefix: "/api"}}, output.HTTPProxy.Spec.Routes[0].Conditions)
+}
+
+func TestMutateServiceWithoutPorts(t *testing.T) {
+	routeInput, serviceInput := newMutatorFromFileData(t, "route_without_tls.json", "service-input.json", t.Name())
+	routeInput.Spec.Port = nil
+	serviceInput.Spec.Ports = nil
+
+	m := NewMutator("testClient", logrus.New(), routeInput, []core.Service{serviceInput}, "")
+	_, err := m.Mutate()
+	assert.EqualError(t, err, "translateRoute cannot pick a port, Service object nginx has no ports")
+}
+
 func newMutatorFromFileData(t *testing.T, routeFile, serviceFile, testName string) (route.Route, core.Service) {
 	routeConfigFilePath := filepath.Join("testdata", routeFile)
 	route2File, err := ioutil.ReadFile(routeConfigFilePath)
@@ -0,0 +1,315 @@
+package scc2psp
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	security "github.com/openshift/api/security/v1"
+	rbac "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+const (
+	gatekeeperAPIVersion = "constraints.gatekeeper.sh/v1beta1"
+	gatekeeperNamePrefix = "scc-"
+)
+
+// GatekeeperOutput contains the OPA Gatekeeper Constraints equivalent to a SecurityContextConstraints.
+// The Constraints are instances of the gatekeeper-library pod security policy ConstraintTemplates, which
+// have to be installed in the cluster.
+type GatekeeperOutput struct {
+	Constraints []unstructured.Unstructured
+	Report      mutator.Report
+}
+
+// MutateGatekeeper converts the SecurityContextConstraints into gatekeeper-library Constraints matching the
+// pods of the namespaces the SCC service accounts belong to
+func (m *Mutator) MutateGatekeeper() *GatekeeperOutput {
+	scc := m.input
+	output := &GatekeeperOutput{}
+
+	namespaces, clusterWide := m.subjectNamespaces(&output.Report)
+	if len(namespaces) == 0 && !clusterWide {
+		output.Report.Dropped("users", mutator.SeverityWarning, scc.Users,
+			"the SCC is not granted to any service account, no Gatekeeper constraint is generated")
+		return output
+	}
+
+	match := map[string]interface{}{
+		"kinds": []interface{}{
+			map[string]interface{}{
+				"apiGroups": []interface{}{""},
+				"kinds":     []interface{}{"Pod"},
+			},
+		},
+	}
+
+	if !clusterWide {
+		match["namespaces"] = stringValues(namespaces)
+	} else {
+		output.Report.Approximated("groups", mutator.SeverityHigh, scc.Groups,
+			"the SCC is granted to every service account, the Gatekeeper constraints match the pods of every namespace "+
+				"and deny the pods of the service accounts granted a more permissive SCC")
+	}
+
+	addConstraint := func(kind string, parameters map[string]interface{}) {
+		spec := map[string]interface{}{
+			"enforcementAction": "deny",
+			"match":             match,
+		}
+
+		if parameters != nil {
+			spec["parameters"] = parameters
+		}
+
+		constraint := unstructured.Unstructured{Object: map[string]interface{}{"spec": spec}}
+		constraint.SetAPIVersion(gatekeeperAPIVersion)
+		constraint.SetKind(kind)
+		constraint.SetName(gatekeeperNamePrefix + scc.Name + "-" + strings.ToLower(strings.TrimPrefix(kind, "K8sPSP")))
+		constraint.SetLabels(scc.Labels)
+
+		output.Constraints = append(output.Constraints, *constraint.DeepCopy())
+	}
+
+	if !scc.AllowPrivilegedContainer {
+		addConstraint("K8sPSPPrivilegedContainer", nil)
+	}
+
+	if !scc.AllowHostPID && !scc.AllowHostIPC {
+		addConstraint("K8sPSPHostNamespace", nil)
+	} else if !scc.AllowHostPID || !scc.AllowHostIPC {
+		output.Report.Approximated("allowHostPID", mutator.SeverityWarning, map[string]bool{"allowHostPID": scc.AllowHostPID, "allowHostIPC": scc.AllowHostIPC},
+			"k8spsphostnamespace only forbids the host PID and IPC namespaces together, both are allowed")
+	}
+
+	hostPorts := map[string]interface{}{
+		"hostNetwork": scc.AllowHostNetwork,
+		"min":         int64(0),
+		"max":         int64(0),
+	}
+	if scc.AllowHostPorts {
+		hostPorts["max"] = int64(65535)
+	}
+	addConstraint("K8sPSPHostNetworkingPorts", hostPorts)
+
+	if scc.AllowPrivilegeEscalation != nil && !*scc.AllowPrivilegeEscalation {
+		addConstraint("K8sPSPAllowPrivilegeEscalationContainer", nil)
+	}
+
+	if scc.ReadOnlyRootFilesystem {
+		addConstraint("K8sPSPReadOnlyRootFilesystem", nil)
+		output.Report.Approximated("readOnlyRootFilesystem", mutator.SeverityWarning, true,
+			"the SCC makes the root filesystem read only, the Gatekeeper constraint requires pods to request it")
+	}
+
+	allowedCapabilities := stringValues(nil)
+	for _, capability := range append(scc.AllowedCapabilities, scc.DefaultAddCapabilities...) {
+		allowedCapabilities = append(allowedCapabilities, string(capability))
+	}
+
+	requiredDropCapabilities := stringValues(nil)
+	for _, capability := range scc.RequiredDropCapabilities {
+		requiredDropCapabilities = append(requiredDropCapabilities, string(capability))
+	}
+
+	addConstraint("K8sPSPCapabilities", map[string]interface{}{
+		"allowedCapabilities":      allowedCapabilities,
+		"requiredDropCapabilities": requiredDropCapabilities,
+	})
+
+	if len(scc.DefaultAddCapabilities) > 0 {
+		output.Report.Dropped("defaultAddCapabilities", mutator.SeverityWarning, scc.DefaultAddCapabilities,
+			"the Gatekeeper constraints do not add capabilities to the pods")
+	}
+
+	if len(scc.RequiredDropCapabilities) > 0 {
+		output.Report.Approximated("requiredDropCapabilities", mutator.SeverityWarning, scc.RequiredDropCapabilities,
+			"the SCC drops the capabilities from the pods, the Gatekeeper constraint requires pods to drop them")
+	}
+
+	m.buildGatekeeperVolumeConstraints(addConstraint)
+	m.buildGatekeeperUserConstraints(addConstraint, &output.Report)
+
+	if scc.SELinuxContext.Type == security.SELinuxStrategyMustRunAs && scc.SELinuxContext.SELinuxOptions != nil {
+		options := scc.SELinuxContext.SELinuxOptions
+
+		addConstraint("K8sPSPSELinuxV2", map[string]interface{}{
+			"allowedSELinuxOptions": []interface{}{
+				map[string]interface{}{
+					"user":  options.User,
+					"role":  options.Role,
+					"type":  options.Type,
+					"level": options.Level,
+				},
+			},
+		})
+		output.Report.Approximated("seLinuxContext", mutator.SeverityWarning, scc.SELinuxContext,
+			"the SCC assigns the SELinux context to the pods, the Gatekeeper constraint only validates requested contexts")
+	}
+
+	sysctls := map[string]interface{}{
+		"forbiddenSysctls": stringValues(scc.ForbiddenSysctls),
+	}
+
+	allowedSysctls := []string{}
+	for sysctl := range baselineSysctls {
+		allowedSysctls = append(allowedSysctls, sysctl)
+	}
+	sort.Strings(allowedSysctls)
+
+	allowedSysctls = append(allowedSysctls, scc.AllowedUnsafeSysctls...)
+	for _, sysctl := range scc.AllowedUnsafeSysctls {
+		if sysctl == "*" {
+			allowedSysctls = []string{"*"}
+			break
+		}
+	}
+	sysctls["allowedSysctls"] = stringValues(allowedSysctls)
+
+	addConstraint("K8sPSPForbiddenSysctls", sysctls)
+
+	output.Report.Approximated("priority", mutator.SeverityWarning, scc.Priority,
+		"OpenShift admits a pod when any SCC allows it, Gatekeeper requires the pod to satisfy every constraint matching it")
+
+	m.log.Debugf("[%s] mutated gatekeeper constraints = %#v", m.name, output.Constraints)
+
+	return output
+}
+
+func (m *Mutator) buildGatekeeperVolumeConstraints(addConstraint func(string, map[string]interface{})) {
+	scc := m.input
+
+	volumes := stringValues(nil)
+	flexVolume := false
+
+	for _, volume := range scc.Volumes {
+		if volume == security.FSTypeFlexVolume {
+			flexVolume = true
+		}
+
+		if volume != security.FSTypeNone {
+			volumes = append(volumes, string(volume))
+		}
+	}
+
+	if scc.AllowHostDirVolumePlugin {
+		volumes = append(volumes, string(security.FSTypeHostPath))
+	}
+
+	addConstraint("K8sPSPVolumeTypes", map[string]interface{}{
+		"volumes": volumes,
+	})
+
+	if flexVolume && len(scc.AllowedFlexVolumes) > 0 {
+		drivers := []interface{}{}
+		for _, flex := range scc.AllowedFlexVolumes {
+			drivers = append(drivers, map[string]interface{}{"driver": flex.Driver})
+		}
+
+		addConstraint("K8sPSPFlexVolumes", map[string]interface{}{
+			"allowedFlexVolumes": drivers,
+		})
+	}
+}
+
+func (m *Mutator) buildGatekeeperUserConstraints(addConstraint func(string, map[string]interface{}), report *mutator.Report) {
+	scc := m.input
+	parameters := map[string]interface{}{}
+
+	idRanges := func(ranges []security.IDRange) []interface{} {
+		result := []interface{}{}
+		for _, idRange := range ranges {
+			result = append(result, map[string]interface{}{"min": idRange.Min, "max": idRange.Max})
+		}
+
+		return result
+	}
+
+	switch scc.RunAsUser.Type {
+	case security.RunAsUserStrategyMustRunAsNonRoot:
+		parameters["runAsUser"] = map[string]interface{}{"rule": "MustRunAsNonRoot"}
+	case security.RunAsUserStrategyMustRunAs:
+		if scc.RunAsUser.UID != nil {
+			parameters["runAsUser"] = map[string]interface{}{
+				"rule":   "MustRunAs",
+				"ranges": idRanges([]security.IDRange{{Min: *scc.RunAsUser.UID, Max: *scc.RunAsUser.UID}}),
+			}
+		}
+	case security.RunAsUserStrategyMustRunAsRange:
+		if scc.RunAsUser.UIDRangeMin != nil && scc.RunAsUser.UIDRangeMax != nil {
+			parameters["runAsUser"] = map[string]interface{}{
+				"rule":   "MustRunAs",
+				"ranges": idRanges([]security.IDRange{{Min: *scc.RunAsUser.UIDRangeMin, Max: *scc.RunAsUser.UIDRangeMax}}),
+			}
+		}
+	}
+
+	if _, found := parameters["runAsUser"]; found {
+		field := "runAsUser"
+		if scc.RunAsUser.Type == security.RunAsUserStrategyMustRunAsNonRoot {
+			field = "runAsNonRoot"
+		}
+
+		report.Approximated("runAsUser", mutator.SeverityHigh, scc.RunAsUser,
+			"the SCC sets "+field+" on the pods that do not request it, the Gatekeeper constraint denies the "+
+				"containers that do not set "+field+" themselves")
+	} else if scc.RunAsUser.Type != security.RunAsUserStrategyRunAsAny {
+		report.Dropped("runAsUser", mutator.SeverityHigh, scc.RunAsUser,
+			"the SCC does not define the allowed UIDs, they are not validated by the Gatekeeper constraint")
+	}
+
+	// the SCC sets the groups of the pods that do not request them, MayRunAs admits these pods as well
+	if scc.FSGroup.Type == security.FSGroupStrategyMustRunAs && len(scc.FSGroup.Ranges) > 0 {
+		parameters["fsGroup"] = map[string]interface{}{"rule": "MayRunAs", "ranges": idRanges(scc.FSGroup.Ranges)}
+	}
+
+	if scc.SupplementalGroups.Type == security.SupplementalGroupsStrategyMustRunAs && len(scc.SupplementalGroups.Ranges) > 0 {
+		parameters["supplementalGroups"] = map[string]interface{}{"rule": "MayRunAs", "ranges": idRanges(scc.SupplementalGroups.Ranges)}
+	}
+
+	if len(parameters) > 0 {
+		addConstraint("K8sPSPAllowedUsers", parameters)
+	}
+}
+
+// subjectNamespaces returns the namespaces of the service accounts the SCC is granted to, directly or
+// through their system:serviceaccounts:<namespace> group. clusterWide is set when the SCC is granted to
+// every service account.
+func (m *Mutator) subjectNamespaces(report *mutator.Report) (namespaces []string, clusterWide bool) {
+	scc := m.input
+	found := map[string]bool{}
+
+	m.reportMalformedUsers(report)
+
+	for _, subject := range m.buildClusterRoleBindingUserSubjects(scc, rbac.ClusterRoleBinding{}) {
+		if subject.Kind == "ServiceAccount" {
+			found[subject.Namespace] = true
+		} else {
+			report.Dropped("users", mutator.SeverityWarning, subject.Name,
+				"Gatekeeper constraints match namespaces, the grant to user "+subject.Name+" is not converted")
+		}
+	}
+
+	for _, subject := range m.buildClusterRoleBindingGroupSubjects(scc) {
+		if namespace, ok := serviceAccountGroupNamespace(subject.Name); ok {
+			found[namespace] = true
+			continue
+		}
+
+		if subject.Name == allServiceAccountsGroup || subject.Name == authenticatedGroup {
+			clusterWide = true
+			continue
+		}
+
+		report.Dropped("groups", mutator.SeverityWarning, subject.Name,
+			"Gatekeeper constraints match namespaces, the grant to group "+subject.Name+" is not converted")
+	}
+
+	for namespace := range found {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	return namespaces, clusterWide
+}
@@ -0,0 +1,128 @@
+package scc2psp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	security "github.com/openshift/api/security/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func gatekeeperConstraints(output *GatekeeperOutput) map[string]unstructured.Unstructured {
+	byKind := map[string]unstructured.Unstructured{}
+	for _, constraint := range output.Constraints {
+		byKind[constraint.GetKind()] = constraint
+	}
+
+	return byKind
+}
+
+func TestMutateGatekeeper(t *testing.T) {
+	scc := newRestrictedV2SCC()
+	scc.Users = []string{"system:serviceaccount:web:default", "alice"}
+	scc.Groups = []string{"system:serviceaccounts:api"}
+	uidMin, uidMax := int64(1000), int64(2000)
+	scc.RunAsUser.UIDRangeMin = &uidMin
+	scc.RunAsUser.UIDRangeMax = &uidMax
+
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	output := m.MutateGatekeeper()
+	constraints := gatekeeperConstraints(output)
+
+	for _, kind := range []string{"K8sPSPPrivilegedContainer", "K8sPSPHostNamespace", "K8sPSPHostNetworkingPorts",
+		"K8sPSPAllowPrivilegeEscalationContainer", "K8sPSPCapabilities", "K8sPSPVolumeTypes", "K8sPSPAllowedUsers",
+		"K8sPSPForbiddenSysctls"} {
+		assert.Contains(t, constraints, kind)
+	}
+	assert.NotContains(t, constraints, "K8sPSPReadOnlyRootFilesystem")
+	assert.NotContains(t, constraints, "K8sPSPSELinuxV2")
+
+	users := constraints["K8sPSPAllowedUsers"]
+	assert.Equal(t, "constraints.gatekeeper.sh/v1beta1", users.GetAPIVersion())
+	assert.Equal(t, "scc-restricted-v2-allowedusers", users.GetName())
+
+	// the constraints must be valid JSON compatible unstructured objects
+	assert.NotPanics(t, func() { users.DeepCopy() })
+	_, err := json.Marshal(users)
+	assert.NoError(t, err)
+
+	namespaces, _, _ := unstructured.NestedStringSlice(users.Object, "spec", "match", "namespaces")
+	assert.Equal(t, []string{"api", "web"}, namespaces)
+
+	ranges, _, _ := unstructured.NestedSlice(users.Object, "spec", "parameters", "runAsUser", "ranges")
+	assert.Equal(t, []interface{}{map[string]interface{}{"min": int64(1000), "max": int64(2000)}}, ranges)
+
+	drops, _, _ := unstructured.NestedStringSlice(constraints["K8sPSPCapabilities"].Object, "spec", "parameters", "requiredDropCapabilities")
+	assert.Equal(t, []string{"ALL"}, drops)
+
+	max, _, _ := unstructured.NestedInt64(constraints["K8sPSPHostNetworkingPorts"].Object, "spec", "parameters", "max")
+	assert.Equal(t, int64(0), max)
+
+	dropped := []interface{}{}
+	for _, entry := range output.Report.Entries {
+		if entry.Action == mutator.ActionDropped {
+			dropped = append(dropped, entry.Original)
+		}
+	}
+	assert.Equal(t, []interface{}{"alice"}, dropped)
+
+	for _, entry := range output.Report.Entries {
+		if entry.Path == "runAsUser" {
+			assert.Equal(t, mutator.SeverityHigh, entry.Severity)
+			assert.Contains(t, entry.Message, "denies the containers that do not set runAsUser")
+		}
+	}
+
+	// the pods the SCC assigns groups to are admitted
+	scc.FSGroup.Ranges = []security.IDRange{{Min: 1000, Max: 2000}}
+	scc.SupplementalGroups.Type = security.SupplementalGroupsStrategyMustRunAs
+	scc.SupplementalGroups.Ranges = []security.IDRange{{Min: 1000, Max: 2000}}
+
+	m = NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	users = gatekeeperConstraints(m.MutateGatekeeper())["K8sPSPAllowedUsers"]
+
+	for _, field := range []string{"fsGroup", "supplementalGroups"} {
+		rule, _, _ := unstructured.NestedString(users.Object, "spec", "parameters", field, "rule")
+		assert.Equal(t, "MayRunAs", rule, field)
+	}
+}
+
+func TestMutateGatekeeperPermissiveSCC(t *testing.T) {
+	m := newMutatorFromFileData(t, "full.json")
+	output := m.MutateGatekeeper()
+	constraints := gatekeeperConstraints(output)
+
+	// system:authenticated grants the SCC to every namespace
+	_, found, _ := unstructured.NestedFieldNoCopy(constraints["K8sPSPVolumeTypes"].Object, "spec", "match", "namespaces")
+	assert.False(t, found)
+
+	assert.Contains(t, constraints, "K8sPSPSELinuxV2")
+	assert.NotContains(t, constraints, "K8sPSPAllowedUsers")
+	assert.NotContains(t, constraints, "K8sPSPAllowPrivilegeEscalationContainer")
+
+	volumes, _, _ := unstructured.NestedStringSlice(constraints["K8sPSPVolumeTypes"].Object, "spec", "parameters", "volumes")
+	assert.Contains(t, volumes, "hostPath")
+
+	max, _, _ := unstructured.NestedInt64(constraints["K8sPSPHostNetworkingPorts"].Object, "spec", "parameters", "max")
+	assert.Equal(t, int64(65535), max)
+
+	clusterWide := false
+	for _, entry := range output.Report.Entries {
+		if entry.Path == "groups" && entry.Severity == mutator.SeverityHigh {
+			clusterWide = true
+		}
+	}
+	assert.True(t, clusterWide)
+}
+
+func TestMutateGatekeeperWithoutSubjects(t *testing.T) {
+	m := NewMutator(clientName, logrus.New(), newRestrictedV2SCC(), DefaultOptions())
+	output := m.MutateGatekeeper()
+
+	assert.Empty(t, output.Constraints)
+	assert.Equal(t, 1, len(output.Report.Entries))
+	assert.Equal(t, mutator.ActionDropped, output.Report.Entries[0].Action)
+}
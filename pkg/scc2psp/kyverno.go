@@ -0,0 +1,553 @@
+package scc2psp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	security "github.com/openshift/api/security/v1"
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+)
+
+const (
+	kyvernoAPIVersion = "kyverno.io/v1"
+	kyvernoNamePrefix = "scc-"
+
+	// JMESPath expressions evaluated by Kyverno against the admission request
+	kyvernoAllContainers  = "request.object.spec.[ephemeralContainers, initContainers, containers][]"
+	kyvernoServiceAccount = "{{ request.namespace }}:{{ request.object.spec.serviceAccountName || 'default' }}"
+)
+
+// KyvernoOutput contains the Kyverno equivalent of a SecurityContextConstraints. ClusterPolicy is nil
+// when the SCC is not granted to any subject.
+type KyvernoOutput struct {
+	ClusterPolicy *unstructured.Unstructured
+	Report        mutator.Report
+}
+
+// MutateKyverno converts the SecurityContextConstraints into a Kyverno ClusterPolicy validating the pods
+// created by, or running as, the users, groups and service accounts the SCC is granted to
+func (m *Mutator) MutateKyverno() *KyvernoOutput {
+	scc := m.input
+	output := &KyvernoOutput{}
+
+	preconditions := m.buildKyvernoPreconditions(&output.Report)
+	if preconditions == nil {
+		return output
+	}
+
+	rules := []interface{}{}
+
+	addRule := func(name, message string, validate map[string]interface{}) {
+		validate["message"] = message
+
+		rules = append(rules, map[string]interface{}{
+			"name": name,
+			"match": map[string]interface{}{
+				"any": []interface{}{
+					map[string]interface{}{
+						"resources": map[string]interface{}{
+							"kinds": []interface{}{"Pod"},
+						},
+					},
+				},
+			},
+			"preconditions": runtime.DeepCopyJSONValue(preconditions),
+			"validate":      validate,
+		})
+	}
+
+	hostNamespaces := map[string]interface{}{}
+	if !scc.AllowHostNetwork {
+		hostNamespaces["=(hostNetwork)"] = false
+	}
+	if !scc.AllowHostPID {
+		hostNamespaces["=(hostPID)"] = false
+	}
+	if !scc.AllowHostIPC {
+		hostNamespaces["=(hostIPC)"] = false
+	}
+
+	if len(hostNamespaces) > 0 {
+		addRule("host-namespaces", "sharing the host namespaces is not allowed", kyvernoPodPattern(hostNamespaces, nil))
+	}
+
+	if !scc.AllowHostPorts {
+		addRule("host-ports", "host ports are not allowed", kyvernoPodPattern(nil, map[string]interface{}{
+			"=(ports)": []interface{}{map[string]interface{}{"=(hostPort)": int64(0)}},
+		}))
+	}
+
+	if !scc.AllowPrivilegedContainer {
+		addRule("privileged-containers", "privileged containers are not allowed", kyvernoPodPattern(nil, map[string]interface{}{
+			"=(securityContext)": map[string]interface{}{"=(privileged)": false},
+		}))
+	}
+
+	if scc.AllowPrivilegeEscalation != nil && !*scc.AllowPrivilegeEscalation {
+		addRule("privilege-escalation", "privilege escalation is not allowed", kyvernoPodPattern(nil, map[string]interface{}{
+			"=(securityContext)": map[string]interface{}{"=(allowPrivilegeEscalation)": false},
+		}))
+	}
+
+	if scc.ReadOnlyRootFilesystem {
+		addRule("read-only-root-filesystem", "the root filesystem must be read only", kyvernoPodPattern(nil, map[string]interface{}{
+			"securityContext": map[string]interface{}{"readOnlyRootFilesystem": true},
+		}))
+		output.Report.Approximated("readOnlyRootFilesystem", mutator.SeverityWarning, true,
+			"the SCC makes the root filesystem read only, the Kyverno policy requires pods to request it")
+	}
+
+	m.buildKyvernoCapabilityRules(addRule, &output.Report)
+	m.buildKyvernoVolumeRules(addRule)
+	m.buildKyvernoUserRules(addRule, &output.Report)
+	m.buildKyvernoSysctlRules(addRule)
+	m.buildKyvernoSeccompRules(addRule, &output.Report)
+
+	if scc.FSGroup.Type == security.FSGroupStrategyMustRunAs || scc.SupplementalGroups.Type == security.SupplementalGroupsStrategyMustRunAs {
+		output.Report.Dropped("fsGroup", mutator.SeverityWarning, scc.FSGroup,
+			"fsGroup and supplementalGroups ranges are not validated by the Kyverno policy")
+	}
+
+	policy := unstructured.Unstructured{Object: map[string]interface{}{
+		"spec": map[string]interface{}{
+			"validationFailureAction": "enforce",
+			// request.userInfo is only known at admission time
+			"background": false,
+			"rules":      rules,
+		},
+	}}
+	policy.SetAPIVersion(kyvernoAPIVersion)
+	policy.SetKind("ClusterPolicy")
+	policy.SetName(kyvernoNamePrefix + scc.Name)
+	policy.SetLabels(scc.Labels)
+	policy.SetAnnotations(map[string]string{
+		"policies.kyverno.io/title":       "SecurityContextConstraints " + scc.Name,
+		"policies.kyverno.io/description": "Generated by " + m.name + " from the SecurityContextConstraints " + scc.Name,
+	})
+
+	output.ClusterPolicy = &policy
+
+	m.log.Debugf("[%s] mutated kyverno cluster policy = %#v", m.name, policy)
+
+	return output
+}
+
+// buildKyvernoPreconditions restricts the rules to the pods running as the SCC service accounts or
+// created by the SCC users and groups. It returns nil when the SCC is not granted to any subject.
+func (m *Mutator) buildKyvernoPreconditions(report *mutator.Report) map[string]interface{} {
+	scc := m.input
+
+	serviceAccounts := []interface{}{}
+	users := []interface{}{}
+	groups := []interface{}{}
+
+	m.reportMalformedUsers(report)
+
+	for _, subject := range m.buildClusterRoleBindingUserSubjects(scc, rbac.ClusterRoleBinding{}) {
+		if subject.Kind == "ServiceAccount" {
+			serviceAccounts = append(serviceAccounts, subject.Namespace+":"+subject.Name)
+		} else {
+			users = append(users, subject.Name)
+		}
+	}
+
+	for _, subject := range m.buildClusterRoleBindingGroupSubjects(scc) {
+		groups = append(groups, subject.Name)
+
+		if subject.Name == allServiceAccountsGroup || subject.Name == authenticatedGroup {
+			report.Approximated("groups", mutator.SeverityHigh, subject.Name,
+				"the SCC is granted to the group "+subject.Name+", the Kyverno policy applies to every pod created by a controller "+
+					"or user of the group and denies the pods granted a more permissive SCC")
+		}
+	}
+
+	conditions := []interface{}{}
+
+	addCondition := func(key string, values []interface{}) {
+		if len(values) > 0 {
+			conditions = append(conditions, map[string]interface{}{
+				"key":      key,
+				"operator": "AnyIn",
+				"value":    values,
+			})
+		}
+	}
+
+	addCondition(kyvernoServiceAccount, serviceAccounts)
+	addCondition("{{ request.userInfo.username }}", users)
+	addCondition("{{ request.userInfo.groups }}", groups)
+
+	if len(conditions) == 0 {
+		report.Dropped("users", mutator.SeverityWarning, scc.Users,
+			"the SCC is not granted to any subject, no Kyverno policy is generated")
+		return nil
+	}
+
+	if len(users)+len(groups) > 0 {
+		report.Approximated("users", mutator.SeverityInfo, scc.Users,
+			"users and groups are matched against the creator of the pod, which is a controller for pods created by workloads")
+	}
+
+	report.Approximated("priority", mutator.SeverityWarning, scc.Priority,
+		"OpenShift admits a pod when any SCC allows it, Kyverno requires the pod to satisfy every policy applying to it")
+
+	return map[string]interface{}{"any": conditions}
+}
+
+func (m *Mutator) buildKyvernoCapabilityRules(addRule func(string, string, map[string]interface{}), report *mutator.Report) {
+	scc := m.input
+
+	allowAll := false
+	allowed := []interface{}{}
+
+	for _, capabilities := range [][]core.Capability{scc.AllowedCapabilities, scc.DefaultAddCapabilities} {
+		for _, capability := range capabilities {
+			if capability == security.AllowAllCapabilities {
+				allowAll = true
+			}
+			allowed = append(allowed, string(capability))
+		}
+	}
+
+	if !allowAll {
+		addRule("allowed-capabilities", "only the capabilities "+joinValues(allowed)+" can be added", map[string]interface{}{
+			"deny": map[string]interface{}{
+				"conditions": map[string]interface{}{
+					"all": []interface{}{
+						map[string]interface{}{
+							"key":      "{{ " + kyvernoAllContainers + ".securityContext.capabilities.add[] }}",
+							"operator": "AnyNotIn",
+							"value":    allowed,
+						},
+					},
+				},
+			},
+		})
+	}
+
+	if len(scc.DefaultAddCapabilities) > 0 {
+		report.Dropped("defaultAddCapabilities", mutator.SeverityWarning, scc.DefaultAddCapabilities,
+			"the Kyverno policy does not add capabilities to the pods")
+	}
+
+	if len(scc.RequiredDropCapabilities) > 0 {
+		required := []interface{}{}
+		for _, capability := range scc.RequiredDropCapabilities {
+			required = append(required, string(capability))
+		}
+
+		addRule("required-drop-capabilities", "the capabilities "+joinValues(required)+" must be dropped", map[string]interface{}{
+			"foreach": []interface{}{
+				map[string]interface{}{
+					"list": kyvernoAllContainers,
+					"deny": map[string]interface{}{
+						"conditions": map[string]interface{}{
+							"any": []interface{}{
+								map[string]interface{}{
+									"key":      required,
+									"operator": "AnyNotIn",
+									"value":    "{{ element.securityContext.capabilities.drop[] || `[]` }}",
+								},
+							},
+						},
+					},
+				},
+			},
+		})
+
+		report.Approximated("requiredDropCapabilities", mutator.SeverityWarning, scc.RequiredDropCapabilities,
+			"the SCC drops the capabilities from the pods, the Kyverno policy requires pods to drop them")
+	}
+}
+
+func (m *Mutator) buildKyvernoVolumeRules(addRule func(string, string, map[string]interface{})) {
+	scc := m.input
+
+	// every volume has a name field beside its type
+	allowed := []interface{}{"name"}
+	flexVolume := false
+
+	for _, volume := range scc.Volumes {
+		if volume == security.FSTypeAll {
+			return
+		}
+
+		if volume == security.FSTypeFlexVolume {
+			flexVolume = true
+		}
+
+		if volume != security.FSTypeNone {
+			allowed = append(allowed, string(volume))
+		}
+	}
+
+	if scc.AllowHostDirVolumePlugin {
+		allowed = append(allowed, string(security.FSTypeHostPath))
+	}
+
+	addRule("volume-types", "only the volume types "+joinValues(allowed[1:])+" are allowed", map[string]interface{}{
+		"deny": map[string]interface{}{
+			"conditions": map[string]interface{}{
+				"all": []interface{}{
+					map[string]interface{}{
+						"key":      "{{ request.object.spec.volumes[].keys(@)[] || '' }}",
+						"operator": "AnyNotIn",
+						"value":    append(allowed, ""),
+					},
+				},
+			},
+		},
+	})
+
+	if flexVolume && len(scc.AllowedFlexVolumes) > 0 {
+		drivers := []interface{}{}
+		for _, flex := range scc.AllowedFlexVolumes {
+			drivers = append(drivers, flex.Driver)
+		}
+
+		addRule("flex-volume-drivers", "only the flex volume drivers "+joinValues(drivers)+" are allowed", map[string]interface{}{
+			"deny": map[string]interface{}{
+				"conditions": map[string]interface{}{
+					"all": []interface{}{
+						map[string]interface{}{
+							"key":      "{{ request.object.spec.volumes[].flexVolume.driver || `[]` }}",
+							"operator": "AnyNotIn",
+							"value":    drivers,
+						},
+					},
+				},
+			},
+		})
+	}
+}
+
+func (m *Mutator) buildKyvernoUserRules(addRule func(string, string, map[string]interface{}), report *mutator.Report) {
+	scc := m.input
+
+	// Kyverno pattern for the allowed UIDs
+	var uids string
+
+	switch scc.RunAsUser.Type {
+	case security.RunAsUserStrategyMustRunAsNonRoot:
+		uids = ">0"
+	case security.RunAsUserStrategyMustRunAs:
+		if scc.RunAsUser.UID != nil {
+			uids = fmt.Sprintf("%d", *scc.RunAsUser.UID)
+		}
+	case security.RunAsUserStrategyMustRunAsRange:
+		if scc.RunAsUser.UIDRangeMin != nil && scc.RunAsUser.UIDRangeMax != nil {
+			uids = fmt.Sprintf("%d-%d", *scc.RunAsUser.UIDRangeMin, *scc.RunAsUser.UIDRangeMax)
+		}
+	}
+
+	if uids == "" {
+		if scc.RunAsUser.Type != security.RunAsUserStrategyRunAsAny {
+			report.Dropped("runAsUser", mutator.SeverityHigh, scc.RunAsUser,
+				"the SCC does not define the allowed UIDs, they are not validated by the Kyverno policy")
+		}
+	} else {
+		securityContext := map[string]interface{}{
+			"=(securityContext)": map[string]interface{}{"=(runAsUser)": uids},
+		}
+
+		addRule("run-as-user", "containers must run with a UID in "+uids, kyvernoPodPattern(securityContext, securityContext))
+		report.Approximated("runAsUser", mutator.SeverityWarning, scc.RunAsUser,
+			"the SCC assigns a UID to the pods that do not request one, the Kyverno policy only validates requested UIDs")
+	}
+
+	if scc.SELinuxContext.Type == security.SELinuxStrategyMustRunAs && scc.SELinuxContext.SELinuxOptions != nil {
+		options := map[string]interface{}{}
+		for field, value := range map[string]string{
+			"=(user)":  scc.SELinuxContext.SELinuxOptions.User,
+			"=(role)":  scc.SELinuxContext.SELinuxOptions.Role,
+			"=(type)":  scc.SELinuxContext.SELinuxOptions.Type,
+			"=(level)": scc.SELinuxContext.SELinuxOptions.Level,
+		} {
+			if value != "" {
+				options[field] = value
+			}
+		}
+
+		if len(options) > 0 {
+			securityContext := map[string]interface{}{
+				"=(securityContext)": map[string]interface{}{"=(seLinuxOptions)": options},
+			}
+
+			addRule("selinux", "the SELinux options must match the SecurityContextConstraints", kyvernoPodPattern(securityContext, securityContext))
+			report.Approximated("seLinuxContext", mutator.SeverityWarning, scc.SELinuxContext,
+				"the SCC assigns the SELinux context to the pods, the Kyverno policy only validates requested contexts")
+		}
+	}
+}
+
+func (m *Mutator) buildKyvernoSysctlRules(addRule func(string, string, map[string]interface{})) {
+	scc := m.input
+
+	if len(scc.ForbiddenSysctls) > 0 {
+		addRule("forbidden-sysctls", "the sysctls "+joinStrings(scc.ForbiddenSysctls)+" are forbidden", map[string]interface{}{
+			"deny": map[string]interface{}{
+				"conditions": map[string]interface{}{
+					"any": []interface{}{
+						map[string]interface{}{
+							"key":      "{{ request.object.spec.securityContext.sysctls[].name || `[]` }}",
+							"operator": "AnyIn",
+							"value":    stringValues(scc.ForbiddenSysctls),
+						},
+					},
+				},
+			},
+		})
+	}
+
+	allowed := stringValues(nil)
+	for sysctl := range baselineSysctls {
+		allowed = append(allowed, sysctl)
+	}
+
+	for _, sysctl := range scc.AllowedUnsafeSysctls {
+		if sysctl == "*" {
+			return
+		}
+		allowed = append(allowed, sysctl)
+	}
+
+	message := "only safe sysctls are allowed"
+	if len(scc.AllowedUnsafeSysctls) > 0 {
+		message = "only safe sysctls and " + joinStrings(scc.AllowedUnsafeSysctls) + " are allowed"
+	}
+
+	addRule("allowed-sysctls", message, map[string]interface{}{
+		"deny": map[string]interface{}{
+			"conditions": map[string]interface{}{
+				"any": []interface{}{
+					map[string]interface{}{
+						"key":      "{{ request.object.spec.securityContext.sysctls[].name || `[]` }}",
+						"operator": "AnyNotIn",
+						"value":    sortedValues(allowed),
+					},
+				},
+			},
+		},
+	})
+}
+
+func (m *Mutator) buildKyvernoSeccompRules(addRule func(string, string, map[string]interface{}), report *mutator.Report) {
+	scc := m.input
+
+	if len(scc.SeccompProfiles) == 0 {
+		return
+	}
+
+	types := []string{}
+	seen := map[string]bool{}
+	localhost := false
+
+	allow := func(profileType core.SeccompProfileType) {
+		if !seen[string(profileType)] {
+			seen[string(profileType)] = true
+			types = append(types, string(profileType))
+		}
+	}
+
+	for i, profile := range scc.SeccompProfiles {
+		switch {
+		case profile == seccompAllowAll:
+			return
+		case profile == seccompRuntimeDefault || profile == seccompDockerDefault:
+			allow(core.SeccompProfileTypeRuntimeDefault)
+		case profile == seccompUnconfined:
+			allow(core.SeccompProfileTypeUnconfined)
+		case strings.HasPrefix(profile, seccompLocalhostPrefix):
+			allow(core.SeccompProfileTypeLocalhost)
+			localhost = true
+		default:
+			report.Dropped(fmt.Sprintf("seccompProfiles[%d]", i), mutator.SeverityWarning, profile,
+				"unknown seccomp profile "+profile+" is not allowed by the Kyverno policy")
+		}
+	}
+
+	if len(types) == 0 {
+		return
+	}
+	sort.Strings(types)
+
+	securityContext := map[string]interface{}{
+		"=(securityContext)": map[string]interface{}{
+			"=(seccompProfile)": map[string]interface{}{"type": strings.Join(types, " | ")},
+		},
+	}
+
+	addRule("seccomp-profiles", "only the seccomp profiles "+joinStrings(scc.SeccompProfiles)+" are allowed",
+		kyvernoPodPattern(securityContext, securityContext))
+
+	message := "the SCC assigns the seccomp profile " + scc.SeccompProfiles[0] + " to the pods that do not request one, " +
+		"the Kyverno policy only validates requested profiles"
+	if localhost {
+		message += " and does not validate the localhost profile names"
+	}
+
+	report.Approximated("seccompProfiles", mutator.SeverityWarning, scc.SeccompProfiles, message)
+}
+
+// kyvernoPodPattern builds a validate pattern applying the pod pattern to the pod spec and the container
+// pattern, when set, to every container of the pod
+func kyvernoPodPattern(pod, container map[string]interface{}) map[string]interface{} {
+	spec := map[string]interface{}{}
+
+	for key, value := range pod {
+		spec[key] = runtime.DeepCopyJSONValue(value)
+	}
+
+	if container != nil {
+		spec["=(ephemeralContainers)"] = []interface{}{runtime.DeepCopyJSONValue(container)}
+		spec["=(initContainers)"] = []interface{}{runtime.DeepCopyJSONValue(container)}
+		spec["containers"] = []interface{}{runtime.DeepCopyJSONValue(container)}
+	}
+
+	return map[string]interface{}{
+		"pattern": map[string]interface{}{
+			"spec": spec,
+		},
+	}
+}
+
+func stringValues(values []string) []interface{} {
+	result := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		result = append(result, value)
+	}
+
+	return result
+}
+
+func sortedValues(values []interface{}) []interface{} {
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		strs = append(strs, value.(string))
+	}
+	sort.Strings(strs)
+
+	return stringValues(strs)
+}
+
+func joinValues(values []interface{}) string {
+	strs := make([]string, 0, len(values))
+	for _, value := range values {
+		strs = append(strs, fmt.Sprint(value))
+	}
+
+	return joinStrings(strs)
+}
+
+func joinStrings(values []string) string {
+	if len(values) == 0 {
+		return "none"
+	}
+
+	return strings.Join(values, ", ")
+}
@@ -0,0 +1,142 @@
+package scc2psp
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	security "github.com/openshift/api/security/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+)
+
+func kyvernoRules(t *testing.T, policy *unstructured.Unstructured) map[string]map[string]interface{} {
+	rules, found, err := unstructured.NestedSlice(policy.Object, "spec", "rules")
+	if err != nil || !found {
+		t.Fatalf("cluster policy has no rules: %v", err)
+	}
+
+	byName := map[string]map[string]interface{}{}
+	for _, rule := range rules {
+		byName[rule.(map[string]interface{})["name"].(string)] = rule.(map[string]interface{})
+	}
+
+	return byName
+}
+
+func TestMutateKyverno(t *testing.T) {
+	scc := newRestrictedV2SCC()
+	scc.Users = []string{"system:serviceaccount:web:default", "alice"}
+	uidMin, uidMax := int64(1000), int64(2000)
+	scc.RunAsUser.UIDRangeMin = &uidMin
+	scc.RunAsUser.UIDRangeMax = &uidMax
+
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	output := m.MutateKyverno()
+	policy := output.ClusterPolicy
+
+	assert.Equal(t, "kyverno.io/v1", policy.GetAPIVersion())
+	assert.Equal(t, "ClusterPolicy", policy.GetKind())
+	assert.Equal(t, "scc-restricted-v2", policy.GetName())
+
+	// the policy must be a valid JSON compatible unstructured object
+	assert.NotPanics(t, func() { policy.DeepCopy() })
+	_, err := json.Marshal(policy)
+	assert.NoError(t, err)
+
+	rules := kyvernoRules(t, policy)
+
+	for _, name := range []string{"host-namespaces", "host-ports", "privileged-containers", "privilege-escalation",
+		"allowed-capabilities", "required-drop-capabilities", "volume-types", "run-as-user", "allowed-sysctls"} {
+		assert.Contains(t, rules, name)
+	}
+	assert.NotContains(t, rules, "forbidden-sysctls")
+	assert.NotContains(t, rules, "read-only-root-filesystem")
+
+	conditions, _, _ := unstructured.NestedSlice(rules["run-as-user"], "preconditions", "any")
+	assert.Equal(t, 2, len(conditions))
+	assert.Equal(t, []interface{}{"web:default"}, conditions[0].(map[string]interface{})["value"])
+	assert.Equal(t, []interface{}{"alice"}, conditions[1].(map[string]interface{})["value"])
+
+	uids, _, _ := unstructured.NestedString(rules["run-as-user"], "validate", "pattern", "spec", "=(securityContext)", "=(runAsUser)")
+	assert.Equal(t, "1000-2000", uids)
+
+	seccomp, _, _ := unstructured.NestedString(rules["seccomp-profiles"], "validate", "pattern", "spec",
+		"=(securityContext)", "=(seccompProfile)", "type")
+	assert.Equal(t, "RuntimeDefault", seccomp)
+
+	for _, entry := range output.Report.Entries {
+		assert.NotEqual(t, "groups", entry.Path)
+	}
+}
+
+func TestMutateKyvernoSeccompProfiles(t *testing.T) {
+	scc := newRestrictedV2SCC()
+	scc.Users = []string{"system:serviceaccount:web:default"}
+	scc.SeccompProfiles = []string{"docker/default", "localhost/profiles/audit.json", "runtime/default", "custom"}
+
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	output := m.MutateKyverno()
+
+	rules := kyvernoRules(t, output.ClusterPolicy)
+	seccomp, _, _ := unstructured.NestedString(rules["seccomp-profiles"], "validate", "pattern", "spec",
+		"=(securityContext)", "=(seccompProfile)", "type")
+	assert.Equal(t, "Localhost | RuntimeDefault", seccomp)
+
+	containers, _, _ := unstructured.NestedSlice(rules["seccomp-profiles"], "validate", "pattern", "spec", "containers")
+	seccomp, _, _ = unstructured.NestedString(containers[0].(map[string]interface{}), "=(securityContext)", "=(seccompProfile)", "type")
+	assert.Equal(t, "Localhost | RuntimeDefault", seccomp)
+
+	entries := output.Report.ByPath()
+
+	assert.Equal(t, mutator.ActionDropped, entries["seccompProfiles[3]"].Action)
+	assert.Equal(t, mutator.ActionApproximated, entries["seccompProfiles"].Action)
+	assert.Contains(t, entries["seccompProfiles"].Message, "docker/default")
+	assert.Contains(t, entries["seccompProfiles"].Message, "localhost profile names")
+}
+
+func TestMutateKyvernoPermissiveSCC(t *testing.T) {
+	m := newMutatorFromFileData(t, "full.json")
+	output := m.MutateKyverno()
+
+	rules := kyvernoRules(t, output.ClusterPolicy)
+
+	assert.Contains(t, rules, "selinux")
+	assert.NotContains(t, rules, "host-ports")
+	assert.NotContains(t, rules, "run-as-user")
+	assert.NotContains(t, rules, "privilege-escalation")
+
+	conditions, _, _ := unstructured.NestedSlice(rules["selinux"], "preconditions", "any")
+	assert.Equal(t, 1, len(conditions))
+	assert.Equal(t, "{{ request.userInfo.groups }}", conditions[0].(map[string]interface{})["key"])
+
+	allowed, _, _ := unstructured.NestedSlice(rules["volume-types"], "validate", "deny", "conditions", "all")
+	assert.Contains(t, allowed[0].(map[string]interface{})["value"], "hostPath")
+
+	// every seccomp profile is allowed
+	assert.NotContains(t, rules, "seccomp-profiles")
+
+	// the grant to system:authenticated applies the policy to every pod
+	found := false
+	for _, entry := range output.Report.Entries {
+		if entry.Path == "groups" {
+			found = true
+			assert.Equal(t, mutator.SeverityHigh, entry.Severity)
+			assert.Equal(t, "system:authenticated", entry.Original)
+		}
+	}
+	assert.True(t, found)
+}
+
+func TestMutateKyvernoWithoutSubjects(t *testing.T) {
+	scc := newRestrictedV2SCC()
+	scc.RunAsUser.Type = security.RunAsUserStrategyMustRunAsRange
+
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	output := m.MutateKyverno()
+
+	assert.Nil(t, output.ClusterPolicy)
+	assert.Equal(t, 1, len(output.Report.Entries))
+	assert.Equal(t, mutator.ActionDropped, output.Report.Entries[0].Action)
+}
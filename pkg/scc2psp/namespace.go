@@ -0,0 +1,291 @@
+package scc2psp
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	security "github.com/openshift/api/security/v1"
+	v1 "k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	rbac "k8s.io/api/rbac/v1"
+)
+
+// annotations set by OpenShift on every namespace with the ranges allocated to it
+const (
+	uidRangeAnnotation           = "openshift.io/sa.scc.uid-range"
+	supplementalGroupsAnnotation = "openshift.io/sa.scc.supplemental-groups"
+	mcsAnnotation                = "openshift.io/sa.scc.mcs"
+)
+
+// NamespacePolicy contains the PodSecurityPolicy resolved with the ranges of a namespace, and the RBAC objects
+// granting its use to the service accounts of the namespace
+type NamespacePolicy struct {
+	Namespace         string
+	PodSecurityPolicy policy.PodSecurityPolicy
+	ClusterRole       rbac.ClusterRole
+	RoleBinding       rbac.RoleBinding
+}
+
+// needsNamespaceRanges checks whether the SCC leaves any range to the namespace annotations
+func (m *Mutator) needsNamespaceRanges() bool {
+	return m.needsNamespaceUIDRange() || m.needsNamespaceGroups() || m.needsNamespaceMCS()
+}
+
+func (m *Mutator) needsNamespaceUIDRange() bool {
+	scc := m.input
+
+	return scc.RunAsUser.Type == security.RunAsUserStrategyMustRunAsRange && (scc.RunAsUser.UIDRangeMin == nil || scc.RunAsUser.UIDRangeMax == nil)
+}
+
+func (m *Mutator) needsNamespaceGroups() bool {
+	return m.needsNamespaceFSGroup() || m.needsNamespaceSupplementalGroups()
+}
+
+func (m *Mutator) needsNamespaceFSGroup() bool {
+	scc := m.input
+
+	return scc.FSGroup.Type == security.FSGroupStrategyMustRunAs && len(scc.FSGroup.Ranges) == 0
+}
+
+func (m *Mutator) needsNamespaceSupplementalGroups() bool {
+	scc := m.input
+
+	return scc.SupplementalGroups.Type == security.SupplementalGroupsStrategyMustRunAs && len(scc.SupplementalGroups.Ranges) == 0
+}
+
+func (m *Mutator) needsNamespaceMCS() bool {
+	scc := m.input
+
+	return scc.SELinuxContext.Type == security.SELinuxStrategyMustRunAs && (scc.SELinuxContext.SELinuxOptions == nil || scc.SELinuxContext.SELinuxOptions.Level == "")
+}
+
+// buildNamespacePolicies creates a NamespacePolicy for each given namespace of the SCC service accounts
+// when the SCC takes its ranges from the namespace
+func (m *Mutator) buildNamespacePolicies(psp policy.PodSecurityPolicy) ([]NamespacePolicy, error) {
+	if len(m.options.Namespaces) == 0 || !m.needsNamespaceRanges() {
+		return nil, nil
+	}
+
+	namespaces := map[string]v1.Namespace{}
+	for _, namespace := range m.options.Namespaces {
+		namespaces[namespace.Name] = namespace
+	}
+
+	subjects, names := m.serviceAccountSubjects()
+	policies := []NamespacePolicy{}
+
+	for _, name := range names {
+		namespace, found := namespaces[name]
+		if !found {
+			m.report.Defaulted("users", mutator.SeverityWarning, name,
+				"namespace "+name+" is not given, its service accounts are bound to the cluster wide PodSecurityPolicy")
+			continue
+		}
+
+		namespacePsp := *psp.DeepCopy()
+		namespacePsp.Name = psp.Name + "-" + name
+
+		resolved, err := m.applyNamespaceRanges(&namespacePsp.Spec, namespace)
+		if err != nil {
+			return nil, err
+		}
+
+		if !resolved {
+			continue
+		}
+
+		m.resolvedNamespaces[name] = true
+
+		policies = append(policies, NamespacePolicy{
+			Namespace:         name,
+			PodSecurityPolicy: namespacePsp,
+			ClusterRole:       m.buildPspClusterRole(namespacePsp.Name),
+			RoleBinding:       m.buildRoleBinding(name, namespacePsp.Name, subjects[name]),
+		})
+	}
+
+	m.log.Debugf("[%s] mutated namespace policies = %#v", m.name, policies)
+
+	return policies, nil
+}
+
+// reportUnresolvedRanges reports the RunAsAny rules the cluster wide PSP uses in place of the UID range,
+// groups ranges and MCS level the SCC takes from the namespace, naming the namespaces of the subjects still
+// bound to it
+func (m *Mutator) reportUnresolvedRanges(output *MutatorOutput) {
+	scc := m.input
+
+	unresolved := map[string]bool{}
+	clusterWide := false
+
+	for _, subject := range output.ClusterRoleBinding.Subjects {
+		if namespace, ok := subjectNamespace(subject); ok {
+			unresolved[namespace] = true
+		} else {
+			clusterWide = true
+		}
+	}
+
+	for _, rb := range output.RoleBindings {
+		unresolved[rb.Namespace] = true
+	}
+
+	if len(unresolved) == 0 && !clusterWide {
+		return
+	}
+
+	namespaces := []string{}
+	for namespace := range unresolved {
+		namespaces = append(namespaces, namespace)
+	}
+	sort.Strings(namespaces)
+
+	strategies := []struct {
+		path     string
+		needed   bool
+		original interface{}
+		value    string
+		allowed  string
+	}{
+		{"runAsUser.type", m.needsNamespaceUIDRange(), scc.RunAsUser.Type, "UID range", "as any user"},
+		{"seLinuxContext.type", m.needsNamespaceMCS(), scc.SELinuxContext.Type, "MCS level", "with any SELinux context"},
+		{"fsGroup.type", m.needsNamespaceFSGroup(), scc.FSGroup.Type, "FSGroup range", "with any FSGroup"},
+		{"supplementalGroups.type", m.needsNamespaceSupplementalGroups(), scc.SupplementalGroups.Type,
+			"supplemental groups range", "with any supplemental group"},
+	}
+
+	for _, strategy := range strategies {
+		if !strategy.needed {
+			continue
+		}
+
+		message := "the SCC takes the " + strategy.value + " from the namespace, RunAsAny is used instead"
+		if len(namespaces) > 0 {
+			message += " and pods of the namespaces " + strings.Join(namespaces, ", ") + " may run " + strategy.allowed +
+				" unless these namespaces are given to resolve their " + strategy.value
+		}
+		if clusterWide {
+			message += ", the users and groups bound cluster wide may run pods " + strategy.allowed + " in every namespace"
+		}
+
+		m.report.Defaulted(strategy.path, mutator.SeverityHigh, strategy.original, message)
+	}
+}
+
+// applyNamespaceRanges sets the ranges the SCC leaves to the namespace in the PSP spec. It returns false
+// when the namespace misses one of the annotations.
+func (m *Mutator) applyNamespaceRanges(spec *policy.PodSecurityPolicySpec, namespace v1.Namespace) (bool, error) {
+	annotation := func(key string) (string, bool) {
+		value, found := namespace.Annotations[key]
+		if !found {
+			m.report.Defaulted("users", mutator.SeverityWarning, namespace.Name,
+				"namespace "+namespace.Name+" has no "+key+" annotation, its service accounts are bound to the cluster wide PodSecurityPolicy")
+		}
+
+		return value, found
+	}
+
+	if m.needsNamespaceUIDRange() {
+		value, found := annotation(uidRangeAnnotation)
+		if !found {
+			return false, nil
+		}
+
+		ranges, err := parseIDBlocks(value)
+		if err != nil {
+			return false, fmt.Errorf("namespace %s annotation %s: %v", namespace.Name, uidRangeAnnotation, err)
+		}
+
+		spec.RunAsUser.Rule = policy.RunAsUserStrategyMustRunAs
+		spec.RunAsUser.Ranges = ranges[:1]
+	}
+
+	if m.needsNamespaceGroups() {
+		// OpenShift allocates the groups from the UID range when the namespace has no group annotation
+		key := supplementalGroupsAnnotation
+		if _, found := namespace.Annotations[key]; !found {
+			key = uidRangeAnnotation
+		}
+
+		value, found := annotation(key)
+		if !found {
+			return false, nil
+		}
+
+		ranges, err := parseIDBlocks(value)
+		if err != nil {
+			return false, fmt.Errorf("namespace %s annotation %s: %v", namespace.Name, key, err)
+		}
+
+		if m.needsNamespaceFSGroup() {
+			spec.FSGroup.Rule = policy.FSGroupStrategyMustRunAs
+			spec.FSGroup.Ranges = ranges[:1]
+		}
+
+		if m.needsNamespaceSupplementalGroups() {
+			spec.SupplementalGroups.Rule = policy.SupplementalGroupsStrategyMustRunAs
+			spec.SupplementalGroups.Ranges = ranges
+		}
+	}
+
+	if m.needsNamespaceMCS() {
+		value, found := annotation(mcsAnnotation)
+		if !found {
+			return false, nil
+		}
+
+		spec.SELinux.Rule = policy.SELinuxStrategyMustRunAs
+
+		if spec.SELinux.SELinuxOptions == nil {
+			spec.SELinux.SELinuxOptions = &v1.SELinuxOptions{}
+		}
+
+		spec.SELinux.SELinuxOptions.Level = value
+	}
+
+	return true, nil
+}
+
+// parseIDBlocks parses the comma separated <start>/<size> or <start>-<end> blocks of a namespace annotation
+func parseIDBlocks(value string) ([]policy.IDRange, error) {
+	ranges := []policy.IDRange{}
+
+	for _, block := range strings.Split(value, ",") {
+		block = strings.TrimSpace(block)
+
+		separator := "/"
+		if !strings.Contains(block, separator) {
+			separator = "-"
+		}
+
+		parts := strings.SplitN(block, separator, 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid block %q", block)
+		}
+
+		start, err := strconv.ParseInt(parts[0], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block %q: %v", block, err)
+		}
+
+		end, err := strconv.ParseInt(parts[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid block %q: %v", block, err)
+		}
+
+		if separator == "/" {
+			end = start + end - 1
+		}
+
+		if start < 0 || end < start {
+			return nil, fmt.Errorf("invalid block %q", block)
+		}
+
+		ranges = append(ranges, policy.IDRange{Min: start, Max: end})
+	}
+
+	return ranges, nil
+}
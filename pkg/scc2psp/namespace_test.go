@@ -0,0 +1,177 @@
+package scc2psp
+
+import (
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	security "github.com/openshift/api/security/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+	"k8s.io/api/policy/v1beta1"
+)
+
+func newAnnotatedNamespace(name string, annotations map[string]string) v1.Namespace {
+	namespace := v1.Namespace{}
+	namespace.Name = name
+	namespace.Annotations = annotations
+
+	return namespace
+}
+
+func TestMutateNamespacePolicies(t *testing.T) {
+	scc := newRestrictedV2SCC()
+	scc.Users = []string{"system:serviceaccount:web:default", "system:serviceaccount:api:builder", "alice"}
+	scc.Groups = []string{"system:serviceaccounts:web"}
+
+	options := DefaultOptions()
+	options.Namespaces = []v1.Namespace{
+		newAnnotatedNamespace("web", map[string]string{
+			"openshift.io/sa.scc.uid-range":           "1000650000/10000",
+			"openshift.io/sa.scc.supplemental-groups": "1000650000/10000,2000-2999",
+			"openshift.io/sa.scc.mcs":                 "s0:c26,c5",
+		}),
+		newAnnotatedNamespace("api", map[string]string{}),
+	}
+
+	m := NewMutator(clientName, logrus.New(), scc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	// the cluster wide policy is still weakened for the subjects not resolved
+	assert.Equal(t, v1beta1.RunAsUserStrategy("RunAsAny"), output.PodSecurityPolicy.Spec.RunAsUser.Rule)
+
+	assert.Equal(t, 1, len(output.NamespacePolicies))
+	namespacePolicy := output.NamespacePolicies[0]
+	psp := namespacePolicy.PodSecurityPolicy
+
+	assert.Equal(t, "web", namespacePolicy.Namespace)
+	assert.Equal(t, "restricted-v2-web", psp.Name)
+	assert.Equal(t, v1beta1.RunAsUserStrategyMustRunAs, psp.Spec.RunAsUser.Rule)
+	assert.Equal(t, []v1beta1.IDRange{{Min: 1000650000, Max: 1000659999}}, psp.Spec.RunAsUser.Ranges)
+	assert.Equal(t, []v1beta1.IDRange{{Min: 1000650000, Max: 1000659999}}, psp.Spec.FSGroup.Ranges)
+	assert.Equal(t, "s0:c26,c5", psp.Spec.SELinux.SELinuxOptions.Level)
+
+	assert.Equal(t, "vmware-psp:restricted-v2-web", namespacePolicy.ClusterRole.Name)
+	assert.Equal(t, []string{"restricted-v2-web"}, namespacePolicy.ClusterRole.Rules[0].ResourceNames)
+	assert.Equal(t, "web", namespacePolicy.RoleBinding.Namespace)
+	assert.Equal(t, 2, len(namespacePolicy.RoleBinding.Subjects))
+
+	// the resolved service accounts are not bound to the cluster wide policy anymore
+	names := []string{}
+	for _, subject := range output.ClusterRoleBinding.Subjects {
+		names = append(names, subject.Name)
+	}
+	assert.Equal(t, []string{"builder", "alice"}, names)
+
+	missing := []interface{}{}
+	for _, entry := range output.Report.Entries {
+		if entry.Path == "users" && entry.Action == mutator.ActionDefaulted {
+			missing = append(missing, entry.Original)
+		}
+	}
+	assert.Equal(t, []interface{}{"api"}, missing)
+}
+
+func TestMutateUnresolvedNamespaceRanges(t *testing.T) {
+	scc := newRestrictedV2SCC()
+	scc.SupplementalGroups.Type = security.SupplementalGroupsStrategyMustRunAs
+	scc.Groups = []string{"system:authenticated"}
+
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	// the cluster wide policy cannot enforce the strategies without their values
+	spec := output.PodSecurityPolicy.Spec
+	assert.Equal(t, v1beta1.SELinuxStrategyRunAsAny, spec.SELinux.Rule)
+	assert.Equal(t, v1beta1.FSGroupStrategyRunAsAny, spec.FSGroup.Rule)
+	assert.Equal(t, v1beta1.SupplementalGroupsStrategyRunAsAny, spec.SupplementalGroups.Rule)
+
+	entries := output.Report.ByPath()
+
+	for _, path := range []string{"runAsUser.type", "seLinuxContext.type", "fsGroup.type", "supplementalGroups.type"} {
+		assert.Equal(t, mutator.ActionDefaulted, entries[path].Action, path)
+		assert.Equal(t, mutator.SeverityHigh, entries[path].Severity, path)
+		assert.Contains(t, entries[path].Message, "bound cluster wide", path)
+	}
+	assert.Contains(t, entries["seLinuxContext.type"].Message, "MCS level")
+
+	// the namespace policies resolve the strategies of the given namespaces
+	scc.Groups = nil
+	scc.Users = []string{"system:serviceaccount:web:default", "system:serviceaccount:api:builder"}
+
+	options := DefaultOptions()
+	options.Namespaces = []v1.Namespace{
+		newAnnotatedNamespace("web", map[string]string{
+			"openshift.io/sa.scc.uid-range":           "1000650000/10000",
+			"openshift.io/sa.scc.supplemental-groups": "1000650000/10000",
+			"openshift.io/sa.scc.mcs":                 "s0:c26,c5",
+		}),
+	}
+
+	m = NewMutator(clientName, logrus.New(), scc, options)
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+
+	spec = output.NamespacePolicies[0].PodSecurityPolicy.Spec
+	assert.Equal(t, v1beta1.SELinuxStrategyMustRunAs, spec.SELinux.Rule)
+	assert.Equal(t, "s0:c26,c5", spec.SELinux.SELinuxOptions.Level)
+	assert.Equal(t, v1beta1.FSGroupStrategyMustRunAs, spec.FSGroup.Rule)
+	assert.Equal(t, v1beta1.SupplementalGroupsStrategyMustRunAs, spec.SupplementalGroups.Rule)
+	assert.Equal(t, []v1beta1.IDRange{{Min: 1000650000, Max: 1000659999}}, spec.SupplementalGroups.Ranges)
+
+	entries = output.Report.ByPath()
+
+	for _, path := range []string{"seLinuxContext.type", "fsGroup.type", "supplementalGroups.type"} {
+		assert.Contains(t, entries[path].Message, "namespaces api may run", path)
+		assert.NotContains(t, entries[path].Message, "web", path)
+	}
+}
+
+func TestMutateNamespacePoliciesInvalidAnnotation(t *testing.T) {
+	scc := newRestrictedV2SCC()
+	scc.Users = []string{"system:serviceaccount:web:default"}
+
+	options := DefaultOptions()
+	options.Namespaces = []v1.Namespace{
+		newAnnotatedNamespace("web", map[string]string{"openshift.io/sa.scc.uid-range": "1000650000"}),
+	}
+
+	m := NewMutator(clientName, logrus.New(), scc, options)
+	_, err := m.Mutate()
+	assert.Error(t, err)
+}
+
+func TestMutateExplicitUIDRange(t *testing.T) {
+	scc := newRestrictedV2SCC()
+	scc.Users = []string{"system:serviceaccount:web:default"}
+	uidMin, uidMax := int64(1000), int64(2000)
+	scc.RunAsUser.UIDRangeMin = &uidMin
+	scc.RunAsUser.UIDRangeMax = &uidMax
+	scc.FSGroup.Type = security.FSGroupStrategyRunAsAny
+	scc.SELinuxContext.SELinuxOptions = &v1.SELinuxOptions{Level: "s0:c1,c0"}
+
+	options := DefaultOptions()
+	options.Namespaces = []v1.Namespace{newAnnotatedNamespace("web", nil)}
+
+	m := NewMutator(clientName, logrus.New(), scc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	// nothing is left to the namespace
+	assert.Equal(t, 0, len(output.NamespacePolicies))
+	assert.Equal(t, v1beta1.RunAsUserStrategyMustRunAs, output.PodSecurityPolicy.Spec.RunAsUser.Rule)
+	assert.Equal(t, []v1beta1.IDRange{{Min: 1000, Max: 2000}}, output.PodSecurityPolicy.Spec.RunAsUser.Ranges)
+}
+
+func TestParseIDBlocks(t *testing.T) {
+	ranges, err := parseIDBlocks("1000650000/10000, 5-10")
+	assert.NoError(t, err)
+	assert.Equal(t, []v1beta1.IDRange{{Min: 1000650000, Max: 1000659999}, {Min: 5, Max: 10}}, ranges)
+
+	for _, value := range []string{"", "1000", "a/10", "10-5", "10/x"} {
+		_, err := parseIDBlocks(value)
+		assert.Error(t, err, value)
+	}
+}
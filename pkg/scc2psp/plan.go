@@ -0,0 +1,305 @@
+package scc2psp
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	security "github.com/openshift/api/security/v1"
+	"github.com/sirupsen/logrus"
+	rbac "k8s.io/api/rbac/v1"
+)
+
+// restrictiveness points OpenShift gives to the SCC permissions to order SCCs of the same priority, the
+// least permissive SCC being tried first
+const (
+	privilegedPoints       = 200000
+	hostVolumePoints       = 100000
+	nonTrivialVolumePoints = 50000
+	runAsAnyUserPoints     = 40000
+	runAsNonRootPoints     = 30000
+	runAsRangePoints       = 20000
+	runAsUserPoints        = 10000
+	capDefaultPoints       = 5000
+	capAllowAllPoints      = 4000
+	capAllowOnePoints      = 10
+	capDropAllPoints       = -3000
+	capDropOnePoints       = -50
+	capMaxPoints           = 9999
+	capMinPoints           = 0
+)
+
+// volumes not adding any points to an SCC
+var trivialVolumes = map[security.FSType]bool{
+	security.FSTypeConfigMap:             true,
+	security.FSTypeDownwardAPI:           true,
+	security.FSTypeEmptyDir:              true,
+	security.FSTypePersistentVolumeClaim: true,
+	security.FSProjected:                 true,
+	security.FSTypeSecret:                true,
+	security.FSTypeNone:                  true,
+}
+
+// SubjectPlan lists the SCCs a subject can use, directly or through the groups OpenShift puts it in, in
+// the order OpenShift tries them: pods are admitted by the first SCC validating them
+type SubjectPlan struct {
+	Subject rbac.Subject
+	SCCs    []string
+}
+
+// PlanOutput contains the translation of a set of SecurityContextConstraints
+type PlanOutput struct {
+	// Order holds the SCC names in the order OpenShift tries them
+	Order []string
+	// Policies holds the mutation of each SCC in Order. The PodSecurityPolicies are named after their
+	// position so PodSecurityPolicy admission, choosing policies alphabetically, tries them in the same order.
+	Policies []MutatorOutput
+	Subjects []SubjectPlan
+	Report   mutator.Report
+}
+
+// Planner converts all the SecurityContextConstraints of a cluster together
+type Planner struct {
+	name    string
+	log     logrus.FieldLogger
+	input   []security.SecurityContextConstraints
+	options Options
+}
+
+// NewPlanner creates a new Planner. Clients of this API should set a meaningful name that can be used
+// to easily identify the calling client.
+func NewPlanner(name string, log logrus.FieldLogger, sccs []security.SecurityContextConstraints, options Options) Planner {
+	return Planner{
+		name:    name,
+		log:     log,
+		input:   sccs,
+		options: options,
+	}
+}
+
+// Plan orders the SCCs as OpenShift does, converts each of them and computes the SCCs each subject can use
+func (p *Planner) Plan() (*PlanOutput, error) {
+	sccs := make([]security.SecurityContextConstraints, len(p.input))
+	copy(sccs, p.input)
+	sortSCCs(sccs)
+
+	output := &PlanOutput{}
+	grants := map[string]*SubjectPlan{}
+	width := len(fmt.Sprint(len(sccs)))
+
+	for i, scc := range sccs {
+		output.Order = append(output.Order, scc.Name)
+
+		ordered := *scc.DeepCopy()
+		ordered.Name = fmt.Sprintf("%0*d-%s", width, i, scc.Name)
+
+		m := NewMutator(p.name, p.log, ordered, p.options)
+
+		policy, err := m.Mutate()
+		if err != nil {
+			return nil, fmt.Errorf("SecurityContextConstraints %s: %v", scc.Name, err)
+		}
+
+		output.Policies = append(output.Policies, *policy)
+
+		for _, subject := range m.grantedSubjects() {
+			key := subjectKey(subject)
+
+			if _, found := grants[key]; !found {
+				grants[key] = &SubjectPlan{Subject: subject}
+			}
+
+			grants[key].SCCs = append(grants[key].SCCs, scc.Name)
+		}
+	}
+
+	output.Subjects = effectiveSubjectPlans(grants, output.Order)
+
+	for _, plan := range output.Subjects {
+		if len(plan.SCCs) > 1 {
+			output.Report.Approximated("subjects", mutator.SeverityWarning, plan.Subject.Name,
+				fmt.Sprintf("%s %s can use %s, which OpenShift tries in that order, PodSecurityPolicy admission prefers "+
+					"the policies admitting the pod without changing it", plan.Subject.Kind, subjectKey(plan.Subject),
+					strings.Join(plan.SCCs, ", ")))
+		}
+	}
+
+	p.log.Debugf("[%s] plan = %#v", p.name, output)
+
+	return output, nil
+}
+
+// grantedSubjects returns the SCC users and groups left by the subject filters, without translating the
+// OpenShift groups
+func (m *Mutator) grantedSubjects() []rbac.Subject {
+	subjects := []rbac.Subject{}
+
+	for _, user := range m.input.Users {
+		if !m.subjectAllowed(user) {
+			continue
+		}
+
+		if subject, ok := buildUserSubject(user); ok {
+			subjects = append(subjects, subject)
+		}
+	}
+
+	for _, group := range m.input.Groups {
+		if m.subjectAllowed(group) {
+			subjects = append(subjects, buildGroupSubject(group))
+		}
+	}
+
+	return subjects
+}
+
+// effectiveSubjectPlans adds to the users and service accounts the SCCs granted to the groups OpenShift
+// puts them in, and sorts the SCCs of every subject in the given order
+func effectiveSubjectPlans(grants map[string]*SubjectPlan, order []string) []SubjectPlan {
+	position := map[string]int{}
+	for i, name := range order {
+		position[name] = i
+	}
+
+	groupSCCs := func(group string) []string {
+		if plan, found := grants[subjectKey(buildGroupSubject(group))]; found {
+			return plan.SCCs
+		}
+
+		return nil
+	}
+
+	plans := []SubjectPlan{}
+
+	for _, grant := range grants {
+		sccs := append([]string{}, grant.SCCs...)
+
+		switch grant.Subject.Kind {
+		case "ServiceAccount":
+			sccs = append(sccs, groupSCCs(authenticatedGroup)...)
+			sccs = append(sccs, groupSCCs(allServiceAccountsGroup)...)
+			sccs = append(sccs, groupSCCs(allServiceAccountsGroup+":"+grant.Subject.Namespace)...)
+		case "User":
+			sccs = append(sccs, groupSCCs(authenticatedGroup)...)
+			sccs = append(sccs, groupSCCs(authenticatedGroup+":oauth")...)
+		}
+
+		seen := map[string]bool{}
+		unique := []string{}
+		for _, scc := range sccs {
+			if !seen[scc] {
+				seen[scc] = true
+				unique = append(unique, scc)
+			}
+		}
+
+		sort.Slice(unique, func(i, j int) bool { return position[unique[i]] < position[unique[j]] })
+
+		plans = append(plans, SubjectPlan{Subject: grant.Subject, SCCs: unique})
+	}
+
+	sort.Slice(plans, func(i, j int) bool { return subjectKey(plans[i].Subject) < subjectKey(plans[j].Subject) })
+
+	return plans
+}
+
+func subjectKey(subject rbac.Subject) string {
+	if subject.Kind == "ServiceAccount" {
+		return "system:serviceaccount:" + subject.Namespace + ":" + subject.Name
+	}
+
+	return subject.Name
+}
+
+// sortSCCs orders the SCCs by decreasing priority, then from the most to the least restrictive, then by name
+func sortSCCs(sccs []security.SecurityContextConstraints) {
+	priority := func(scc security.SecurityContextConstraints) int32 {
+		if scc.Priority == nil {
+			return 0
+		}
+
+		return *scc.Priority
+	}
+
+	sort.SliceStable(sccs, func(i, j int) bool {
+		if priority(sccs[i]) != priority(sccs[j]) {
+			return priority(sccs[i]) > priority(sccs[j])
+		}
+
+		if restrictivenessPoints(sccs[i]) != restrictivenessPoints(sccs[j]) {
+			return restrictivenessPoints(sccs[i]) < restrictivenessPoints(sccs[j])
+		}
+
+		return sccs[i].Name < sccs[j].Name
+	})
+}
+
+// restrictivenessPoints scores the permissions granted by an SCC, the higher the more permissive
+func restrictivenessPoints(scc security.SecurityContextConstraints) int {
+	points := 0
+
+	if scc.AllowPrivilegedContainer {
+		points += privilegedPoints
+	}
+
+	volumePoints := 0
+	if scc.AllowHostDirVolumePlugin {
+		volumePoints = hostVolumePoints
+	}
+
+	for _, volume := range scc.Volumes {
+		switch {
+		case volume == security.FSTypeAll || volume == security.FSTypeHostPath:
+			volumePoints = hostVolumePoints
+		case !trivialVolumes[volume] && volumePoints < nonTrivialVolumePoints:
+			volumePoints = nonTrivialVolumePoints
+		}
+	}
+	points += volumePoints
+
+	switch scc.SELinuxContext.Type {
+	case security.SELinuxStrategyRunAsAny:
+		points += runAsAnyUserPoints
+	case security.SELinuxStrategyMustRunAs:
+		points += runAsUserPoints
+	}
+
+	switch scc.RunAsUser.Type {
+	case security.RunAsUserStrategyRunAsAny:
+		points += runAsAnyUserPoints
+	case security.RunAsUserStrategyMustRunAsNonRoot:
+		points += runAsNonRootPoints
+	case security.RunAsUserStrategyMustRunAsRange:
+		points += runAsRangePoints
+	case security.RunAsUserStrategyMustRunAs:
+		points += runAsUserPoints
+	}
+
+	capPoints := len(scc.DefaultAddCapabilities) * capDefaultPoints
+
+	for _, capability := range scc.AllowedCapabilities {
+		if capability == security.AllowAllCapabilities {
+			capPoints += capAllowAllPoints
+		} else {
+			capPoints += capAllowOnePoints
+		}
+	}
+
+	for _, capability := range scc.RequiredDropCapabilities {
+		if capability == "ALL" {
+			capPoints += capDropAllPoints
+		} else {
+			capPoints += capDropOnePoints
+		}
+	}
+
+	switch {
+	case capPoints > capMaxPoints:
+		capPoints = capMaxPoints
+	case capPoints < capMinPoints:
+		capPoints = capMinPoints
+	}
+
+	return points + capPoints
+}
@@ -0,0 +1,112 @@
+package scc2psp
+
+import (
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	security "github.com/openshift/api/security/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	v1 "k8s.io/api/core/v1"
+)
+
+func TestSortSCCs(t *testing.T) {
+	anyuid := newRestrictedV2SCC()
+	anyuid.Name = "anyuid"
+	anyuid.RunAsUser.Type = security.RunAsUserStrategyRunAsAny
+	priority := int32(10)
+	anyuid.Priority = &priority
+
+	restricted := newRestrictedV2SCC()
+	restricted.Name = "restricted"
+
+	nonroot := newRestrictedV2SCC()
+	nonroot.Name = "nonroot"
+	nonroot.RunAsUser.Type = security.RunAsUserStrategyMustRunAsNonRoot
+
+	privileged := newRestrictedV2SCC()
+	privileged.Name = "privileged"
+	privileged.AllowPrivilegedContainer = true
+
+	sccs := []security.SecurityContextConstraints{privileged, nonroot, restricted, anyuid}
+	sortSCCs(sccs)
+
+	names := []string{}
+	for _, scc := range sccs {
+		names = append(names, scc.Name)
+	}
+
+	assert.Equal(t, []string{"anyuid", "restricted", "nonroot", "privileged"}, names)
+}
+
+func TestPlan(t *testing.T) {
+	restricted := newRestrictedV2SCC()
+	restricted.Name = "restricted"
+	restricted.Groups = []string{"system:authenticated"}
+	uidMin, uidMax := int64(1000), int64(2000)
+	restricted.RunAsUser.UIDRangeMin = &uidMin
+	restricted.RunAsUser.UIDRangeMax = &uidMax
+
+	anyuid := newRestrictedV2SCC()
+	anyuid.Name = "anyuid"
+	anyuid.RunAsUser.Type = security.RunAsUserStrategyRunAsAny
+	anyuid.Users = []string{"system:serviceaccount:web:default"}
+	priority := int32(10)
+	anyuid.Priority = &priority
+
+	hostaccess := newRestrictedV2SCC()
+	hostaccess.Name = "hostaccess"
+	hostaccess.AllowHostNetwork = true
+	hostaccess.RunAsUser.UIDRangeMin = &uidMin
+	hostaccess.RunAsUser.UIDRangeMax = &uidMax
+	hostaccess.Groups = []string{"system:serviceaccounts:web"}
+
+	p := NewPlanner(clientName, logrus.New(), []security.SecurityContextConstraints{hostaccess, restricted, anyuid}, DefaultOptions())
+	output, err := p.Plan()
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{"anyuid", "hostaccess", "restricted"}, output.Order)
+	assert.Equal(t, 3, len(output.Policies))
+	assert.Equal(t, "0-anyuid", output.Policies[0].PodSecurityPolicy.Name)
+	assert.Equal(t, "vmware-psp:0-anyuid", output.Policies[0].ClusterRole.Name)
+	assert.Equal(t, "2-restricted", output.Policies[2].PodSecurityPolicy.Name)
+
+	plans := map[string][]string{}
+	for _, plan := range output.Subjects {
+		plans[subjectKey(plan.Subject)] = plan.SCCs
+	}
+
+	assert.Equal(t, map[string][]string{
+		"system:serviceaccount:web:default": {"anyuid", "hostaccess", "restricted"},
+		"system:serviceaccounts:web":        {"hostaccess"},
+		"system:authenticated":              {"restricted"},
+	}, plans)
+
+	assert.Equal(t, 1, len(output.Report.Entries))
+	assert.Equal(t, mutator.ActionApproximated, output.Report.Entries[0].Action)
+	assert.Equal(t, "default", output.Report.Entries[0].Original)
+}
+
+func TestPlanInvalidSCC(t *testing.T) {
+	scc := newRestrictedV2SCC()
+	scc.Users = []string{"system:serviceaccount:web:default"}
+
+	options := DefaultOptions()
+	options.Namespaces = []v1.Namespace{newAnnotatedNamespace("web", map[string]string{"openshift.io/sa.scc.uid-range": "1000650000"})}
+
+	p := NewPlanner(clientName, logrus.New(), []security.SecurityContextConstraints{scc}, options)
+	_, err := p.Plan()
+	assert.Error(t, err)
+}
+
+func TestPlanMalformedUser(t *testing.T) {
+	scc := newRestrictedV2SCC()
+	scc.Users = []string{"system:serviceaccount:malformed", "system:serviceaccount:web:default"}
+
+	p := NewPlanner(clientName, logrus.New(), []security.SecurityContextConstraints{scc}, DefaultOptions())
+	output, err := p.Plan()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(output.Subjects))
+	assert.Equal(t, "default", output.Subjects[0].Subject.Name)
+}
@@ -0,0 +1,348 @@
+package scc2psp
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	security "github.com/openshift/api/security/v1"
+	core "k8s.io/api/core/v1"
+	rbac "k8s.io/api/rbac/v1"
+)
+
+// PodSecurityLevel is a Pod Security Standards level enforced by Pod Security Admission
+type PodSecurityLevel string
+
+const (
+	// PodSecurityPrivileged is the unrestricted level
+	PodSecurityPrivileged PodSecurityLevel = "privileged"
+	// PodSecurityBaseline prevents known privilege escalations
+	PodSecurityBaseline PodSecurityLevel = "baseline"
+	// PodSecurityRestricted follows the pod hardening best practices
+	PodSecurityRestricted PodSecurityLevel = "restricted"
+)
+
+// Pod Security Admission namespace labels
+const (
+	podSecurityEnforceLabel = "pod-security.kubernetes.io/enforce"
+	podSecurityAuditLabel   = "pod-security.kubernetes.io/audit"
+	podSecurityWarnLabel    = "pod-security.kubernetes.io/warn"
+)
+
+func (l PodSecurityLevel) rank() int {
+	switch l {
+	case PodSecurityRestricted:
+		return 0
+	case PodSecurityBaseline:
+		return 1
+	case PodSecurityPrivileged:
+		return 2
+	}
+
+	return -1
+}
+
+var (
+	// capabilities the baseline level allows to add
+	baselineCapabilities = map[core.Capability]bool{
+		"AUDIT_WRITE":      true,
+		"CHOWN":            true,
+		"DAC_OVERRIDE":     true,
+		"FOWNER":           true,
+		"FSETID":           true,
+		"KILL":             true,
+		"MKNOD":            true,
+		"NET_BIND_SERVICE": true,
+		"SETFCAP":          true,
+		"SETGID":           true,
+		"SETPCAP":          true,
+		"SETUID":           true,
+		"SYS_CHROOT":       true,
+	}
+
+	// SELinux types the baseline level allows to set
+	baselineSELinuxTypes = map[string]bool{
+		"":                 true,
+		"container_t":      true,
+		"container_init_t": true,
+		"container_kvm_t":  true,
+	}
+
+	// sysctls the baseline level allows to set
+	baselineSysctls = map[string]bool{
+		"kernel.shm_rmid_forced":              true,
+		"net.ipv4.ip_local_port_range":        true,
+		"net.ipv4.ip_unprivileged_port_start": true,
+		"net.ipv4.tcp_syncookies":             true,
+		"net.ipv4.ping_group_range":           true,
+	}
+
+	// volume types the restricted level allows
+	restrictedVolumes = map[security.FSType]bool{
+		security.FSTypeConfigMap:             true,
+		security.FSTypeCSI:                   true,
+		security.FSTypeDownwardAPI:           true,
+		security.FSTypeEmptyDir:              true,
+		"ephemeral":                          true,
+		security.FSTypePersistentVolumeClaim: true,
+		security.FSProjected:                 true,
+		security.FSTypeSecret:                true,
+		security.FSTypeNone:                  true,
+	}
+)
+
+// podSecurityRequirement is a permission granted by a SCC and the least restrictive level allowing it
+type podSecurityRequirement struct {
+	path     string
+	original interface{}
+	level    PodSecurityLevel
+	message  string
+}
+
+// PodSecurityOutput contains the Pod Security Admission equivalent of a SecurityContextConstraints
+type PodSecurityOutput struct {
+	// Level is the most restrictive level allowing every permission the SCC grants. Pods relying on the
+	// SCC to set their security context may still be rejected at this level.
+	Level PodSecurityLevel
+	// Namespaces holds the namespaces of the SCC service accounts, labelled with the chosen level
+	Namespaces []core.Namespace
+	Report     mutator.Report
+}
+
+// ClassifyPodSecurityLevel returns the most restrictive Pod Security Standards level allowing every
+// permission the SecurityContextConstraints grants. Pod Security Admission does not set the security context
+// of the pods as the SCC does, the pods relying on it are rejected by the restricted level.
+func ClassifyPodSecurityLevel(scc security.SecurityContextConstraints) PodSecurityLevel {
+	level := PodSecurityRestricted
+
+	for _, requirement := range podSecurityRequirements(scc) {
+		if requirement.level.rank() > level.rank() {
+			level = requirement.level
+		}
+	}
+
+	return level
+}
+
+// MutatePodSecurity converts the SecurityContextConstraints into Pod Security Admission labels on the
+// namespaces of its service accounts. An empty level selects the level the SCC is classified into, any
+// SCC permission exceeding the chosen level is reported as dropped.
+// As Pod Security Admission is namespace wide, callers converting several SCCs binding the same namespace
+// have to merge the labels.
+func (m *Mutator) MutatePodSecurity(level PodSecurityLevel) (*PodSecurityOutput, error) {
+	scc := m.input
+
+	output := &PodSecurityOutput{
+		Level: ClassifyPodSecurityLevel(scc),
+	}
+
+	if level == "" {
+		level = output.Level
+	}
+
+	if level.rank() < 0 {
+		return nil, fmt.Errorf("unknown pod security level %q", level)
+	}
+
+	for _, requirement := range podSecurityRequirements(scc) {
+		if requirement.level.rank() > level.rank() {
+			output.Report.Dropped(requirement.path, mutator.SeverityHigh, requirement.original,
+				fmt.Sprintf("%s, which requires the %s level: pods relying on it are rejected at the %s level",
+					requirement.message, requirement.level, level))
+		}
+	}
+
+	if level == PodSecurityRestricted {
+		reportRestrictedDefaults(scc, &output.Report)
+	}
+
+	m.reportMalformedUsers(&output.Report)
+
+	namespaces := map[string]bool{}
+	for _, subject := range m.buildClusterRoleBindingUserSubjects(scc, rbac.ClusterRoleBinding{}) {
+		if subject.Kind == "ServiceAccount" {
+			namespaces[subject.Namespace] = true
+		} else {
+			output.Report.Dropped("users", mutator.SeverityWarning, subject.Name,
+				"Pod Security Admission applies to namespaces, the grant to user "+subject.Name+" is not converted")
+		}
+	}
+
+	for _, group := range scc.Groups {
+		if !m.subjectAllowed(group) {
+			continue
+		}
+
+		if namespace, ok := serviceAccountGroupNamespace(group); ok {
+			namespaces[namespace] = true
+		} else {
+			output.Report.Dropped("groups", mutator.SeverityWarning, group,
+				"Pod Security Admission applies to namespaces, the grant to group "+group+" is not converted")
+		}
+	}
+
+	names := make([]string, 0, len(namespaces))
+	for name := range namespaces {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		namespace := core.Namespace{}
+		namespace.Kind = "Namespace"
+		namespace.APIVersion = "v1"
+		namespace.Name = name
+		namespace.Labels = map[string]string{
+			podSecurityEnforceLabel: string(level),
+			podSecurityAuditLabel:   string(level),
+			podSecurityWarnLabel:    string(level),
+		}
+
+		output.Namespaces = append(output.Namespaces, namespace)
+	}
+
+	m.log.Debugf("[%s] mutated pod security = %#v", m.name, output)
+
+	return output, nil
+}
+
+// reportRestrictedDefaults reports the security context fields the SCC sets on the pods and the restricted
+// level requires the pods to set themselves
+func reportRestrictedDefaults(scc security.SecurityContextConstraints, report *mutator.Report) {
+	report.Approximated("runAsUser", mutator.SeverityHigh, scc.RunAsUser,
+		"the SCC sets the UID of the pods, the restricted level rejects the pods that do not set runAsNonRoot themselves")
+	report.Approximated("allowPrivilegeEscalation", mutator.SeverityHigh, scc.AllowPrivilegeEscalation,
+		"the SCC sets allowPrivilegeEscalation to false, the restricted level rejects the containers that do not set it themselves")
+	report.Approximated("requiredDropCapabilities", mutator.SeverityHigh, scc.RequiredDropCapabilities,
+		"the SCC drops the capabilities from the pods, the restricted level rejects the containers that do not drop ALL themselves")
+
+	message := "the SCC enforces no seccomp profile"
+	if len(scc.SeccompProfiles) > 0 {
+		message = "the SCC assigns the seccomp profile " + scc.SeccompProfiles[0] + " to the pods"
+	}
+
+	report.Approximated("seccompProfiles", mutator.SeverityHigh, scc.SeccompProfiles,
+		message+", the restricted level rejects the pods that do not request the RuntimeDefault or Localhost profile themselves")
+}
+
+// podSecurityRequirements lists the SCC permissions that are not allowed by the restricted level
+func podSecurityRequirements(scc security.SecurityContextConstraints) []podSecurityRequirement {
+	requirements := []podSecurityRequirement{}
+
+	require := func(path string, original interface{}, level PodSecurityLevel, message string) {
+		requirements = append(requirements, podSecurityRequirement{path: path, original: original, level: level, message: message})
+	}
+
+	if scc.AllowPrivilegedContainer {
+		require("allowPrivilegedContainer", true, PodSecurityPrivileged, "privileged containers are allowed")
+	}
+
+	if scc.AllowHostNetwork {
+		require("allowHostNetwork", true, PodSecurityPrivileged, "the host network is allowed")
+	}
+
+	if scc.AllowHostPID {
+		require("allowHostPID", true, PodSecurityPrivileged, "the host PID namespace is allowed")
+	}
+
+	if scc.AllowHostIPC {
+		require("allowHostIPC", true, PodSecurityPrivileged, "the host IPC namespace is allowed")
+	}
+
+	if scc.AllowHostPorts {
+		require("allowHostPorts", true, PodSecurityPrivileged, "host ports are allowed")
+	}
+
+	if scc.AllowHostDirVolumePlugin {
+		require("allowHostDirVolumePlugin", true, PodSecurityPrivileged, "hostPath volumes are allowed")
+	}
+
+	for i, volume := range scc.Volumes {
+		path := fmt.Sprintf("volumes[%d]", i)
+
+		switch {
+		case volume == security.FSTypeAll || volume == security.FSTypeHostPath:
+			require(path, volume, PodSecurityPrivileged, "volume type "+string(volume)+" is allowed")
+		case !restrictedVolumes[volume]:
+			require(path, volume, PodSecurityBaseline, "volume type "+string(volume)+" is allowed")
+		}
+	}
+
+	if len(scc.AllowedFlexVolumes) > 0 {
+		require("allowedFlexVolumes", scc.AllowedFlexVolumes, PodSecurityBaseline, "flex volumes are allowed")
+	}
+
+	requireCapabilities := func(field string, capabilities []core.Capability) {
+		for i, capability := range capabilities {
+			path := fmt.Sprintf("%s[%d]", field, i)
+
+			switch {
+			case capability == security.AllowAllCapabilities || !baselineCapabilities[capability]:
+				require(path, capability, PodSecurityPrivileged, "capability "+string(capability)+" can be added")
+			case capability != "NET_BIND_SERVICE":
+				require(path, capability, PodSecurityBaseline, "capability "+string(capability)+" can be added")
+			}
+		}
+	}
+
+	requireCapabilities("allowedCapabilities", scc.AllowedCapabilities)
+	requireCapabilities("defaultAddCapabilities", scc.DefaultAddCapabilities)
+
+	dropsAll := false
+	for _, capability := range scc.RequiredDropCapabilities {
+		if capability == "ALL" {
+			dropsAll = true
+		}
+	}
+
+	if !dropsAll {
+		require("requiredDropCapabilities", scc.RequiredDropCapabilities, PodSecurityBaseline, "capabilities are not all dropped")
+	}
+
+	if scc.AllowPrivilegeEscalation == nil || *scc.AllowPrivilegeEscalation {
+		require("allowPrivilegeEscalation", scc.AllowPrivilegeEscalation, PodSecurityBaseline, "privilege escalation is allowed")
+	}
+
+	switch scc.SELinuxContext.Type {
+	case security.SELinuxStrategyMustRunAs:
+		options := scc.SELinuxContext.SELinuxOptions
+
+		if options != nil && (options.User != "" || options.Role != "" || !baselineSELinuxTypes[options.Type]) {
+			require("seLinuxContext.seLinuxOptions", options, PodSecurityPrivileged, "a custom SELinux user, role or type is set")
+		}
+	default:
+		require("seLinuxContext.type", scc.SELinuxContext.Type, PodSecurityPrivileged, "any SELinux context can be set")
+	}
+
+	switch scc.RunAsUser.Type {
+	case security.RunAsUserStrategyMustRunAsNonRoot:
+	case security.RunAsUserStrategyMustRunAs:
+		if scc.RunAsUser.UID == nil || *scc.RunAsUser.UID == 0 {
+			require("runAsUser.uid", scc.RunAsUser.UID, PodSecurityBaseline, "containers can run as root")
+		}
+	case security.RunAsUserStrategyMustRunAsRange:
+		if scc.RunAsUser.UIDRangeMin != nil && *scc.RunAsUser.UIDRangeMin == 0 {
+			require("runAsUser.uidRangeMin", *scc.RunAsUser.UIDRangeMin, PodSecurityBaseline, "containers can run as root")
+		}
+	default:
+		require("runAsUser.type", scc.RunAsUser.Type, PodSecurityBaseline, "containers can run as root")
+	}
+
+	for i, sysctl := range scc.AllowedUnsafeSysctls {
+		if !baselineSysctls[sysctl] {
+			require(fmt.Sprintf("allowedUnsafeSysctls[%d]", i), sysctl, PodSecurityPrivileged, "unsafe sysctl "+sysctl+" is allowed")
+		}
+	}
+
+	if len(scc.SeccompProfiles) == 0 {
+		require("seccompProfiles", scc.SeccompProfiles, PodSecurityBaseline, "no seccomp profile is enforced")
+	}
+
+	for i, profile := range scc.SeccompProfiles {
+		if profile == "*" || profile == "unconfined" {
+			require(fmt.Sprintf("seccompProfiles[%d]", i), profile, PodSecurityPrivileged, "unconfined seccomp profile is allowed")
+		}
+	}
+
+	return requirements
+}
@@ -0,0 +1,120 @@
+package scc2psp
+
+import (
+	"testing"
+
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
+	security "github.com/openshift/api/security/v1"
+	"github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	core "k8s.io/api/core/v1"
+)
+
+func newRestrictedV2SCC() security.SecurityContextConstraints {
+	allowPrivilegeEscalation := false
+
+	scc := security.SecurityContextConstraints{}
+	scc.Name = "restricted-v2"
+	scc.AllowPrivilegeEscalation = &allowPrivilegeEscalation
+	scc.AllowedCapabilities = []core.Capability{"NET_BIND_SERVICE"}
+	scc.RequiredDropCapabilities = []core.Capability{"ALL"}
+	scc.SELinuxContext.Type = security.SELinuxStrategyMustRunAs
+	scc.RunAsUser.Type = security.RunAsUserStrategyMustRunAsRange
+	scc.SupplementalGroups.Type = security.SupplementalGroupsStrategyRunAsAny
+	scc.FSGroup.Type = security.FSGroupStrategyMustRunAs
+	scc.SeccompProfiles = []string{"runtime/default"}
+	scc.Volumes = []security.FSType{"configMap", "downwardAPI", "emptyDir", "persistentVolumeClaim", "projected", "secret"}
+
+	return scc
+}
+
+func TestClassifyPodSecurityLevel(t *testing.T) {
+	scc := newRestrictedV2SCC()
+	assert.Equal(t, PodSecurityRestricted, ClassifyPodSecurityLevel(scc))
+
+	// the OpenShift restricted SCC does not drop all the capabilities nor enforce seccomp
+	scc.RequiredDropCapabilities = []core.Capability{"KILL", "MKNOD", "SETUID", "SETGID"}
+	scc.SeccompProfiles = nil
+	scc.AllowPrivilegeEscalation = nil
+	assert.Equal(t, PodSecurityBaseline, ClassifyPodSecurityLevel(scc))
+
+	scc.AllowedCapabilities = []core.Capability{"SYS_ADMIN"}
+	assert.Equal(t, PodSecurityPrivileged, ClassifyPodSecurityLevel(scc))
+
+	scc = newRestrictedV2SCC()
+	scc.SELinuxContext.Type = security.SELinuxStrategyRunAsAny
+	assert.Equal(t, PodSecurityPrivileged, ClassifyPodSecurityLevel(scc))
+
+	m := newMutatorFromFileData(t, "full.json")
+	assert.Equal(t, PodSecurityPrivileged, ClassifyPodSecurityLevel(m.input))
+}
+
+func TestMutatePodSecurity(t *testing.T) {
+	scc := newRestrictedV2SCC()
+	scc.Users = []string{"system:serviceaccount:web:default", "system:serviceaccount:api:builder", "system:serviceaccount:web:deployer", "alice"}
+	scc.Groups = []string{"system:authenticated", "system:serviceaccounts:jobs"}
+
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	output, err := m.MutatePodSecurity("")
+
+	assert.NoError(t, err)
+	assert.Equal(t, PodSecurityRestricted, output.Level)
+	assert.Equal(t, 3, len(output.Namespaces))
+	assert.Equal(t, "api", output.Namespaces[0].Name)
+	assert.Equal(t, "jobs", output.Namespaces[1].Name)
+	assert.Equal(t, "web", output.Namespaces[2].Name)
+	assert.Equal(t, "restricted", output.Namespaces[2].Labels["pod-security.kubernetes.io/enforce"])
+	assert.Equal(t, "restricted", output.Namespaces[2].Labels["pod-security.kubernetes.io/audit"])
+	assert.Equal(t, "restricted", output.Namespaces[2].Labels["pod-security.kubernetes.io/warn"])
+
+	// the user and group grants are lost, the pods have to set the fields the SCC defaults
+	dropped := []interface{}{}
+	approximated := []string{}
+	for _, entry := range output.Report.Entries {
+		switch entry.Action {
+		case mutator.ActionDropped:
+			assert.Equal(t, mutator.SeverityWarning, entry.Severity)
+			dropped = append(dropped, entry.Original)
+		case mutator.ActionApproximated:
+			assert.Equal(t, mutator.SeverityHigh, entry.Severity)
+			approximated = append(approximated, entry.Path)
+		}
+	}
+
+	assert.ElementsMatch(t, []interface{}{"alice", "system:authenticated"}, dropped)
+	assert.ElementsMatch(t, []string{"runAsUser", "allowPrivilegeEscalation", "requiredDropCapabilities", "seccompProfiles"}, approximated)
+	assert.Equal(t, 6, len(output.Report.Entries))
+}
+
+func TestMutatePodSecurityBaseline(t *testing.T) {
+	scc := newRestrictedV2SCC()
+	scc.Users = []string{"system:serviceaccount:web:default"}
+
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	output, err := m.MutatePodSecurity(PodSecurityBaseline)
+
+	assert.NoError(t, err)
+	assert.Equal(t, PodSecurityRestricted, output.Level)
+	assert.Equal(t, "baseline", output.Namespaces[0].Labels["pod-security.kubernetes.io/enforce"])
+
+	// the baseline level does not require the pods to set their security context
+	assert.Empty(t, output.Report.Entries)
+}
+
+func TestMutatePodSecurityExceedingLevel(t *testing.T) {
+	m := newMutatorFromFileData(t, "full.json")
+
+	output, err := m.MutatePodSecurity(PodSecurityBaseline)
+	assert.NoError(t, err)
+	assert.Equal(t, PodSecurityPrivileged, output.Level)
+
+	paths := []string{}
+	for _, entry := range output.Report.AtLeast(mutator.SeverityHigh) {
+		paths = append(paths, entry.Path)
+	}
+
+	assert.ElementsMatch(t, []string{"allowHostPorts", "allowHostDirVolumePlugin", "seLinuxContext.seLinuxOptions", "seccompProfiles[0]"}, paths)
+
+	_, err = m.MutatePodSecurity("strict")
+	assert.Error(t, err)
+}
@@ -1,51 +1,158 @@
 package scc2psp
 
 import (
+	"fmt"
 	"regexp"
+	"sort"
+	"strings"
 
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
 	security "github.com/openshift/api/security/v1"
 	"github.com/sirupsen/logrus"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/api/policy/v1beta1"
 	policy "k8s.io/api/policy/v1beta1"
 	rbac "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/runtime"
 )
 
-const rbacAPIGroup = "rbac.authorization.k8s.io"
+const (
+	rbacAPIGroup   = "rbac.authorization.k8s.io"
+	policyAPIGroup = "policy"
+
+	// DefaultRBACPrefix is the default prefix of the ClusterRole and ClusterRoleBinding names
+	DefaultRBACPrefix = "vmware-psp:"
+
+	// groups every service account, or every user, belongs to
+	allServiceAccountsGroup = "system:serviceaccounts"
+	authenticatedGroup      = "system:authenticated"
+)
+
+// PodSecurityPolicy seccomp annotations and profile names
+const (
+	seccompAllowedProfilesAnnotation = "seccomp.security.alpha.kubernetes.io/allowedProfileNames"
+	seccompDefaultProfileAnnotation  = "seccomp.security.alpha.kubernetes.io/defaultProfileName"
+
+	seccompAllowAll        = "*"
+	seccompRuntimeDefault  = "runtime/default"
+	seccompDockerDefault   = "docker/default"
+	seccompUnconfined      = "unconfined"
+	seccompLocalhostPrefix = "localhost/"
+)
+
+// openShiftGroups maps the groups only existing on OpenShift to the closest Kubernetes group, an empty
+// value meaning there is no equivalent
+var openShiftGroups = map[string]string{
+	"system:authenticated:oauth": "",
+	"system:cluster-admins":      "system:masters",
+	"system:cluster-readers":     "",
+}
+
+// Options configures the RBAC objects created by the Mutator
+type Options struct {
+	// RBACPrefix is prepended to the SCC name to name the ClusterRole and ClusterRoleBinding
+	RBACPrefix string
+	// Include, when set, restricts the bound users and groups to the ones it matches
+	Include *regexp.Regexp
+	// Exclude, when set, removes the users and groups it matches from the bindings
+	Exclude *regexp.Regexp
+	// NamespacedServiceAccounts binds the service accounts with a RoleBinding in their namespace instead
+	// of the ClusterRoleBinding, which then only holds the users and groups
+	NamespacedServiceAccounts bool
+	// Namespaces holds the namespaces of the SCC service accounts. Their openshift.io/sa.scc annotations
+	// resolve the UID, group and MCS ranges the SCC leaves to the namespace.
+	Namespaces []v1.Namespace
+}
+
+// DefaultOptions returns the Options naming the RBAC objects with DefaultRBACPrefix and excluding the
+// OpenShift, Velero and management-infra users and groups
+func DefaultOptions() Options {
+	return Options{
+		RBACPrefix: DefaultRBACPrefix,
+		Exclude:    userIgnores,
+	}
+}
 
 // MutatorOutput contains the mutated output structures
 type MutatorOutput struct {
 	PodSecurityPolicy  policy.PodSecurityPolicy
 	ClusterRole        rbac.ClusterRole
 	ClusterRoleBinding rbac.ClusterRoleBinding
+	// RoleBindings holds one RoleBinding per service account namespace when NamespacedServiceAccounts is set
+	RoleBindings []rbac.RoleBinding
+	// NamespacePolicies holds the policies of the service accounts whose namespace ranges are resolved
+	NamespacePolicies []NamespacePolicy
+	// FilteredSubjects holds the SCC users and groups removed by the Include and Exclude options
+	FilteredSubjects []rbac.Subject
+	Report           mutator.Report
 }
 
 // Mutator contains common atttributes and the mutation input source structure
 type Mutator struct {
-	name  string
-	log   logrus.FieldLogger
-	input security.SecurityContextConstraints
+	name    string
+	log     logrus.FieldLogger
+	input   security.SecurityContextConstraints
+	options Options
+	report  mutator.Report
+	// namespaces whose service accounts are bound to a NamespacePolicy
+	resolvedNamespaces map[string]bool
 }
 
 // NewMutator creates a new Mutator. Clients of this API should set a meaningful name that can be used
-// to easily identify the calling client.
-func NewMutator(name string, log logrus.FieldLogger, scc security.SecurityContextConstraints) Mutator {
+// to easily identify the calling client, and can start from DefaultOptions.
+func NewMutator(name string, log logrus.FieldLogger, scc security.SecurityContextConstraints, options Options) Mutator {
 	return Mutator{
-		name:  name,
-		log:   log,
-		input: scc,
+		name:    name,
+		log:     log,
+		input:   scc,
+		options: options,
 	}
 }
 
-// Mutate converts a SecurityContextsConstraints into PodSecurityPolicy, ClusterRole and ClusterRoleBinding
-func (m *Mutator) Mutate() *MutatorOutput {
+// Mutate converts a SecurityContextsConstraints into PodSecurityPolicy, ClusterRole and ClusterRoleBinding.
+// An error is returned when the generated RBAC objects would not authorise the use of the PodSecurityPolicy.
+func (m *Mutator) Mutate() (*MutatorOutput, error) {
 	m.log.Debugf("[%s] input to mutate = %#v", m.name, m.input)
+	m.report = mutator.Report{}
+	m.resolvedNamespaces = map[string]bool{}
+
+	psp := m.buildPsp()
 
-	return &MutatorOutput{
-		PodSecurityPolicy:  m.buildPsp(),
+	namespacePolicies, err := m.buildNamespacePolicies(psp)
+	if err != nil {
+		return nil, err
+	}
+
+	output := &MutatorOutput{
+		PodSecurityPolicy:  psp,
 		ClusterRole:        m.buildClusterRole(),
 		ClusterRoleBinding: m.buildClusterRoleBinding(),
+		RoleBindings:       m.buildRoleBindings(),
+		NamespacePolicies:  namespacePolicies,
+		FilteredSubjects:   m.filteredSubjects(),
+	}
+
+	m.reportMalformedUsers(&m.report)
+	m.reportGroupTranslations()
+	m.reportUnresolvedRanges(output)
+
+	for _, subject := range output.FilteredSubjects {
+		path := "users"
+		if subject.Kind == "Group" {
+			path = "groups"
+		}
+
+		m.report.Dropped(path, mutator.SeverityHigh, subject.Name,
+			subject.Kind+" "+subject.Name+" is filtered out and not bound to the ClusterRole")
+	}
+
+	output.Report = m.report
+
+	if err := validateOutput(output); err != nil {
+		return nil, err
 	}
+
+	return output, nil
 }
 
 func (m *Mutator) buildPsp() policy.PodSecurityPolicy {
@@ -57,6 +164,7 @@ func (m *Mutator) buildPsp() policy.PodSecurityPolicy {
 	psp.Name = scc.Name
 	psp.Namespace = scc.Namespace
 	psp.Annotations = m.annotateUnsupportedFields(scc)
+	m.translateSeccompProfiles(psp.Annotations)
 	psp.Labels = scc.Labels
 	psp.Spec.Privileged = scc.AllowPrivilegedContainer
 	psp.Spec.DefaultAddCapabilities = scc.DefaultAddCapabilities
@@ -71,6 +179,10 @@ func (m *Mutator) buildPsp() policy.PodSecurityPolicy {
 		}
 	}
 
+	if scc.AllowHostDirVolumePlugin && !hasVolume(psp.Spec.Volumes, policy.HostPath) && !hasVolume(psp.Spec.Volumes, policy.All) {
+		psp.Spec.Volumes = append(psp.Spec.Volumes, policy.HostPath)
+	}
+
 	if scc.AllowedFlexVolumes != nil {
 		psp.Spec.AllowedFlexVolumes = make([]policy.AllowedFlexVolume, len(scc.AllowedFlexVolumes))
 
@@ -82,6 +194,11 @@ func (m *Mutator) buildPsp() policy.PodSecurityPolicy {
 	psp.Spec.HostNetwork = scc.AllowHostNetwork
 	psp.Spec.HostPID = scc.AllowHostPID
 	psp.Spec.HostIPC = scc.AllowHostIPC
+
+	if scc.AllowHostPorts {
+		psp.Spec.HostPorts = []policy.HostPortRange{{Min: 0, Max: 65535}}
+	}
+
 	psp.Spec.DefaultAllowPrivilegeEscalation = scc.DefaultAllowPrivilegeEscalation
 	psp.Spec.AllowPrivilegeEscalation = scc.AllowPrivilegeEscalation
 	psp.Spec.SELinux.Rule = v1beta1.SELinuxStrategy(scc.SELinuxContext.Type)
@@ -94,10 +211,19 @@ func (m *Mutator) buildPsp() policy.PodSecurityPolicy {
 		psp.Spec.SELinux.SELinuxOptions.Level = scc.SELinuxContext.SELinuxOptions.Level
 	}
 
+	// PSP admission cannot enforce a MustRunAs strategy without its values, the values the SCC takes from
+	// the namespace are resolved by the NamespacePolicies and reported otherwise
+	if m.needsNamespaceMCS() {
+		psp.Spec.SELinux.Rule = policy.SELinuxStrategyRunAsAny
+	}
+
 	psp.Spec.RunAsUser.Rule = "RunAsAny"
 
-	if scc.RunAsUser.Type != "MustRunAsRange" {
+	switch {
+	case scc.RunAsUser.Type != security.RunAsUserStrategyMustRunAsRange:
 		psp.Spec.RunAsUser.Rule = v1beta1.RunAsUserStrategy(scc.RunAsUser.Type)
+	case scc.RunAsUser.UIDRangeMin != nil && scc.RunAsUser.UIDRangeMax != nil:
+		psp.Spec.RunAsUser.Rule = v1beta1.RunAsUserStrategyMustRunAs
 	}
 
 	if scc.RunAsUser.UIDRangeMin != nil && scc.RunAsUser.UIDRangeMax != nil {
@@ -128,6 +254,14 @@ func (m *Mutator) buildPsp() policy.PodSecurityPolicy {
 		}
 	}
 
+	if m.needsNamespaceSupplementalGroups() {
+		psp.Spec.SupplementalGroups.Rule = policy.SupplementalGroupsStrategyRunAsAny
+	}
+
+	if m.needsNamespaceFSGroup() {
+		psp.Spec.FSGroup.Rule = policy.FSGroupStrategyRunAsAny
+	}
+
 	psp.Spec.ReadOnlyRootFilesystem = scc.ReadOnlyRootFilesystem
 	psp.Spec.AllowedUnsafeSysctls = scc.AllowedUnsafeSysctls
 	psp.Spec.ForbiddenSysctls = scc.ForbiddenSysctls
@@ -138,61 +272,108 @@ func (m *Mutator) buildPsp() policy.PodSecurityPolicy {
 }
 
 func (m *Mutator) annotateUnsupportedFields(scc security.SecurityContextConstraints) map[string]string {
-	annotations := scc.GetAnnotations()
+	annotations := make(map[string]string, len(scc.Annotations))
 
-	if annotations == nil {
-		annotations = make(map[string]string)
+	for key, value := range scc.Annotations {
+		annotations[key] = value
 	}
 
-	annotateUnsupportedField := func(fieldName string) {
+	annotateUnsupportedField := func(fieldName, path string, severity mutator.Severity, original interface{}, message string) {
 		field := "SecurityContextConstraints." + fieldName
 		annotations[m.name+"/"+field] = "unsupported"
-		m.log.Warnf("[%s] %s is unsupported", m.name, field)
+		m.report.Dropped(path, severity, original, message)
 	}
 
 	if scc.Priority != nil {
-		annotateUnsupportedField("Priority")
+		annotateUnsupportedField("Priority", "priority", mutator.SeverityWarning, *scc.Priority,
+			"PodSecurityPolicy has no priority, policies are chosen by name instead")
 	}
 
 	if scc.RunAsUser.UID != nil {
-		annotateUnsupportedField("RunAsUser.UID")
+		annotateUnsupportedField("RunAsUser.UID", "runAsUser.uid", mutator.SeverityHigh, *scc.RunAsUser.UID,
+			"PodSecurityPolicy cannot force a single UID")
 	}
 
-	if scc.SeccompProfiles != nil {
-		annotateUnsupportedField("SeccompProfiles")
+	return annotations
+}
+
+// translateSeccompProfiles sets the PSP seccomp annotations allowing the SCC profiles, the first one being
+// the default profile
+func (m *Mutator) translateSeccompProfiles(annotations map[string]string) {
+	scc := m.input
+	allowed := []string{}
+	seen := map[string]bool{}
+
+	allow := func(profile string) {
+		if !seen[profile] {
+			seen[profile] = true
+			allowed = append(allowed, profile)
+		}
 	}
 
-	if scc.AllowHostDirVolumePlugin {
-		annotateUnsupportedField("AllowHostDirVolumePlugin")
+	for i, profile := range scc.SeccompProfiles {
+		switch {
+		case profile == seccompAllowAll || profile == seccompRuntimeDefault || profile == seccompUnconfined ||
+			strings.HasPrefix(profile, seccompLocalhostPrefix):
+			allow(profile)
+		case profile == seccompDockerDefault:
+			// docker/default is the deprecated name of runtime/default, pods may request either
+			allow(seccompRuntimeDefault)
+			allow(profile)
+		default:
+			m.report.Dropped(fmt.Sprintf("seccompProfiles[%d]", i), mutator.SeverityWarning, profile,
+				"unknown seccomp profile "+profile+" is not allowed by the PodSecurityPolicy")
+		}
 	}
 
-	if scc.AllowHostPorts {
-		annotateUnsupportedField("AllowHostPorts")
+	if len(allowed) == 0 {
+		return
 	}
 
-	return annotations
+	annotations[seccompAllowedProfilesAnnotation] = strings.Join(allowed, ",")
+
+	defaultProfile := scc.SeccompProfiles[0]
+	if defaultProfile == seccompDockerDefault {
+		defaultProfile = seccompRuntimeDefault
+	}
+
+	if defaultProfile != seccompAllowAll && seen[defaultProfile] {
+		annotations[seccompDefaultProfileAnnotation] = defaultProfile
+	}
+}
+
+func hasVolume(volumes []policy.FSType, volume policy.FSType) bool {
+	for _, v := range volumes {
+		if v == volume {
+			return true
+		}
+	}
+
+	return false
 }
 
 func (m *Mutator) buildClusterRole() rbac.ClusterRole {
-	scc := m.input
+	return m.buildPspClusterRole(m.input.Name)
+}
 
+func (m *Mutator) buildPspClusterRole(pspName string) rbac.ClusterRole {
 	clusterrole := rbac.ClusterRole{}
 	clusterrole.Rules = make([]rbac.PolicyRule, 1)
 	clusterrole.Kind = "ClusterRole"
 	clusterrole.APIVersion = rbacAPIGroup + "/v1"
-	clusterrole.Name = "vmware-psp:" + scc.Name
+	clusterrole.Name = m.options.RBACPrefix + pspName
 
 	clusterrole.Rules[0].Verbs = make([]string, 1)
 	clusterrole.Rules[0].Verbs = []string{"use"}
 
 	clusterrole.Rules[0].APIGroups = make([]string, 1)
-	clusterrole.Rules[0].APIGroups = []string{rbacAPIGroup}
+	clusterrole.Rules[0].APIGroups = []string{policyAPIGroup}
 
 	clusterrole.Rules[0].Resources = make([]string, 1)
 	clusterrole.Rules[0].Resources = []string{"podsecuritypolicies"}
 
 	clusterrole.Rules[0].ResourceNames = make([]string, 1)
-	clusterrole.Rules[0].ResourceNames = []string{scc.Name}
+	clusterrole.Rules[0].ResourceNames = []string{pspName}
 
 	m.log.Debugf("[%s] mutated clusterrole.Rules = %#v", m.name, clusterrole.Rules)
 
@@ -212,12 +393,16 @@ func (m *Mutator) buildClusterRoleBinding() rbac.ClusterRoleBinding {
 		crb := rbac.ClusterRoleBinding{}
 		crb.Kind = "ClusterRoleBinding"
 		crb.APIVersion = rbacAPIGroup + "/v1"
-		crb.Name = "vmware-psp:" + scc.Name
+		crb.Name = m.options.RBACPrefix + scc.Name
 
 		userSubjects := m.buildClusterRoleBindingUserSubjects(scc, crb)
 
 		if len(userSubjects) > 0 {
 			for _, subject := range userSubjects {
+				if m.boundInNamespace(subject) {
+					continue
+				}
+
 				crb.Subjects = append(crb.Subjects, subject)
 			}
 		}
@@ -226,13 +411,17 @@ func (m *Mutator) buildClusterRoleBinding() rbac.ClusterRoleBinding {
 
 		if len(groupSubjects) > 0 {
 			for _, subject := range groupSubjects {
+				if m.boundInNamespace(subject) {
+					continue
+				}
+
 				crb.Subjects = append(crb.Subjects, subject)
 			}
 		}
 
 		crb.RoleRef.Kind = "ClusterRole"
 		crb.RoleRef.APIGroup = rbacAPIGroup
-		crb.RoleRef.Name = "vmware-psp:" + scc.Name
+		crb.RoleRef.Name = m.options.RBACPrefix + scc.Name
 
 		if len(crb.Subjects) > 0 {
 			m.log.Debugf("[%s] mutated clusterrolebinding = %#v", m.name, crb)
@@ -245,26 +434,103 @@ func (m *Mutator) buildClusterRoleBinding() rbac.ClusterRoleBinding {
 	return rbac.ClusterRoleBinding{}
 }
 
+func (m *Mutator) buildRoleBindings() []rbac.RoleBinding {
+	if !m.options.NamespacedServiceAccounts {
+		return nil
+	}
+
+	scc := m.input
+	subjects, namespaces := m.serviceAccountSubjects()
+
+	rolebindings := []rbac.RoleBinding{}
+	for _, namespace := range namespaces {
+		if m.resolvedNamespaces[namespace] {
+			continue
+		}
+
+		rolebindings = append(rolebindings, m.buildRoleBinding(namespace, scc.Name, subjects[namespace]))
+	}
+
+	m.log.Debugf("[%s] mutated rolebindings = %#v", m.name, rolebindings)
+
+	return rolebindings
+}
+
+// buildRoleBinding binds the subjects of a namespace to the ClusterRole granting the use of a PSP
+func (m *Mutator) buildRoleBinding(namespace, pspName string, subjects []rbac.Subject) rbac.RoleBinding {
+	rb := rbac.RoleBinding{}
+	rb.Kind = "RoleBinding"
+	rb.APIVersion = rbacAPIGroup + "/v1"
+	rb.Name = m.options.RBACPrefix + pspName
+	rb.Namespace = namespace
+	rb.Subjects = subjects
+	rb.RoleRef.Kind = "ClusterRole"
+	rb.RoleRef.APIGroup = rbacAPIGroup
+	rb.RoleRef.Name = m.options.RBACPrefix + pspName
+
+	return rb
+}
+
+// serviceAccountSubjects groups by namespace the service accounts and service account groups the SCC is
+// granted to, and returns the sorted namespaces
+func (m *Mutator) serviceAccountSubjects() (map[string][]rbac.Subject, []string) {
+	scc := m.input
+	subjects := map[string][]rbac.Subject{}
+	namespaces := []string{}
+
+	add := func(subject rbac.Subject) {
+		namespace, ok := subjectNamespace(subject)
+		if !ok {
+			return
+		}
+
+		if _, found := subjects[namespace]; !found {
+			namespaces = append(namespaces, namespace)
+		}
+
+		subjects[namespace] = append(subjects[namespace], subject)
+	}
+
+	for _, subject := range m.buildClusterRoleBindingUserSubjects(scc, rbac.ClusterRoleBinding{}) {
+		add(subject)
+	}
+
+	for _, subject := range m.buildClusterRoleBindingGroupSubjects(scc) {
+		add(subject)
+	}
+
+	sort.Strings(namespaces)
+
+	return subjects, namespaces
+}
+
+// boundInNamespace checks whether a subject is bound in its namespace rather than by the ClusterRoleBinding
+func (m *Mutator) boundInNamespace(subject rbac.Subject) bool {
+	namespace, ok := subjectNamespace(subject)
+
+	return ok && (m.options.NamespacedServiceAccounts || m.resolvedNamespaces[namespace])
+}
+
+// subjectNamespace returns the namespace of a service account or a system:serviceaccounts:<namespace> group
+func subjectNamespace(subject rbac.Subject) (string, bool) {
+	switch subject.Kind {
+	case "ServiceAccount":
+		return subject.Namespace, true
+	case "Group":
+		return serviceAccountGroupNamespace(subject.Name)
+	}
+
+	return "", false
+}
+
 func (m Mutator) buildClusterRoleBindingUserSubjects(scc security.SecurityContextConstraints, crb rbac.ClusterRoleBinding) []rbac.Subject {
 	subjects := []rbac.Subject{}
 
 	for i := 0; i < len(scc.Users); i++ {
-		if !(userIgnores.MatchString(scc.Users[i])) {
-			subject := rbac.Subject{}
-
-			if serviceAccount.MatchString(scc.Users[i]) {
-				subject.Kind = "ServiceAccount"
-
-				// parse the Users into system:serviceaccount:<namespace>:<name>
-				userSplit := colon.Split(scc.Users[i], -1)
-				if userSplit != nil {
-					subject.Name = userSplit[len(userSplit)-1]
-					subject.Namespace = userSplit[len(userSplit)-2]
-				}
-			} else {
-				subject.Kind = "User"
-				subject.Name = scc.Users[i]
-				subject.APIGroup = rbacAPIGroup
+		if m.subjectAllowed(scc.Users[i]) {
+			subject, ok := buildUserSubject(scc.Users[i])
+			if !ok {
+				continue
 			}
 
 			subjects = append(subjects, subject)
@@ -276,16 +542,55 @@ func (m Mutator) buildClusterRoleBindingUserSubjects(scc security.SecurityContex
 	return subjects
 }
 
+// buildUserSubject returns the subject of a SCC user. It returns false for a service account user that is
+// not in the system:serviceaccount:<namespace>:<name> form.
+func buildUserSubject(user string) (rbac.Subject, bool) {
+	subject := rbac.Subject{}
+
+	if serviceAccount.MatchString(user) {
+		subject.Kind = "ServiceAccount"
+
+		// parse the Users into system:serviceaccount:<namespace>:<name>
+		userSplit := colon.Split(user, -1)
+		if len(userSplit) != 4 || userSplit[2] == "" || userSplit[3] == "" {
+			return subject, false
+		}
+
+		subject.Name = userSplit[3]
+		subject.Namespace = userSplit[2]
+	} else {
+		subject.Kind = "User"
+		subject.Name = user
+		subject.APIGroup = rbacAPIGroup
+	}
+
+	return subject, true
+}
+
+// reportMalformedUsers reports the service account users skipped by buildUserSubject
+func (m Mutator) reportMalformedUsers(report *mutator.Report) {
+	for _, user := range m.input.Users {
+		if !m.subjectAllowed(user) {
+			continue
+		}
+
+		if _, ok := buildUserSubject(user); !ok {
+			report.Dropped("users", mutator.SeverityHigh, user,
+				"user "+user+" is not a system:serviceaccount:<namespace>:<name> service account, it is not bound")
+		}
+	}
+}
+
 func (m Mutator) buildClusterRoleBindingGroupSubjects(scc security.SecurityContextConstraints) []rbac.Subject {
 	subjects := []rbac.Subject{}
 
 	for i := 0; i < len(scc.Groups); i++ {
-		if !(userIgnores.MatchString(scc.Groups[i])) {
-			subject := rbac.Subject{}
-			subject.Kind = "Group"
-			subject.APIGroup = rbacAPIGroup
-			subject.Name = scc.Groups[i]
+		if !m.subjectAllowed(scc.Groups[i]) {
+			continue
+		}
 
+		if group, ok := translateGroup(scc.Groups[i]); ok {
+			subject := buildGroupSubject(group)
 			subjects = append(subjects, subject)
 
 			m.log.Debugf("[%s] Group subject = %#v", m.name, subject)
@@ -294,3 +599,141 @@ func (m Mutator) buildClusterRoleBindingGroupSubjects(scc security.SecurityConte
 
 	return subjects
 }
+
+func buildGroupSubject(group string) rbac.Subject {
+	return rbac.Subject{
+		Kind:     "Group",
+		APIGroup: rbacAPIGroup,
+		Name:     group,
+	}
+}
+
+// translateGroup returns the Kubernetes group equivalent to a SCC group, and false when there is none
+func translateGroup(group string) (string, bool) {
+	if translated, found := openShiftGroups[group]; found {
+		return translated, translated != ""
+	}
+
+	return group, true
+}
+
+// serviceAccountGroupNamespace returns the namespace of a system:serviceaccounts:<namespace> group
+func serviceAccountGroupNamespace(group string) (string, bool) {
+	prefix := allServiceAccountsGroup + ":"
+
+	if strings.HasPrefix(group, prefix) && len(group) > len(prefix) {
+		return strings.TrimPrefix(group, prefix), true
+	}
+
+	return "", false
+}
+
+func (m *Mutator) reportGroupTranslations() {
+	for _, group := range m.input.Groups {
+		if !m.subjectAllowed(group) {
+			continue
+		}
+
+		translated, ok := translateGroup(group)
+
+		switch {
+		case !ok:
+			m.report.Dropped("groups", mutator.SeverityHigh, group,
+				"group "+group+" only exists on OpenShift and has no Kubernetes equivalent, it is not bound to the ClusterRole")
+		case translated != group:
+			m.report.Approximated("groups", mutator.SeverityWarning, group,
+				"group "+group+" only exists on OpenShift, the Kubernetes group "+translated+" is bound instead")
+		}
+	}
+}
+
+// subjectAllowed checks a SCC user or group against the Include and Exclude options
+func (m Mutator) subjectAllowed(name string) bool {
+	if m.options.Include != nil && !m.options.Include.MatchString(name) {
+		return false
+	}
+
+	return m.options.Exclude == nil || !m.options.Exclude.MatchString(name)
+}
+
+// filteredSubjects returns the SCC users and groups rejected by subjectAllowed
+func (m Mutator) filteredSubjects() []rbac.Subject {
+	subjects := []rbac.Subject{}
+
+	for _, user := range m.input.Users {
+		if m.subjectAllowed(user) {
+			continue
+		}
+
+		if subject, ok := buildUserSubject(user); ok {
+			subjects = append(subjects, subject)
+		}
+	}
+
+	for _, group := range m.input.Groups {
+		if !m.subjectAllowed(group) {
+			subjects = append(subjects, buildGroupSubject(group))
+		}
+	}
+
+	if len(subjects) > 0 {
+		m.log.Infof("[%s] subjects filtered out = %#v", m.name, subjects)
+	}
+
+	return subjects
+}
+
+// GroupVersionKind is the kind of the source objects converted by this package
+var GroupVersionKind = security.GroupVersion.WithKind("SecurityContextConstraints")
+
+// ObjectMutator adapts this package to the mutator.Mutator interface
+type ObjectMutator struct {
+	name    string
+	log     logrus.FieldLogger
+	options Options
+}
+
+// NewObjectMutator creates a mutator.Mutator converting SecurityContextConstraints objects.
+// Clients of this API should set a meaningful name that can be used to easily identify the calling client.
+func NewObjectMutator(name string, log logrus.FieldLogger, options Options) *ObjectMutator {
+	return &ObjectMutator{
+		name:    name,
+		log:     log,
+		options: options,
+	}
+}
+
+// Mutate converts a SecurityContextConstraints object into PodSecurityPolicy, ClusterRole and, when the
+// SCC has subjects left after filtering, ClusterRoleBinding and RoleBinding objects
+func (o *ObjectMutator) Mutate(obj runtime.Object) (*mutator.Result, error) {
+	scc := security.SecurityContextConstraints{}
+	if err := mutator.Convert(obj, &scc); err != nil {
+		return nil, err
+	}
+
+	m := NewMutator(o.name, o.log, scc, o.options)
+	output, err := m.Mutate()
+	if err != nil {
+		return nil, err
+	}
+
+	result := &mutator.Result{
+		Report: output.Report,
+	}
+	result.Objects = append(result.Objects, &output.PodSecurityPolicy, &output.ClusterRole)
+
+	if len(output.ClusterRoleBinding.Subjects) > 0 {
+		result.Objects = append(result.Objects, &output.ClusterRoleBinding)
+	}
+
+	for i := range output.RoleBindings {
+		result.Objects = append(result.Objects, &output.RoleBindings[i])
+	}
+
+	for i := range output.NamespacePolicies {
+		namespacePolicy := &output.NamespacePolicies[i]
+		result.Objects = append(result.Objects, &namespacePolicy.PodSecurityPolicy, &namespacePolicy.ClusterRole, &namespacePolicy.RoleBinding)
+	}
+
+	return result, nil
+}
@@ -5,14 +5,17 @@ import (
 	"io/ioutil"
 	"path/filepath"
 	"reflect"
+	"regexp"
 	"testing"
 
+	"github.com/brito-rafa/k8s-mutators/pkg/mutator"
 	security "github.com/openshift/api/security/v1"
 	"github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 	v1 "k8s.io/api/core/v1"
 	"k8s.io/api/policy/v1beta1"
 	rbac "k8s.io/api/rbac/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
 )
 
 const clientName = "testClient"
@@ -26,7 +29,9 @@ func TestBuildPsp(t *testing.T) {
 	assert.Equal(t, "policy/v1beta1", psp.APIVersion)
 	assert.Equal(t, scc.Name, psp.Name)
 	assert.Equal(t, scc.Namespace, psp.Namespace)
-	assert.Equal(t, len(psp.Annotations), 6)
+	assert.Equal(t, len(psp.Annotations), 4)
+	assert.Equal(t, "*", psp.Annotations["seccomp.security.alpha.kubernetes.io/allowedProfileNames"])
+	assert.NotContains(t, psp.Annotations, "seccomp.security.alpha.kubernetes.io/defaultProfileName")
 	assert.Equal(t, 1, len(psp.Labels))
 	assert.Contains(t, psp.Labels, "testkey")
 	assert.Equal(t, "testval", psp.Labels["testkey"])
@@ -37,9 +42,9 @@ func TestBuildPsp(t *testing.T) {
 	assert.Contains(t, psp.Spec.RequiredDropCapabilities[0], "MKNOD")
 	assert.Equal(t, 1, len(psp.Spec.AllowedCapabilities))
 	assert.Contains(t, psp.Spec.AllowedCapabilities[0], "KILL")
-	assert.Equal(t, 6, len(psp.Spec.Volumes))
+	assert.Equal(t, 7, len(psp.Spec.Volumes))
 
-	expected := []string{"configMap", "downwardAPI", "emptyDir", "persistentVolumeClaim", "projected", "secret"}
+	expected := []string{"configMap", "downwardAPI", "emptyDir", "persistentVolumeClaim", "projected", "secret", "hostPath"}
 
 	var volumes []string
 	for _, volume := range psp.Spec.Volumes {
@@ -88,9 +93,46 @@ func TestBuildPsp(t *testing.T) {
 	assert.Equal(t, scc.ForbiddenSysctls, psp.Spec.ForbiddenSysctls)
 }
 
+func TestBuildPspHostAccess(t *testing.T) {
+	m := newMutatorFromFileData(t, "full.json")
+	psp := m.buildPsp()
+
+	assert.Equal(t, []v1beta1.HostPortRange{{Min: 0, Max: 65535}}, psp.Spec.HostPorts)
+	assert.Equal(t, 0, len(psp.Spec.AllowedHostPaths))
+
+	// the SCC input is not modified
+	assert.Equal(t, 1, len(m.input.Annotations))
+
+	scc := security.SecurityContextConstraints{}
+	scc.AllowHostDirVolumePlugin = true
+	scc.Volumes = []security.FSType{security.FSTypeAll}
+
+	m = NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	psp = m.buildPsp()
+
+	assert.Equal(t, []v1beta1.FSType{v1beta1.All}, psp.Spec.Volumes)
+	assert.Equal(t, 0, len(psp.Spec.HostPorts))
+}
+
+func TestBuildPspSeccompProfiles(t *testing.T) {
+	scc := security.SecurityContextConstraints{}
+	scc.SeccompProfiles = []string{"docker/default", "runtime/default", "localhost/profiles/audit.json", "custom"}
+
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	psp := m.buildPsp()
+
+	assert.Equal(t, "runtime/default,docker/default,localhost/profiles/audit.json",
+		psp.Annotations["seccomp.security.alpha.kubernetes.io/allowedProfileNames"])
+	assert.Equal(t, "runtime/default", psp.Annotations["seccomp.security.alpha.kubernetes.io/defaultProfileName"])
+
+	assert.Equal(t, 1, len(m.report.Entries))
+	assert.Equal(t, "seccompProfiles[3]", m.report.Entries[0].Path)
+	assert.Equal(t, "custom", m.report.Entries[0].Original)
+}
+
 func TestBuildPspDefaultEmptyElements(t *testing.T) {
 	scc := security.SecurityContextConstraints{}
-	m := NewMutator(clientName, logrus.New(), scc)
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
 	psp := m.buildPsp()
 
 	assert.Equal(t, 0, len(psp.Annotations))
@@ -103,7 +145,7 @@ func TestBuildClusterRole(t *testing.T) {
 	scc := security.SecurityContextConstraints{}
 	scc.Name = "crTest"
 
-	m := NewMutator(clientName, logrus.New(), scc)
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
 	cr := m.buildClusterRole()
 
 	assert.Equal(t, "ClusterRole", cr.Kind)
@@ -113,7 +155,7 @@ func TestBuildClusterRole(t *testing.T) {
 	assert.Equal(t, 1, len(cr.Rules[0].Verbs))
 	assert.Equal(t, "use", cr.Rules[0].Verbs[0])
 	assert.Equal(t, 1, len(cr.Rules[0].APIGroups))
-	assert.Equal(t, "rbac.authorization.k8s.io", cr.Rules[0].APIGroups[0])
+	assert.Equal(t, "policy", cr.Rules[0].APIGroups[0])
 	assert.Equal(t, 1, len(cr.Rules[0].Resources))
 	assert.Equal(t, "podsecuritypolicies", cr.Rules[0].Resources[0])
 	assert.Equal(t, scc.Name, cr.Rules[0].ResourceNames[0])
@@ -121,7 +163,7 @@ func TestBuildClusterRole(t *testing.T) {
 
 func TestBuildClusterRoleBindingNoUsersOrGroups(t *testing.T) {
 	scc := security.SecurityContextConstraints{}
-	m := NewMutator(clientName, logrus.New(), scc)
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
 	crb := m.buildClusterRoleBinding()
 
 	assert.ObjectsAreEqual(rbac.ClusterRoleBinding{}, crb)
@@ -133,7 +175,7 @@ func TestBuildClusterRoleBindingWithServiceAccountUser(t *testing.T) {
 	scc.Users = make([]string, 1)
 	scc.Users[0] = "system:serviceaccount:default:default"
 
-	m := NewMutator(clientName, logrus.New(), scc)
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
 	crb := m.buildClusterRoleBinding()
 
 	apiGroup := "rbac.authorization.k8s.io"
@@ -159,7 +201,7 @@ func TestBuildClusterRoleBindingWithNonServiceAccountUser(t *testing.T) {
 	scc.Users = make([]string, 1)
 	scc.Users[0] = "testservice:testaccount:default:default"
 
-	m := NewMutator(clientName, logrus.New(), scc)
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
 	crb := m.buildClusterRoleBinding()
 
 	apiGroup := "rbac.authorization.k8s.io"
@@ -189,7 +231,7 @@ func TestBuildClusterRoleBindingWithDisallowedUsers(t *testing.T) {
 		scc.Users = make([]string, 1)
 		scc.Users[0] = disallowedUser
 
-		m := NewMutator(clientName, logrus.New(), scc)
+		m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
 		crb := m.buildClusterRoleBinding()
 
 		assert.Equal(t, 0, len(crb.Subjects))
@@ -203,7 +245,7 @@ func TestBuildClusterRoleBindingWithGroup(t *testing.T) {
 	scc.Groups = make([]string, 1)
 	scc.Groups[0] = "system:authenticated"
 
-	m := NewMutator(clientName, logrus.New(), scc)
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
 	crb := m.buildClusterRoleBinding()
 
 	apiGroup := "rbac.authorization.k8s.io"
@@ -234,7 +276,7 @@ func TestBuildRoleBindingWithDisallowedGroups(t *testing.T) {
 		scc.Groups = make([]string, 1)
 		scc.Groups[0] = disdisallowedGroup
 
-		m := NewMutator(clientName, logrus.New(), scc)
+		m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
 		crb := m.buildClusterRoleBinding()
 
 		assert.Equal(t, 0, len(crb.Subjects))
@@ -242,6 +284,307 @@ func TestBuildRoleBindingWithDisallowedGroups(t *testing.T) {
 	}
 }
 
+func TestBuildClusterRoleBindingWithOptions(t *testing.T) {
+	scc := security.SecurityContextConstraints{}
+	scc.Name = "optionsTest"
+	scc.Users = []string{"system:serviceaccount:velero:admin", "system:serviceaccount:team-a:app", "system:serviceaccount:team-b:app"}
+	scc.Groups = []string{"system:authenticated"}
+
+	options := Options{
+		RBACPrefix: "custom:",
+		Include:    regexp.MustCompile(`velero|team-a`),
+	}
+
+	m := NewMutator(clientName, logrus.New(), scc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, "custom:optionsTest", output.ClusterRole.Name)
+	assert.Equal(t, "custom:optionsTest", output.ClusterRoleBinding.Name)
+	assert.Equal(t, "custom:optionsTest", output.ClusterRoleBinding.RoleRef.Name)
+
+	assert.Equal(t, 2, len(output.ClusterRoleBinding.Subjects))
+	assert.Equal(t, "velero", output.ClusterRoleBinding.Subjects[0].Namespace)
+	assert.Equal(t, "team-a", output.ClusterRoleBinding.Subjects[1].Namespace)
+
+	assert.Equal(t, 2, len(output.FilteredSubjects))
+	assert.Equal(t, "team-b", output.FilteredSubjects[0].Namespace)
+	assert.Equal(t, "Group", output.FilteredSubjects[1].Kind)
+	assert.Equal(t, "system:authenticated", output.FilteredSubjects[1].Name)
+
+	filtered := output.Report.AtLeast(mutator.SeverityHigh)
+	assert.Equal(t, 2, len(filtered))
+	assert.Equal(t, "users", filtered[0].Path)
+	assert.Equal(t, "groups", filtered[1].Path)
+
+	options.Exclude = regexp.MustCompile(`velero`)
+	m = NewMutator(clientName, logrus.New(), scc, options)
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(output.ClusterRoleBinding.Subjects))
+	assert.Equal(t, 3, len(output.FilteredSubjects))
+}
+
+func TestMutateFilteredSubjectsWithDefaultOptions(t *testing.T) {
+	scc := security.SecurityContextConstraints{}
+	scc.Name = "filtered"
+	scc.Users = []string{"system:serviceaccount:openshift-monitoring:prometheus", "system:serviceaccount:web:default"}
+
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(output.ClusterRoleBinding.Subjects))
+	assert.Equal(t, 1, len(output.FilteredSubjects))
+	assert.Equal(t, "prometheus", output.FilteredSubjects[0].Name)
+	assert.Equal(t, "openshift-monitoring", output.FilteredSubjects[0].Namespace)
+}
+
+func TestBuildRoleBindingsForServiceAccounts(t *testing.T) {
+	scc := security.SecurityContextConstraints{}
+	scc.Name = "namespaced"
+	scc.Users = []string{"system:serviceaccount:web:default", "alice", "system:serviceaccount:api:builder", "system:serviceaccount:web:deployer"}
+
+	options := DefaultOptions()
+	options.NamespacedServiceAccounts = true
+
+	m := NewMutator(clientName, logrus.New(), scc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(output.ClusterRoleBinding.Subjects))
+	assert.Equal(t, "alice", output.ClusterRoleBinding.Subjects[0].Name)
+
+	assert.Equal(t, 2, len(output.RoleBindings))
+
+	rb := output.RoleBindings[0]
+	assert.Equal(t, "RoleBinding", rb.Kind)
+	assert.Equal(t, "rbac.authorization.k8s.io/v1", rb.APIVersion)
+	assert.Equal(t, "vmware-psp:namespaced", rb.Name)
+	assert.Equal(t, "api", rb.Namespace)
+	assert.Equal(t, 1, len(rb.Subjects))
+	assert.Equal(t, "ClusterRole", rb.RoleRef.Kind)
+	assert.Equal(t, "vmware-psp:namespaced", rb.RoleRef.Name)
+
+	assert.Equal(t, "web", output.RoleBindings[1].Namespace)
+	assert.Equal(t, 2, len(output.RoleBindings[1].Subjects))
+	assert.Equal(t, "default", output.RoleBindings[1].Subjects[0].Name)
+	assert.Equal(t, "deployer", output.RoleBindings[1].Subjects[1].Name)
+
+	// without the option the service accounts stay in the ClusterRoleBinding
+	m = NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 4, len(output.ClusterRoleBinding.Subjects))
+	assert.Equal(t, 0, len(output.RoleBindings))
+}
+
+func TestBuildRoleBindingsOnlyServiceAccounts(t *testing.T) {
+	scc := security.SecurityContextConstraints{}
+	scc.Name = "namespaced"
+	scc.Users = []string{"system:serviceaccount:web:default"}
+
+	options := DefaultOptions()
+	options.NamespacedServiceAccounts = true
+
+	m := NewMutator(clientName, logrus.New(), scc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.True(t, reflect.DeepEqual(output.ClusterRoleBinding, rbac.ClusterRoleBinding{}))
+	assert.Equal(t, 1, len(output.RoleBindings))
+}
+
+func TestBuildClusterRoleBindingWithOpenShiftGroups(t *testing.T) {
+	scc := security.SecurityContextConstraints{}
+	scc.Name = "groups"
+	scc.Groups = []string{"system:authenticated", "system:authenticated:oauth", "system:cluster-admins", "system:serviceaccounts:web"}
+
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	names := []string{}
+	for _, subject := range output.ClusterRoleBinding.Subjects {
+		names = append(names, subject.Name)
+	}
+	assert.Equal(t, []string{"system:authenticated", "system:masters", "system:serviceaccounts:web"}, names)
+
+	assert.Equal(t, 2, len(output.Report.Entries))
+	assert.Equal(t, mutator.ActionDropped, output.Report.Entries[0].Action)
+	assert.Equal(t, "system:authenticated:oauth", output.Report.Entries[0].Original)
+	assert.Equal(t, mutator.SeverityHigh, output.Report.Entries[0].Severity)
+	assert.Equal(t, mutator.ActionApproximated, output.Report.Entries[1].Action)
+	assert.Equal(t, "system:cluster-admins", output.Report.Entries[1].Original)
+
+	// namespace service account groups are bound in their namespace
+	options := DefaultOptions()
+	options.NamespacedServiceAccounts = true
+
+	m = NewMutator(clientName, logrus.New(), scc, options)
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, len(output.ClusterRoleBinding.Subjects))
+	assert.Equal(t, 1, len(output.RoleBindings))
+	assert.Equal(t, "web", output.RoleBindings[0].Namespace)
+	assert.Equal(t, "Group", output.RoleBindings[0].Subjects[0].Kind)
+	assert.Equal(t, "system:serviceaccounts:web", output.RoleBindings[0].Subjects[0].Name)
+}
+
+func TestMutateValidatesRBAC(t *testing.T) {
+	scc := security.SecurityContextConstraints{}
+	scc.Users = []string{"system:serviceaccount:web:default"}
+
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	_, err := m.Mutate()
+	assert.Error(t, err)
+
+}
+
+func TestMutateMalformedServiceAccountUser(t *testing.T) {
+	scc := newRestrictedV2SCC()
+	scc.Users = []string{"system:serviceaccount:default", "system:serviceaccount:web:default:extra", "system:serviceaccount:web:default"}
+
+	m := NewMutator(clientName, logrus.New(), scc, DefaultOptions())
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(output.ClusterRoleBinding.Subjects))
+	assert.Equal(t, "default", output.ClusterRoleBinding.Subjects[0].Name)
+	assert.Equal(t, "web", output.ClusterRoleBinding.Subjects[0].Namespace)
+
+	dropped := []interface{}{}
+	for _, entry := range output.Report.Entries {
+		if entry.Path == "users" {
+			assert.Equal(t, mutator.ActionDropped, entry.Action)
+			assert.Equal(t, mutator.SeverityHigh, entry.Severity)
+			dropped = append(dropped, entry.Original)
+		}
+	}
+	assert.Equal(t, []interface{}{"system:serviceaccount:default", "system:serviceaccount:web:default:extra"}, dropped)
+
+	// the other conversions skip and report them as well
+	gatekeeper := m.MutateGatekeeper()
+	assert.Equal(t, "system:serviceaccount:default", gatekeeper.Report.Entries[0].Original)
+	assert.Equal(t, mutator.SeverityHigh, gatekeeper.Report.Entries[0].Severity)
+}
+
+func TestValidateOutput(t *testing.T) {
+	m := newMutatorFromFileData(t, "full.json")
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	output.ClusterRole.Rules[0].APIGroups = []string{"rbac.authorization.k8s.io"}
+	assert.Error(t, validateOutput(output))
+
+	output.ClusterRole.Rules[0].APIGroups = []string{"policy"}
+	output.ClusterRoleBinding.RoleRef.Name = "other"
+	assert.Error(t, validateOutput(output))
+
+	output.ClusterRoleBinding.RoleRef.Name = output.ClusterRole.Name
+	output.ClusterRoleBinding.Subjects[0].APIGroup = ""
+	assert.Error(t, validateOutput(output))
+
+	output.ClusterRoleBinding.Subjects[0].APIGroup = "rbac.authorization.k8s.io"
+	assert.NoError(t, validateOutput(output))
+}
+
+func TestObjectMutator(t *testing.T) {
+	sccFile, err := ioutil.ReadFile(filepath.Join("testdata", "full.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	obj := &unstructured.Unstructured{}
+	if err := json.Unmarshal(sccFile, &obj.Object); err != nil {
+		t.Fatal(err)
+	}
+	obj.SetAPIVersion(GroupVersionKind.GroupVersion().String())
+
+	r := mutator.NewRegistry()
+	assert.NoError(t, r.Register(GroupVersionKind, NewObjectMutator(clientName, logrus.New(), DefaultOptions())))
+
+	result, err := r.Mutate(obj)
+
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(result.Objects))
+	assert.Equal(t, "fulltest", result.Objects[0].(*v1beta1.PodSecurityPolicy).Name)
+	assert.Equal(t, "vmware-psp:fulltest", result.Objects[1].(*rbac.ClusterRole).Name)
+	assert.Equal(t, 2, len(result.Objects[2].(*rbac.ClusterRoleBinding).Subjects))
+}
+
+func TestMutateReport(t *testing.T) {
+	m := newMutatorFromFileData(t, "full.json")
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	paths := []string{}
+	approximated := []mutator.Entry{}
+	for _, entry := range output.Report.Entries {
+		if entry.Action == mutator.ActionApproximated {
+			approximated = append(approximated, entry)
+			continue
+		}
+
+		paths = append(paths, entry.Path)
+		assert.Equal(t, mutator.ActionDropped, entry.Action)
+	}
+
+	assert.ElementsMatch(t, []string{"priority", "runAsUser.uid"}, paths)
+	assert.Equal(t, 1, len(approximated))
+	assert.Equal(t, "system:cluster-admins", approximated[0].Original)
+	assert.Equal(t, mutator.SeverityHigh, output.Report.MaxSeverity())
+
+	// mutating again does not accumulate entries
+	again, err := m.Mutate()
+	assert.NoError(t, err)
+	assert.Equal(t, len(output.Report.Entries), len(again.Report.Entries))
+}
+
+func TestMutateReportMustRunAsRange(t *testing.T) {
+	scc := security.SecurityContextConstraints{}
+	scc.Name = "range"
+	scc.RunAsUser.Type = security.RunAsUserStrategyMustRunAsRange
+	scc.Users = []string{"system:serviceaccount:web:default", "system:serviceaccount:api:builder"}
+
+	options := DefaultOptions()
+	options.Namespaces = []v1.Namespace{
+		newAnnotatedNamespace("web", map[string]string{"openshift.io/sa.scc.uid-range": "1000650000/10000"}),
+	}
+
+	m := NewMutator(clientName, logrus.New(), scc, options)
+	output, err := m.Mutate()
+	assert.NoError(t, err)
+
+	entries := output.Report.ByPath()
+
+	entry := entries["runAsUser.type"]
+	assert.Equal(t, mutator.ActionDefaulted, entry.Action)
+	assert.Equal(t, mutator.SeverityHigh, entry.Severity)
+	assert.Contains(t, entry.Message, "namespaces api may run as any user")
+
+	// every granted namespace is resolved, nothing is bound to the RunAsAny policy
+	scc.Users = []string{"system:serviceaccount:web:default"}
+
+	m = NewMutator(clientName, logrus.New(), scc, options)
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+	assert.Empty(t, output.Report.Entries)
+
+	scc.Users = append(scc.Users, "alice")
+
+	m = NewMutator(clientName, logrus.New(), scc, options)
+	output, err = m.Mutate()
+	assert.NoError(t, err)
+
+	assert.Equal(t, 1, len(output.Report.Entries))
+	assert.Equal(t, "runAsUser.type", output.Report.Entries[0].Path)
+	assert.Contains(t, output.Report.Entries[0].Message, "bound cluster wide")
+}
+
 func newMutatorFromFileData(t *testing.T, fileName string) Mutator {
 	sccFilePath := filepath.Join("testdata", fileName)
 	sccFile, err := ioutil.ReadFile(sccFilePath)
@@ -257,5 +600,5 @@ func newMutatorFromFileData(t *testing.T, fileName string) Mutator {
 		t.Errorf("Failed to unmarshall SecurityContextConstraints JSON = %v", err)
 	}
 
-	return NewMutator(clientName, logrus.New(), scc)
+	return NewMutator(clientName, logrus.New(), scc, DefaultOptions())
 }
@@ -0,0 +1,109 @@
+package scc2psp
+
+import (
+	"fmt"
+
+	rbac "k8s.io/api/rbac/v1"
+	utilerrors "k8s.io/apimachinery/pkg/util/errors"
+)
+
+// validateOutput checks the generated RBAC objects grant the use of the generated PodSecurityPolicy
+func validateOutput(output *MutatorOutput) error {
+	errs := []error{}
+
+	psp := output.PodSecurityPolicy
+	if psp.Name == "" {
+		errs = append(errs, fmt.Errorf("PodSecurityPolicy has no name"))
+	}
+
+	role := output.ClusterRole
+	if !roleGrantsPsp(role, psp.Name) {
+		errs = append(errs, fmt.Errorf("ClusterRole %q does not grant use of the PodSecurityPolicy %q", role.Name, psp.Name))
+	}
+
+	crb := output.ClusterRoleBinding
+	if len(crb.Subjects) > 0 {
+		errs = append(errs, validateBinding("ClusterRoleBinding "+crb.Name, crb.RoleRef, crb.Subjects, role)...)
+	}
+
+	for _, rb := range output.RoleBindings {
+		name := "RoleBinding " + rb.Namespace + "/" + rb.Name
+
+		if len(rb.Subjects) == 0 {
+			errs = append(errs, fmt.Errorf("%s has no subjects", name))
+		}
+
+		errs = append(errs, validateBinding(name, rb.RoleRef, rb.Subjects, role)...)
+	}
+
+	for _, namespacePolicy := range output.NamespacePolicies {
+		name := namespacePolicy.PodSecurityPolicy.Name
+
+		if !roleGrantsPsp(namespacePolicy.ClusterRole, name) {
+			errs = append(errs, fmt.Errorf("ClusterRole %q does not grant use of the PodSecurityPolicy %q", namespacePolicy.ClusterRole.Name, name))
+		}
+
+		rb := namespacePolicy.RoleBinding
+		errs = append(errs, validateBinding("RoleBinding "+rb.Namespace+"/"+rb.Name, rb.RoleRef, rb.Subjects, namespacePolicy.ClusterRole)...)
+	}
+
+	return utilerrors.NewAggregate(errs)
+}
+
+func roleGrantsPsp(role rbac.ClusterRole, pspName string) bool {
+	for _, rule := range role.Rules {
+		if contains(rule.Verbs, "use") && contains(rule.APIGroups, policyAPIGroup) &&
+			contains(rule.Resources, "podsecuritypolicies") && contains(rule.ResourceNames, pspName) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func validateBinding(name string, roleRef rbac.RoleRef, subjects []rbac.Subject, role rbac.ClusterRole) []error {
+	errs := []error{}
+
+	if roleRef.Kind != "ClusterRole" || roleRef.APIGroup != rbacAPIGroup || roleRef.Name != role.Name {
+		errs = append(errs, fmt.Errorf("%s references %s %q instead of ClusterRole %q", name, roleRef.Kind, roleRef.Name, role.Name))
+	}
+
+	for _, subject := range subjects {
+		if err := validateSubject(subject); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+		}
+	}
+
+	return errs
+}
+
+func validateSubject(subject rbac.Subject) error {
+	if subject.Name == "" {
+		return fmt.Errorf("%s subject has no name", subject.Kind)
+	}
+
+	switch subject.Kind {
+	case "ServiceAccount":
+		if subject.Namespace == "" || subject.APIGroup != "" {
+			return fmt.Errorf("service account %q must have a namespace and no API group", subject.Name)
+		}
+	case "User", "Group":
+		if subject.APIGroup != rbacAPIGroup {
+			return fmt.Errorf("%s %q must have the API group %s", subject.Kind, subject.Name, rbacAPIGroup)
+		}
+	default:
+		return fmt.Errorf("subject %q has unknown kind %q", subject.Name, subject.Kind)
+	}
+
+	return nil
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+
+	return false
+}